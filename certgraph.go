@@ -1,22 +1,41 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lanrat/certgraph/dns"
 	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/driver/censys"
+	"github.com/lanrat/certgraph/driver/certspotter"
 	"github.com/lanrat/certgraph/driver/crtsh"
+	"github.com/lanrat/certgraph/driver/feed"
 	"github.com/lanrat/certgraph/driver/google"
 	"github.com/lanrat/certgraph/driver/http"
+	"github.com/lanrat/certgraph/driver/multi"
 	"github.com/lanrat/certgraph/driver/smtp"
+	"github.com/lanrat/certgraph/fingerprint"
 	"github.com/lanrat/certgraph/graph"
+	"github.com/lanrat/certgraph/rdap"
+	"github.com/lanrat/certgraph/revocation"
+	"github.com/lanrat/certgraph/status"
+	"github.com/lanrat/certgraph/trace"
+	"github.com/lanrat/certgraph/tunnel"
 	"github.com/lanrat/certgraph/web"
 )
 
@@ -26,184 +45,1481 @@ var (
 	certGraph = graph.NewCertGraph()
 )
 
+// exit codes
+const (
+	exitOK          = 0   // the crawl completed
+	exitError       = 1   // an error prevented the crawl from starting
+	exitUsage       = 2   // invalid arguments, the same code used by the flag package
+	exitDriver      = 3   // the driver could not be set up
+	exitNoResults   = 4   // the crawl completed without finding any certificates
+	exitSeedsFailed = 5   // every root domain failed to be queried
+	exitPartial     = 6   // the crawl stopped early because it reached a limit such as -max-sans-total
+	exitCancelled   = 7   // the crawl was interrupted and stopped early
+	exitInterrupted = 130 // interrupted a second time, before the partial results were printed
+)
+
 var certDriver driver.Driver
 
+// number of root domains that failed to be queried
+var failedSeeds int32
+
+// queryDriver is used to query the domains, it is certDriver or a batcher for certDriver if it supports batching
+var queryDriver driver.Driver
+
+// driverRules routes domains to other drivers than certDriver when -driver-rules is set
+var driverRules *driver.Rules
+
+// tlsPolicyMin is the minimum TLS version domains are checked against with -tls-policy-min, 0 when not checked
+var tlsPolicyMin uint16
+
+// importedMetadata is the metadata of the graph loaded by -import
+var importedMetadata map[string]interface{}
+
+// routedDrivers are the query drivers for each of the drivers used by driverRules
+var routedDrivers map[string]driver.Driver
+
+// batchers are the batching drivers of queryDriver and routedDrivers, closed once the crawl completes
+var batchers []*driver.Batcher
+
+// driverHealth tracks the outcome of the queries made to each driver by name, in the order the drivers were created
+var driverHealth = make(map[string]*driver.Health)
+var driverHealthOrder []*driver.Health
+
+// retryBudget limits the retries made by every driver with -retry-budget
+var retryBudget *driver.RetryBudget
+
+// how often the heap size is checked against -mem-limit
+// it is a variable so tests don't have to wait for it
+var memCheckInterval = time.Second
+
+// how many memory checks between each verbose report of the heap size
+const memReportChecks = 10
+
+// memoryLimited is set to 1 once the heap size has exceeded -mem-limit
+var memoryLimited int32
+
+// outputLimited is set to 1 once -limit domains have been printed as they were found
+var outputLimited int32
+
+// how long to wait for more domains to join a batch before querying a driver that supports batching
+const batchWait = 50 * time.Millisecond
+
+// maximum number of certificates a single domain's visit looks up at once
+const certQueryWorkers = 4
+
+// maximum number of domains to seed from an organization search
+const orgSearchLimit = 1000
+
+// rdapClient looks up the registration of the domains when -rdap is set
+var rdapClient *rdap.Client
+
+// certQuerySlots limits the certificate lookups made at once across the whole crawl to -parallel
+var certQuerySlots chan bool
+
+// crlChecker is used to check certificates for revocation when -crl is set
+var crlChecker *revocation.CRLChecker
+
+// wildcardDetector filters domains resolved by -resolve that only exist because of wildcard DNS records
+var wildcardDetector *dns.WildcardDetector
+
+// crawlScope limits the domains crawled to those matching -include and -exclude, nil crawls every domain
+var crawlScope *dns.Scope
+
+// seedApexes are the apex domains of the root domains, used to find first party certificates
+var seedApexes map[string]bool
+
+// crawlPause holds new domain queries while the crawl is paused with pauseSignal
+var crawlPause = newPauseGate()
+
+// tracer records the crawl events when -trace is set
+var tracer *trace.Tracer
+
+// priorGraph is the graph loaded from -diff-against to compare the results with
+var priorGraph *graph.Snapshot
+
+// outputWriter writes the graph to w in an output format
+// metadata describes the scan for formats that can include it
+type outputWriter func(w io.Writer, g *graph.CertGraph, metadata map[string]interface{}) error
+
+// outputFormats are the graph output formats that can be selected with -format
+var outputFormats = map[string]outputWriter{
+	"json":    writeJSONGraph,
+	"mermaid": writeMermaidGraph,
+	"dot":     writeDOTGraph,
+	"gob":     writeGobGraph,
+}
+
 // config & flags
 // TODO move driver options to own struct
 var config struct {
+	timeoutSeconds      uint
 	timeout             time.Duration
 	verbose             bool
 	maxDepth            uint
+	seedDepth           uint
 	parallel            uint
+	parallelRoots       uint
 	savePath            string
 	details             bool
 	printJSON           bool
+	printDOT            bool
+	format              string
+	sortBy              string
+	mermaidMaxNodes     int
+	directed            bool
+	jsonCompact         bool
+	checkCRL            bool
+	requireValidSAN     bool
 	driver              string
+	driverOptions       *driver.Options
+	driverRules         string
 	includeCTSubdomains bool
 	includeCTExpired    bool
 	cdn                 bool
 	maxSANsSize         int
+	maxSANsTotal        int
+	limit               int
+	memLimit            uint64
 	apex                bool
+	apexNewOnly         bool
+	apexDepth           uint
+	firstParty          bool
+	firstPartyThreshold float64
 	updatePSL           bool
 	checkDNS            bool
+	pruneDead           bool
+	include             string
+	exclude             string
+	resolve             bool
 	printVersion        bool
 	serve               string
+	sharedCerts         int
+	expiredLive         bool
+	certSimilarity      float64
+	certSimilarityMax   int
+	certAges            bool
+	groupBySubject      bool
+	feed                string
+	diffAgainst         string
+	maxResponseMB       uint
+	maxResponseSize     int64
+	maxConnsPerHost     int
+	retries             uint
+	retryBudget         uint
+	sshJump             string
+	sshKey              string
+	sshKnownHosts       string
+	boltPath            string
+	tracePath           string
+	importPath          string
+	profileSeeds        bool
+	collapseRenewals    bool
+	ipList              bool
+	ipListDomains       bool
+	tlsPolicyMin        string
+	quietErrors         bool
+	profileHosts        string
+	org                 string
+	streamInput         bool
+	inputPath           string
+	allowPrivate        bool
+	rdap                bool
 }
 
 func init() {
-	var timeoutSeconds uint
 	flag.BoolVar(&config.printVersion, "version", false, "print version and exit")
-	flag.UintVar(&timeoutSeconds, "timeout", 10, "tcp timeout in seconds")
+	flag.UintVar(&config.timeoutSeconds, "timeout", 10, "tcp timeout in seconds")
+	flag.UintVar(&config.maxResponseMB, "max-response-size", 50, "maximum size in MB of driver http responses, 0 has no limit")
+	flag.IntVar(&config.maxConnsPerHost, "max-conns-per-host", 0, "maximum number of concurrent connections to any single host, 0 has no limit")
+	flag.UintVar(&config.retries, "retries", 0, "number of times to retry domain queries that timed out or were rate limited, with an exponential backoff")
+	flag.UintVar(&config.retryBudget, "retry-budget", 0, "maximum number of -retries made across the whole crawl, once used up failed queries are no longer retried, 0 has no limit")
+	flag.StringVar(&config.sshJump, "ssh-jump", "", "connect to the domains through this SSH jump host, as user@host[:port], only used by the live drivers")
+	flag.StringVar(&config.sshKey, "ssh-key", "", "private key file to authenticate to the -ssh-jump host with, uses the SSH agent if not set")
+	flag.StringVar(&config.sshKnownHosts, "ssh-known-hosts", "~/.ssh/known_hosts", "known hosts file to verify the -ssh-jump host key with")
 	flag.BoolVar(&config.verbose, "verbose", false, "verbose logging")
-	flag.StringVar(&config.driver, "driver", "http", fmt.Sprintf("driver to use [%s]", strings.Join(driver.Drivers, ", ")))
+	flag.BoolVar(&config.quietErrors, "quiet-errors", false, "don't log the expected network errors of a crawl with -verbose, such as domains that don't resolve, refused connections, and timeouts")
+	flag.StringVar(&config.driver, "driver", "http", fmt.Sprintf("driver to use [%s], or a comma separated list of drivers to merge the results of", strings.Join(driver.Drivers, ", ")))
+	config.driverOptions = driver.NewOptions()
+	flag.Var(config.driverOptions, "driver-arg", "driver specific `key=value` option, can be repeated, see the README for the options supported by each driver")
+	flag.StringVar(&config.driverRules, "driver-rules", "", "file of rules routing domains to other drivers than -driver, see the README for the rule format")
+	flag.StringVar(&config.feed, "feed", "", "file or URL of the JSON certificate feed to use with the feed driver")
+	flag.StringVar(&config.org, "org", "", "seed the search with the domains in certificates issued to this organization, requires the crtsh driver")
+	flag.StringVar(&config.inputPath, "i", "", "read seed domains from this file, or - for stdin, one per line, skipping blank lines and lines starting with #")
+	flag.BoolVar(&config.streamInput, "stream-input", false, "also read seed domains from stdin, one per line, adding each to the search as it arrives until stdin is closed")
 	flag.BoolVar(&config.includeCTSubdomains, "ct-subdomains", false, "include sub-domains in certificate transparency search")
 	flag.BoolVar(&config.includeCTExpired, "ct-expired", false, "include expired certificates in certificate transparency search")
 	flag.IntVar(&config.maxSANsSize, "sanscap", 80, "maximum number of uniq apex domains in certificate to include, 0 has no limit")
+	flag.IntVar(&config.maxSANsTotal, "max-sans-total", 0, "maximum number of distinct domains to add to the graph before expansion stops, 0 has no limit")
+	flag.IntVar(&config.limit, "limit", 0, "maximum number of domains to print, once reached while printing domains as they are found the crawl stops expanding, 0 has no limit")
+	flag.Uint64Var(&config.memLimit, "mem-limit", 0, "maximum heap size in MB before expansion stops, 0 has no limit")
+	flag.BoolVar(&config.requireValidSAN, "require-valid-san", false, "ignore certificate SANs that are not valid hostnames")
 	flag.BoolVar(&config.cdn, "cdn", false, "include certificates from CDNs")
 	flag.BoolVar(&config.checkDNS, "dns", false, "check for DNS records to determine if domain is registered")
+	flag.StringVar(&config.include, "include", "", "comma separated patterns of the domains to crawl, *.example.com for subdomains or a regular expression, root domains are always crawled")
+	flag.StringVar(&config.exclude, "exclude", "", "comma separated patterns of the domains not to crawl, *.example.com for subdomains or a regular expression, takes precedence over -include")
+	flag.BoolVar(&config.pruneDead, "prune-dead", false, "don't query or expand domains whose apex domain has no NS, CNAME, or address records")
+	flag.BoolVar(&config.rdap, "rdap", false, "look up the registrar and registrant organization of each domain's apex domain with RDAP")
+	flag.BoolVar(&config.allowPrivate, "allow-private", false, "also connect to domains that only resolve to private, loopback, link local, or reserved IP addresses, requires -resolve as domains are only checked when they are resolved")
+	flag.BoolVar(&config.resolve, "resolve", false, "resolve the IP addresses of every domain found, ignoring addresses from wildcard DNS records")
+	flag.StringVar(&config.tlsPolicyMin, "tls-policy-min", "", "check if the domains accept TLS versions below this minimum version, such as 1.2, requires a live driver")
+	flag.BoolVar(&config.checkCRL, "crl", false, "check the revocation status of certificates using their CRL distribution points")
+	flag.BoolVar(&config.firstParty, "first-party", false, "only crawl certificates that mostly belong to the apex domains of the root domains")
+	flag.Float64Var(&config.firstPartyThreshold, "first-party-threshold", 0.5, "minimum fraction of a certificate's apex domains that must be root apex domains for -first-party to crawl it")
 	flag.BoolVar(&config.apex, "apex", false, "for every domain found, add the apex domain of the domain's parent")
+	flag.BoolVar(&config.apexNewOnly, "apex-new-only", false, "only add the apex domain of a domain found with -apex if no other domains in the apex domain have been found")
+	flag.UintVar(&config.apexDepth, "apex-depth", 0, "maximum BFS depth to add apex domains at with -apex, 0 has no limit")
 	flag.BoolVar(&config.updatePSL, "updatepsl", false, "Update the default Public Suffix List")
+	flag.BoolVar(&config.profileSeeds, "profile-seeds", false, "only query the -profile-hosts of each seed's apex domain and print their certificates, without crawling")
+	flag.StringVar(&config.profileHosts, "profile-hosts", "@,www,mail", "comma separated hostnames to query in each seed's apex domain with -profile-seeds, @ is the apex domain itself")
 	flag.UintVar(&config.maxDepth, "depth", 5, "maximum BFS depth to go")
+	flag.UintVar(&config.seedDepth, "seed-depth", 0, "depth to start the root domains at, counts towards -depth")
 	flag.UintVar(&config.parallel, "parallel", 10, "number of certificates to retrieve in parallel")
+	flag.UintVar(&config.parallelRoots, "parallel-roots", 0, "maximum number of seeds read with -i or -stream-input that are queued or being visited at once, 0 is the same as -parallel")
 	flag.BoolVar(&config.details, "details", false, "print details about the domains crawled")
+	flag.StringVar(&config.sortBy, "sort-by", "", fmt.Sprintf("print the domains sorted by this key once the search completes instead of as they are found [%s]", strings.Join(graph.DomainSortKeys, ", ")))
 	flag.BoolVar(&config.printJSON, "json", false, "print the graph as json, can be used for graph in web UI")
+	flag.BoolVar(&config.printDOT, "dot", false, "print the graph in GraphViz DOT format, same as -format dot")
+	flag.StringVar(&config.format, "format", "", fmt.Sprintf("print the graph in this format once the search completes [%s]", strings.Join(outputFormatNames(), ", ")))
+	flag.IntVar(&config.mermaidMaxNodes, "mermaid-max-nodes", 300, "maximum number of nodes in the mermaid graph, nodes furthest from the root domains are dropped first, 0 has no limit")
+	flag.BoolVar(&config.directed, "directed", false, "link domains in the direction they were discovered in, from each domain to the domains found from it, in the graph formats that support it")
+	flag.BoolVar(&config.collapseRenewals, "collapse-renewals", false, "collapse renewed certificates with the same SANs, issuer, and key into the latest one in the output")
+	flag.StringVar(&config.importPath, "import", "", "print the graph saved in this gob file by -format gob instead of crawling")
+	flag.StringVar(&config.diffAgainst, "diff-against", "", "only output the domains and certificates not found in this prior json graph")
+	flag.BoolVar(&config.jsonCompact, "json-compact", false, "print the json graph without indentation, faster and smaller for large graphs")
+	flag.StringVar(&config.boltPath, "bolt", "", "store the graph in this BoltDB file instead of memory for graphs too large to fit in RAM, the file is overwritten")
+	flag.StringVar(&config.tracePath, "trace", "", "write a JSON lines log of every crawl event to this file, the file is overwritten")
 	flag.StringVar(&config.savePath, "save", "", "save certs to folder in PEM format")
+	flag.IntVar(&config.sharedCerts, "shared-certs", 0, "print a report of certificates found on at least this many domains, 0 disables the report")
+	flag.BoolVar(&config.expiredLive, "expired-live", false, "print a report of domains currently serving expired certificates, requires a live driver")
+	flag.Float64Var(&config.certSimilarity, "cert-similarity", 0, "print a report of certificate pairs whose SANs have a Jaccard similarity of at least this much, between 0 and 1, 0 disables the report")
+	flag.BoolVar(&config.groupBySubject, "group-by-subject", false, "print a report of the certificates and their domains grouped by their subject organization")
+	flag.BoolVar(&config.certAges, "cert-ages", false, "print a histogram of the certificates' ages and remaining lifetimes, included in the metadata instead with -format")
+	flag.IntVar(&config.certSimilarityMax, "cert-similarity-max", 10000, "maximum number of certificates to compare for -cert-similarity, 0 has no limit")
+	flag.BoolVar(&config.ipList, "ip-list", false, "print the distinct IP addresses the domains resolved to, one per line, requires -resolve")
+	flag.BoolVar(&config.ipListDomains, "ip-list-domains", false, "include the domains that resolved to each IP address in -ip-list")
 	flag.StringVar(&config.serve, "serve", "", "address:port to serve html UI on")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s: [OPTION]... HOST...\n\thttps://github.com/lanrat/certgraph\nOPTIONS:\n", os.Args[0])
 		flag.PrintDefaults()
 	}
-	flag.Parse()
-	config.timeout = time.Duration(timeoutSeconds) * time.Second
 }
 
 func main() {
+	parseFlags(os.Args[1:])
+	os.Exit(run())
+}
+
+// parseFlags parses the command line arguments into config
+func parseFlags(args []string) {
+	flag.CommandLine.Parse(args)
+	config.timeout = time.Duration(config.timeoutSeconds) * time.Second
+	config.maxResponseSize = int64(config.maxResponseMB) << 20
+}
+
+// run runs certgraph and returns the exit code
+func run() int {
 	// check for version flag
 	if config.printVersion {
 		fmt.Println(version())
-		return
+		return exitOK
 	}
 
 	if len(config.serve) > 0 {
 		err := web.Serve(config.serve)
 		e(err)
+		return exitError
+	}
+
+	// print usage if no domain passed
+	if flag.NArg() < 1 && len(config.org) == 0 && len(config.importPath) == 0 && !config.streamInput && len(config.inputPath) == 0 {
+		flag.Usage()
+		return exitUsage
+	}
+	if len(config.importPath) > 0 && (flag.NArg() > 0 || len(config.org) > 0 || len(config.inputPath) > 0) {
+		fmt.Fprintln(os.Stderr, "-import can not be used with domains to crawl")
+		return exitUsage
+	}
+	// the first party scope and profiles need every seed before the search starts
+	if config.streamInput && (len(config.importPath) > 0 || config.firstParty || config.profileSeeds) {
+		fmt.Fprintln(os.Stderr, "-stream-input can not be used with -import, -first-party, or -profile-seeds")
+		return exitUsage
+	}
+	if len(config.inputPath) > 0 && config.streamInput {
+		fmt.Fprintln(os.Stderr, "-i can not be used with -stream-input")
+		return exitUsage
+	}
+
+	// cant run on 0 threads
+	if config.parallel < 1 {
+		fmt.Fprintln(os.Stderr, "Must enter a positive number of parallel threads")
+		flag.Usage()
+		return exitUsage
+	}
+
+	// check the scope patterns before crawling
+	if scope, err := dns.NewScope(config.include, config.exclude); err != nil {
+		fmt.Fprintln(os.Stderr, "-"+err.Error())
+		return exitUsage
+	} else if !scope.Empty() {
+		crawlScope = scope
+	}
+
+	// -json is the same as -format json
+	if config.printJSON {
+		if len(config.format) > 0 && config.format != "json" {
+			fmt.Fprintln(os.Stderr, "-json can not be used with -format", config.format)
+			return exitUsage
+		}
+		config.format = "json"
+	}
+	// -dot is the same as -format dot
+	if config.printDOT {
+		if config.printJSON {
+			fmt.Fprintln(os.Stderr, "-dot can not be used with -json")
+			return exitUsage
+		}
+		if len(config.format) > 0 && config.format != "dot" {
+			fmt.Fprintln(os.Stderr, "-dot can not be used with -format", config.format)
+			return exitUsage
+		}
+		config.format = "dot"
+	}
+	if _, ok := outputFormats[config.format]; len(config.format) > 0 && !ok {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", config.format)
+		return exitUsage
+	}
+
+	if len(config.sortBy) > 0 {
+		err := graph.SortDomains(nil, config.sortBy)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+
+	// reports are printed to stdout, so they can't be mixed with the graph output
+	if len(config.format) > 0 && reportMode() {
+		fmt.Fprintln(os.Stderr, "reports can not be used with -format", config.format)
+		return exitUsage
+	}
+	if config.limit < 0 {
+		fmt.Fprintln(os.Stderr, "-limit can not be negative")
+		return exitUsage
+	}
+	if config.limit > 0 && (len(config.format) > 0 || reportMode() || config.profileSeeds) {
+		fmt.Fprintln(os.Stderr, "-limit only limits the domains printed, it can not be used with -format, reports, or -profile-seeds")
+		return exitUsage
+	}
+	if config.ipList && !config.resolve {
+		fmt.Fprintln(os.Stderr, "-ip-list requires -resolve")
+		return exitUsage
+	}
+	if config.allowPrivate && !config.resolve {
+		fmt.Fprintln(os.Stderr, "-allow-private requires -resolve, domains are only checked for private IP addresses when they are resolved")
+		return exitUsage
+	}
+	if config.ipListDomains && !config.ipList {
+		fmt.Fprintln(os.Stderr, "-ip-list-domains requires -ip-list")
+		return exitUsage
+	}
+	if config.firstPartyThreshold < 0 || config.firstPartyThreshold > 1 {
+		fmt.Fprintln(os.Stderr, "-first-party-threshold must be between 0 and 1")
+		return exitUsage
+	}
+	if config.certSimilarity < 0 || config.certSimilarity > 1 {
+		fmt.Fprintln(os.Stderr, "-cert-similarity must be between 0 and 1")
+		return exitUsage
+	}
+
+	// load the rules routing domains to other drivers
+	if len(config.driverRules) > 0 {
+		var err error
+		driverRules, err = driver.LoadRules(config.driverRules)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+	for _, crawlDriver := range crawlDrivers() {
+		if config.expiredLive && !isLiveDriver(crawlDriver) {
+			fmt.Fprintf(os.Stderr, "-expired-live requires a live driver, the %s driver does not connect to the domains\n", crawlDriver)
+			return exitUsage
+		}
+		if len(config.tlsPolicyMin) > 0 && !isLiveDriver(crawlDriver) {
+			fmt.Fprintf(os.Stderr, "-tls-policy-min requires a live driver, the %s driver does not connect to the domains\n", crawlDriver)
+			return exitUsage
+		}
+	}
+	if len(config.tlsPolicyMin) > 0 {
+		var err error
+		tlsPolicyMin, err = driver.ParseTLSVersion(config.tlsPolicyMin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+
+	// load the prior graph to compare against
+	if len(config.diffAgainst) > 0 {
+		err := loadPriorGraph(config.diffAgainst)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+
+	// update the public suffix list if required
+	if config.updatePSL {
+		err := dns.UpdatePublicSuffixList(config.timeout)
+		if err != nil {
+			e(err)
+			return exitError
+		}
+	}
+
+	// connect to the jump host for the live drivers to tunnel through
+	if len(config.sshJump) > 0 {
+		client, err := tunnel.SSH(config.sshJump, config.sshKey, config.sshKnownHosts, config.timeout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "unable to set up SSH tunnel:", err)
+			return exitError
+		}
+		defer client.Close()
+		v("Tunneling connections through", config.sshJump)
+		driver.SetDial(client.Dial)
+	}
+
+	// print a previously saved graph instead of crawling
+	if len(config.importPath) > 0 {
+		metadata, err := importGraph(config.importPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		importedMetadata = metadata
+		v("Imported", certGraph.NumDomains(), "domains from", config.importPath)
+		printResults()
+		return exitCode(false, false)
+	}
+
+	// set driver
+	driver.SetMaxConnsPerHost(config.maxConnsPerHost)
+	retryBudget = driver.NewRetryBudget(int64(config.retryBudget), func() {
+		v("Retry budget of", config.retryBudget, "retries used up, no longer retrying failed queries")
+	})
+	err := setDriver(config.driver)
+	defer closeBatchers()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitDriver
+	}
+
+	// stop the organization search or the crawl early on an interrupt, printing the partial results of the crawl
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer func() {
+		signal.Stop(interrupts)
+		close(interrupts)
+	}()
+	go handleInterrupt(interrupts, cancel)
+
+	// add domains passed to startDomains
+	startDomains := make([]string, 0, 1)
+	for _, domain := range flag.Args() {
+		seeds, err := seedDomains(ctx, domain)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			if ctx.Err() != nil {
+				return exitCancelled
+			}
+			return exitError
+		}
+		startDomains = append(startDomains, seeds...)
+	}
+
+	// add domains read from the input file, streamed into the search as they are read
+	// unless the first party scope or profiles need every seed before the search starts
+	var input io.Reader
+	if config.streamInput {
+		input = os.Stdin
+	}
+	if len(config.inputPath) > 0 {
+		f, err := openInput(config.inputPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		if config.firstParty || config.profileSeeds {
+			inputDomains, err := readInput(f, config.inputPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+			for _, domain := range inputDomains {
+				seeds, err := seedDomains(ctx, domain)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					if ctx.Err() != nil {
+						return exitCancelled
+					}
+					return exitError
+				}
+				startDomains = append(startDomains, seeds...)
+			}
+		} else {
+			input = f
+		}
+	}
+
+	// add domains found in certificates issued to the organization
+	if len(config.org) > 0 {
+		orgDomains, err := organizationDomains(ctx, config.org)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			if ctx.Err() != nil {
+				return exitCancelled
+			}
+			return exitError
+		}
+		for _, domain := range orgDomains {
+			seeds, err := seedDomains(ctx, domain)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				if ctx.Err() != nil {
+					return exitCancelled
+				}
+				return exitError
+			}
+			startDomains = append(startDomains, seeds...)
+		}
+	}
+
+	// the first party scope is inferred from the seeds
+	if config.firstParty {
+		seedApexes = make(map[string]bool)
+		for _, domain := range startDomains {
+			apexDomain, err := dns.ApexDomain(domain)
+			if err == nil {
+				seedApexes[apexDomain] = true
+			}
+		}
+		v("First party apex domains:", len(seedApexes))
+	}
+
+	// setup wildcard DNS detection
+	if config.resolve {
+		wildcardDetector = dns.NewWildcardDetector(config.timeout)
+	}
+
+	// setup registration lookups
+	if config.rdap {
+		rdapClient = rdap.NewClient(config.timeout, config.maxResponseSize)
+	}
+
+	// share the crawl's parallelism between the certificate lookups of every domain visited
+	certQuerySlots = make(chan bool, config.parallel)
+
+	// setup revocation checking
+	if config.checkCRL {
+		crlChecker = revocation.NewCRLChecker(config.timeout, config.maxResponseSize)
+	}
+
+	// create the output directory if it does not exist
+	if len(config.savePath) > 0 {
+		err := os.MkdirAll(config.savePath, 0777)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+
+	// store the graph on disk if requested
+	if len(config.boltPath) > 0 {
+		store, err := graph.NewBoltStore(config.boltPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer func() {
+			err := store.Close()
+			if err != nil {
+				e("BoltDB:", err)
+			}
+		}()
+		certGraph = graph.NewCertGraphWithStore(store)
+	}
+
+	// record the crawl events if requested
+	if len(config.tracePath) > 0 {
+		tracer, err = trace.Create(config.tracePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+
+	// pause and resume the crawl on pauseSignal
+	if pauseSignal != nil {
+		pauses := make(chan os.Signal, 1)
+		signal.Notify(pauses, pauseSignal)
+		handled := make(chan struct{})
+		go func() {
+			handlePauseSignal(pauses)
+			close(handled)
+		}()
+		defer func() {
+			signal.Stop(pauses)
+			close(pauses)
+			<-handled
+		}()
+	}
+
+	// only query the canonical hostnames of each seed
+	if config.profileSeeds {
+		profiles := profileSeeds(ctx, startDomains)
+		err = tracer.Close()
+		if err != nil {
+			e("Trace:", err)
+		}
+		if len(config.format) == 0 && !reportMode() && priorGraph == nil {
+			printProfiles(profiles)
+		}
+		printResults()
+		return exitCode(false, ctx.Err() != nil)
+	}
+
+	// perform breath-first-search on the graph
+	partial := breathFirstSearch(ctx, startDomains, input)
+
+	err = tracer.Close()
+	if err != nil {
+		e("Trace:", err)
+	}
+
+	printResults()
+	return exitCode(partial, ctx.Err() != nil)
+}
+
+// printResults prints the graph output and reports once the graph is complete
+func printResults() {
+	if config.collapseRenewals {
+		var collapsed int
+		certGraph, collapsed = certGraph.CollapseRenewals()
+		v("Collapsed", collapsed, "renewed certificates")
+	}
+
+	// print the graph output
+	if priorGraph != nil {
+		printDelta()
+	} else if len(config.format) > 0 {
+		printGraph(certGraph, generateGraphMetadata())
+	} else if (len(config.sortBy) > 0 || importedMetadata != nil) && !reportMode() {
+		for _, domainNode := range sortedDomains(certGraph) {
+			printNode(domainNode)
+		}
+	}
+
+	// print the reports
+	if config.sharedCerts > 0 {
+		printSharedCerts()
+	}
+	if config.expiredLive {
+		printExpiredLive()
+	}
+	if config.certSimilarity > 0 {
+		printCertSimilarity()
+	}
+	if config.ipList {
+		printIPList()
+	}
+	if config.certAges && len(config.format) == 0 {
+		printCertAges()
+	}
+	if config.groupBySubject {
+		printSubjectGroups()
+	}
+
+	v("Found", certGraph.NumDomains(), "domains")
+	v("Graph Depth:", certGraph.DomainDepth())
+	for _, health := range driverHealthOrder {
+		v("Driver health", health)
+	}
+	if config.retries > 0 {
+		v("Retries:", retryBudget)
+	}
+}
+
+// importGraph loads the gob graph in file into the graph and returns its metadata
+func importGraph(file string) (map[string]interface{}, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	metadata, err := certGraph.ReadGob(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to import %s: %w", file, err)
+	}
+	return metadata, nil
+}
+
+// exitCode returns the exit code for the completed crawl
+// an interrupted crawl is reported as cancelled even if it found nothing, as it did not get to query every seed
+func exitCode(partial, cancelled bool) int {
+	if cancelled {
+		return exitCancelled
+	}
+	roots := 0
+	for _, domainNode := range certGraph.Domains() {
+		if domainNode.Root {
+			roots++
+		}
+	}
+	if roots > 0 && int(atomic.LoadInt32(&failedSeeds)) >= roots {
+		return exitSeedsFailed
+	}
+	if certGraph.NumCerts() == 0 {
+		return exitNoResults
+	}
+	if partial {
+		return exitPartial
+	}
+	return exitOK
+}
+
+// setDriver sets the driver variable for the provided driver string and does any necessary driver prep work
+// along with the drivers used by -driver-rules
+func setDriver(name string) error {
+	var err error
+	certDriver, err = newDriver(name, config.includeCTSubdomains)
+	if err != nil {
+		return err
+	}
+	queryDriver = newQueryDriver(name, certDriver)
+	if driverRules != nil {
+		routedDrivers = make(map[string]driver.Driver)
+		for _, ruleDriver := range driverRules.Drivers() {
+			if ruleDriver == name {
+				routedDrivers[ruleDriver] = queryDriver
+				continue
+			}
+			d, err := newDriver(ruleDriver, config.includeCTSubdomains)
+			if err != nil {
+				return fmt.Errorf("%s: %w", ruleDriver, err)
+			}
+			routedDrivers[ruleDriver] = newQueryDriver(ruleDriver, d)
+		}
+	}
+	for _, key := range config.driverOptions.Unused() {
+		e("Warning: the", name, "driver does not support the driver option", key)
+	}
+	return nil
+}
+
+// newQueryDriver returns the driver used to query domains with the named driver d
+// batching the queries if d supports it, tracking their health, and retrying them with -retries
+func newQueryDriver(name string, d driver.Driver) driver.Driver {
+	if batchDriver, ok := d.(driver.BatchDriver); ok && batchDriver.BatchSize() > 1 {
+		v("Batching up to", batchDriver.BatchSize(), "domains per", name, "query")
+		batcher := driver.NewBatcher(batchDriver, batchWait)
+		batchers = append(batchers, batcher)
+		d = batcher
+	}
+	d = monitorDriver(name, d)
+	if config.retries > 0 {
+		d = driver.Retry(d, config.retries, retryBudget, func(domain string, wait time.Duration, err error) {
+			v("Retrying", domain, "in", wait, err)
+		})
+	}
+	return d
+}
+
+// closeBatchers stops the batching drivers created by newQueryDriver
+func closeBatchers() {
+	for _, batcher := range batchers {
+		batcher.Close()
+	}
+	batchers = nil
+}
+
+// driverFor returns the driver to query the domain with, as routed by -driver-rules,
+// along with the name to record as the driver that found the domain's certificates
+func driverFor(domain string) (driver.Driver, string) {
+	if driverRules != nil {
+		if name, ok := driverRules.Match(domain); ok {
+			return routedDrivers[name], name
+		}
+	}
+	return queryDriver, certDriver.GetName()
+}
+
+// crawlDrivers returns the driver strings of every driver that may be used to query the domains
+func crawlDrivers() []string {
+	drivers := []string{config.driver}
+	if driverRules != nil {
+		drivers = append(drivers, driverRules.Drivers()...)
+	}
+	return drivers
+}
+
+// monitorDriver returns the driver d with its queries tracked by the Health for name
+// composite drivers are returned as is, as each of their children are monitored by newDriver
+func monitorDriver(name string, d driver.Driver) driver.Driver {
+	if strings.Contains(name, ",") {
+		return d
+	}
+	return driver.MonitorHealth(d, healthFor(name))
+}
+
+// healthFor returns the Health used to track queries made to the named driver
+func healthFor(name string) *driver.Health {
+	health, found := driverHealth[name]
+	if !found {
+		health = driver.NewHealth(name)
+		driverHealth[name] = health
+		driverHealthOrder = append(driverHealthOrder, health)
+	}
+	return health
+}
+
+// newDriver returns a new instance of the driver for the provided driver string
+// a comma separated list of drivers returns a driver that merges the results of all of them,
+// each limited to its own rate driver option
+// includeCTSubdomains is only used by certificate transparency drivers
+func newDriver(name string, includeCTSubdomains bool) (driver.Driver, error) {
+	names := strings.Split(name, ",")
+	if len(names) == 1 {
+		return newSingleDriver(name, includeCTSubdomains, config.driverOptions.Sub(name))
+	}
+	drivers := make([]driver.Driver, 0, len(names))
+	for _, childName := range names {
+		opts := config.driverOptions.Sub(childName)
+		child, err := newSingleDriver(childName, includeCTSubdomains, opts)
+		if err != nil {
+			return nil, err
+		}
+		rate, err := opts.Float("rate", 0)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", childName, err)
+		}
+		if rate > 0 {
+			childName := childName
+			child = driver.RateLimit(child, rate, func(wait time.Duration) {
+				v("Throttling", childName, "driver for", wait)
+			})
+		}
+		child = driver.MonitorHealth(child, healthFor(childName))
+		drivers = append(drivers, child)
+	}
+	return multi.Driver(drivers)
+}
+
+// newSingleDriver returns a new instance of the driver for the provided driver name using the driver options opts
+// it is a variable so tests can add their own drivers
+var newSingleDriver = singleDriver
+
+// singleDriver returns a new instance of the driver for the provided driver name using the driver options opts
+func singleDriver(name string, includeCTSubdomains bool, opts *driver.Options) (driver.Driver, error) {
+	switch name {
+	case "google":
+		return google.Driver(config.savePath, includeCTSubdomains, config.includeCTExpired, config.maxResponseSize, opts)
+	case "censys":
+		return censys.Driver(config.timeout, config.savePath, includeCTSubdomains, config.includeCTExpired, config.maxResponseSize, opts)
+	case "certspotter":
+		return certspotter.Driver(config.timeout, config.savePath, includeCTSubdomains, config.includeCTExpired, config.maxResponseSize, opts)
+	case "crtsh":
+		return crtsh.Driver(config.timeout, config.savePath, includeCTSubdomains, config.includeCTExpired, opts)
+	case "http":
+		return http.Driver(config.timeout, config.savePath, opts)
+	case "smtp":
+		return smtp.Driver(config.timeout, config.savePath, opts)
+	case "feed":
+		return feed.Driver(config.feed, config.timeout, config.savePath, config.maxResponseSize, opts)
+	}
+	return nil, fmt.Errorf("unknown driver name: %s", name)
+}
+
+// seedDomains returns the root domains to start the search with for the input domain
+// cancelling ctx aborts the search for the subdomains of a wildcard seed
+func seedDomains(ctx context.Context, input string) ([]string, error) {
+	seeds := make([]string, 0, 1)
+	d := strings.ToLower(input)
+	if len(d) == 0 {
+		return seeds, nil
+	}
+	if strings.HasPrefix(d, "*.") {
+		// wildcard seeds are expanded to all of the known subdomains
+		d = cleanInput(strings.TrimPrefix(d, "*."))
+		subdomains, err := wildcardSubdomains(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		v("Found", len(subdomains), "subdomains for wildcard seed", input)
+		seeds = append(seeds, subdomains...)
+	} else {
+		seeds = append(seeds, cleanInput(d))
+	}
+	if config.apex {
+		apexDomain, err := dns.ApexDomain(d)
+		if err == nil {
+			seeds = append(seeds, apexDomain)
+		}
+	}
+	return seeds, nil
+}
+
+// openInput opens the -i file, or returns stdin if file is -
+func openInput(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(file)
+}
+
+// scanSeeds calls f with each line of r until f returns false
+// blank lines and lines starting with # are skipped
+func scanSeeds(r io.Reader, f func(line string) bool) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !f(line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// readInput returns every seed domain read from r, one per line
+func readInput(r io.Reader, name string) ([]string, error) {
+	domains := make([]string, 0, 1)
+	err := scanSeeds(r, func(line string) bool {
+		domains = append(domains, line)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", name, err)
+	}
+	return domains, nil
+}
+
+// organizationDomains returns the domains found in certificates issued to the organization
+// only supported by drivers implementing driver.OrganizationDriver
+func organizationDomains(ctx context.Context, org string) ([]string, error) {
+	orgDriver, ok := certDriver.(driver.OrganizationDriver)
+	if !ok {
+		return nil, fmt.Errorf("-org requires a driver that supports organization search, the %s driver does not", config.driver)
+	}
+	domains, err := orgDriver.QueryOrganization(ctx, org, orgSearchLimit)
+	if err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains found for organization %q", org)
+	}
+	if len(domains) >= orgSearchLimit {
+		e("Warning: organization search for", fmt.Sprintf("%q", org), "reached the limit of", orgSearchLimit, "domains, results are incomplete")
+	}
+	v("Found", len(domains), "domains for organization", org)
+
+	// wildcards are not expanded for organization results
+	for i := range domains {
+		domains[i] = strings.TrimPrefix(domains[i], "*.")
+	}
+	return domains, nil
+}
+
+// isLiveDriver returns true if every driver in the driver string gets certificates by connecting to the domains
+func isLiveDriver(driver string) bool {
+	for _, name := range strings.Split(driver, ",") {
+		switch name {
+		case "http", "smtp":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isCTDriver returns true if every driver in the driver string searches certificate transparency logs
+func isCTDriver(driver string) bool {
+	for _, name := range strings.Split(driver, ",") {
+		switch name {
+		case "google", "crtsh", "censys", "certspotter":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// wildcardSubdomains searches certificate transparency logs for all of the subdomains of domain
+// only supported by certificate transparency drivers, cancelling ctx aborts the search
+func wildcardSubdomains(ctx context.Context, domain string) ([]string, error) {
+	if !isCTDriver(config.driver) {
+		return nil, fmt.Errorf("wildcard seed *.%s requires a certificate transparency driver, the %s driver can not query a wildcard host", domain, config.driver)
+	}
+	ctDriver, err := newDriver(config.driver, true)
+	if err != nil {
+		return nil, err
+	}
+	ctDriver = monitorDriver(config.driver, ctDriver)
+	results, err := ctDriver.QueryDomain(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	fingerprintMap, err := results.GetFingerprints()
+	if err != nil {
+		return nil, err
+	}
+
+	subdomainMap := make(map[string]bool)
+	for _, fingerprints := range fingerprintMap {
+		for _, fp := range fingerprints {
+			certResult, err := results.QueryCert(fp)
+			if err != nil {
+				v("QueryCert", err)
+				continue
+			}
+			for _, certDomain := range certResult.Domains {
+				certDomain = strings.TrimPrefix(strings.ToLower(certDomain), "*.")
+				if strings.HasSuffix(certDomain, "."+domain) {
+					subdomainMap[certDomain] = true
+				}
+			}
+		}
+	}
+
+	subdomains := make([]string, 0, len(subdomainMap))
+	for subdomain := range subdomainMap {
+		subdomains = append(subdomains, subdomain)
+	}
+	sort.Strings(subdomains)
+	return subdomains, nil
+}
+
+// verbose logging
+func v(a ...interface{}) {
+	if config.verbose {
+		e(a...)
+	}
+}
+
+// vErr logs err with -verbose, unless it is an expected network error and -quiet-errors is set
+func vErr(a ...interface{}) {
+	if config.quietErrors {
+		if err, ok := a[len(a)-1].(error); ok && status.Transient(err) {
+			return
+		}
+	}
+	v(a...)
+}
+
+func e(a ...interface{}) {
+	if a != nil {
+		fmt.Fprintln(os.Stderr, a...)
+	}
+}
+
+// outputFormatNames returns the sorted names of the output formats
+func outputFormatNames() []string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// prints the graph to stdout in the selected output format
+func printGraph(g *graph.CertGraph, metadata map[string]interface{}) {
+	err := outputFormats[config.format](os.Stdout, g, metadata)
+	if err != nil {
+		e(err)
+	}
+}
+
+// writes the graph as a json object, indented unless compact json was requested
+func writeJSONGraph(w io.Writer, g *graph.CertGraph, metadata map[string]interface{}) error {
+	jsonGraph := g.GenerateMap()
+	jsonGraph["certgraph"] = metadata
+	var j []byte
+	var err error
+	if config.jsonCompact {
+		j, err = json.Marshal(jsonGraph)
+	} else {
+		j, err = json.MarshalIndent(jsonGraph, "", "\t")
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(j))
+	return err
+}
+
+// writes the graph as a mermaid diagram, warning if it was too large to include every node
+func writeMermaidGraph(w io.Writer, g *graph.CertGraph, metadata map[string]interface{}) error {
+	omitted, err := g.GenerateMermaid(w, config.mermaidMaxNodes, config.directed)
+	if omitted > 0 {
+		e("Warning: mermaid graph limited to", config.mermaidMaxNodes, "nodes,", omitted, "nodes omitted")
+	}
+	return err
+}
+
+// writes the graph as a GraphViz DOT graph
+func writeDOTGraph(w io.Writer, g *graph.CertGraph, metadata map[string]interface{}) error {
+	return g.GenerateDOT(w, config.directed)
+}
+
+// writeGobGraph writes the graph in the compact gob format that can be loaded with -import
+func writeGobGraph(w io.Writer, g *graph.CertGraph, metadata map[string]interface{}) error {
+	return g.WriteGob(w, metadata)
+}
+
+// loadPriorGraph loads the json graph in file to compare against
+func loadPriorGraph(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if graph.IsGob(r) {
+		prior := graph.NewCertGraph()
+		_, err = prior.ReadGob(r)
+		if err != nil {
+			return fmt.Errorf("unable to load %s: %w", file, err)
+		}
+		priorGraph = prior.Snapshot()
+		return nil
+	}
+	priorGraph, err = graph.LoadSnapshot(r)
+	if err != nil {
+		return fmt.Errorf("unable to load %s: %w", file, err)
+	}
+	return nil
+}
+
+// prints only the domains and certificates that are not in the prior graph,
+// along with the domains found in both whose status has changed
+func printDelta() {
+	delta, changes := certGraph.Delta(priorGraph)
+	if len(config.format) > 0 {
+		metadata := generateGraphMetadata()
+		metadata["delta"] = map[string]interface{}{
+			"against":        config.diffAgainst,
+			"status_changes": changes,
+		}
+		printGraph(delta, metadata)
+		return
+	}
+	for _, domainNode := range sortedDomains(delta) {
+		fmt.Fprint(os.Stdout, "+ ")
+		printNode(domainNode)
+	}
+	for _, change := range changes {
+		fmt.Fprintf(os.Stdout, "~ %s\t%s -> %s\n", change.Domain, change.Before, change.After)
+	}
+}
+
+// sortedDomains returns the domains in the graph sorted by -sort-by, by domain if it is not set
+// truncated to the first -limit domains
+func sortedDomains(g *graph.CertGraph) []*graph.DomainNode {
+	domainNodes := g.Domains()
+	if len(config.sortBy) > 0 {
+		// the sort key was validated when parsing the flags
+		_ = graph.SortDomains(domainNodes, config.sortBy)
+	}
+	if config.limit > 0 && len(domainNodes) > config.limit {
+		domainNodes = domainNodes[:config.limit]
+	}
+	return domainNodes
+}
+
+// prints the IP addresses the domains resolved to, along with the domains if requested
+func printIPList() {
+	for _, ip := range certGraph.IPs() {
+		if config.ipListDomains {
+			fmt.Fprintf(os.Stdout, "%s\t%s\n", ip.IP, strings.Join(ip.Domains, " "))
+		} else {
+			fmt.Fprintln(os.Stdout, ip.IP)
+		}
+	}
+}
+
+// prints the certificates found on multiple domains along with the domains they were found on
+func printSharedCerts() {
+	for _, shared := range certGraph.SharedCerts(config.sharedCerts) {
+		fmt.Fprintf(os.Stdout, "%s\t%d\n", shared.Cert.Fingerprint.HexString(), len(shared.Domains))
+		for _, domain := range shared.Domains {
+			fmt.Fprintf(os.Stdout, "\t%s\n", domain)
+		}
+	}
+}
+
+// prints the domains serving certificates that have expired, longest expired first
+func printExpiredLive() {
+	for _, expired := range certGraph.ExpiredDomains(time.Now()) {
+		fmt.Fprintf(os.Stdout, "%s\t%s\t%s\n", expired.Domain, expired.Cert.Fingerprint.HexString(), expired.Cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+}
+
+// prints the pairs of certificates with similar SANs, most similar first
+func printCertSimilarity() {
+	similar, err := certGraph.CertSimilarity(config.certSimilarity, config.certSimilarityMax)
+	if err != nil {
+		e("Warning: skipping -cert-similarity report:", err)
+		return
+	}
+	for _, pair := range similar {
+		fmt.Fprintf(os.Stdout, "%s\t%s\t%.3f\n", pair.A.Fingerprint.HexString(), pair.B.Fingerprint.HexString(), pair.Similarity)
+	}
+}
+
+// prints the certificates and their domains grouped by subject organization, largest groups first
+func printSubjectGroups() {
+	groups, withoutSubject := certGraph.GroupBySubject()
+	v("Certificates without a subject organization:", withoutSubject)
+	for _, group := range groups {
+		fmt.Fprintf(os.Stdout, "%s\t%d\n", group.Organization, len(group.Certs))
+		for _, certNode := range group.Certs {
+			fmt.Fprintf(os.Stdout, "\t%s\t%s\n", certNode.Fingerprint.HexString(), strings.Join(certNode.Domains, " "))
+		}
+	}
+}
+
+// prints the number of certificates in each age and remaining lifetime bucket, oldest and longest lived last
+func printCertAges() {
+	ages := certGraph.CertAges(time.Now())
+	for _, bucket := range ages.Age {
+		fmt.Fprintf(os.Stdout, "age\t%s\t%d\n", bucket.Label, bucket.Count)
+	}
+	for _, bucket := range ages.Remaining {
+		fmt.Fprintf(os.Stdout, "remaining\t%s\t%d\n", bucket.Label, bucket.Count)
+	}
+	if ages.Unknown > 0 {
+		fmt.Fprintf(os.Stdout, "unknown\t\t%d\n", ages.Unknown)
 	}
+}
 
-	// print usage if no domain passed
-	if flag.NArg() < 1 {
-		flag.Usage()
-		return
+// reportMode returns true if any reports have been requested
+// -cert-ages is only a report without -format, otherwise it is included in the graph metadata
+func reportMode() bool {
+	return config.sharedCerts > 0 || config.expiredLive || config.certSimilarity > 0 || config.ipList || config.groupBySubject || (config.certAges && len(config.format) == 0)
+}
+
+// streamOutput returns true if domains should be printed to stdout as they are found
+// other output modes, and sorted output, print their results once the search has completed
+func streamOutput() bool {
+	return len(config.format) == 0 && !reportMode() && priorGraph == nil && len(config.sortBy) == 0
+}
+
+// pauseGate blocks callers of wait while it is paused
+type pauseGate struct {
+	lock sync.Mutex
+	// resumed is closed when the gate is resumed, nil while it is not paused
+	resumed chan struct{}
+}
+
+// newPauseGate returns a new pauseGate that is not paused
+func newPauseGate() *pauseGate {
+	return new(pauseGate)
+}
+
+// toggle pauses the gate if it is running, or resumes it if it is paused
+// returns true if the gate is now paused
+func (p *pauseGate) toggle() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+		return true
 	}
+	close(p.resumed)
+	p.resumed = nil
+	return false
+}
 
-	// cant run on 0 threads
-	if config.parallel < 1 {
-		fmt.Fprintln(os.Stderr, "Must enter a positive number of parallel threads")
-		flag.Usage()
-		return
+// resume resumes the gate if it is paused
+func (p *pauseGate) resume() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
 	}
+}
 
-	// update the public suffix list if required
-	if config.updatePSL {
-		err := dns.UpdatePublicSuffixList(config.timeout)
-		if err != nil {
-			e(err)
+// wait returns once the gate is not paused, or ctx is done
+func (p *pauseGate) wait(ctx context.Context) {
+	for {
+		p.lock.Lock()
+		resumed := p.resumed
+		p.lock.Unlock()
+		if resumed == nil {
+			return
+		}
+		select {
+		case <-resumed:
+		case <-ctx.Done():
 			return
 		}
 	}
+}
 
-	// add domains passed to startDomains
-	startDomains := make([]string, 0, 1)
-	for _, domain := range flag.Args() {
-		d := strings.ToLower(domain)
-		if len(d) > 0 {
-			startDomains = append(startDomains, cleanInput(d))
-			if config.apex {
-				apexDomain, err := dns.ApexDomain(domain)
-				if err != nil {
-					continue
-				}
-				startDomains = append(startDomains, apexDomain)
-			}
+// handlePauseSignal toggles pausing the crawl every time pauseSignal is received
+// returns once signals is closed
+func handlePauseSignal(signals <-chan os.Signal) {
+	for range signals {
+		if crawlPause.toggle() {
+			e("Crawl paused, queries in progress will finish, send SIGUSR1 again to resume")
+		} else {
+			e("Crawl resumed")
 		}
 	}
+}
 
-	// set driver
-	err := setDriver(config.driver)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+// handleInterrupt cancels the crawl the first time an interrupt is received so the partial results are printed
+// a paused crawl is resumed so it can finish, and a second interrupt exits immediately
+// returns once signals is closed
+func handleInterrupt(signals <-chan os.Signal, cancel context.CancelFunc) {
+	if _, ok := <-signals; !ok {
+		return
+	}
+	e("Interrupted, finishing the queries in progress and printing the partial results, interrupt again to exit immediately")
+	cancel()
+	crawlPause.resume()
+	if _, ok := <-signals; !ok {
 		return
 	}
+	os.Exit(exitInterrupted)
+}
 
-	// create the output directory if it does not exist
-	if len(config.savePath) > 0 {
-		err := os.MkdirAll(config.savePath, 0777)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+// monitorMemory checks the heap size every memCheckInterval until done is closed
+// once the heap exceeds -mem-limit, memoryLimited is set so the search stops adding domains to the graph
+func monitorMemory(done chan bool) {
+	limit := config.memLimit << 20
+	ticker := time.NewTicker(memCheckInterval)
+	defer ticker.Stop()
+	var stats runtime.MemStats
+	for checks := 1; ; checks++ {
+		select {
+		case <-done:
 			return
+		case <-ticker.C:
+		}
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > limit {
+			// the heap may be mostly garbage, only stop if it is still over the limit once collected
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+		}
+		if stats.HeapAlloc > limit {
+			atomic.StoreInt32(&memoryLimited, 1)
+			e("Memory limit reached with a", stats.HeapAlloc>>20, "MB heap and", certGraph.NumDomains(), "domains, no longer expanding graph")
+			return
+		}
+		if checks%memReportChecks == 0 {
+			v("Memory:", stats.HeapAlloc>>20, "MB heap of", config.memLimit, "MB limit,", certGraph.NumDomains(), "domains")
 		}
 	}
-
-	// perform breath-first-search on the graph
-	breathFirstSearch(startDomains)
-
-	// print the json output
-	if config.printJSON {
-		printJSONGraph()
-	}
-
-	v("Found", certGraph.NumDomains(), "domains")
-	v("Graph Depth:", certGraph.DomainDepth())
 }
 
-// setDriver sets the driver variable for the provided driver string and does any necessary driver prep work
-// TODO make config generic and move this to driver module
-// TODO support multi-driver
-func setDriver(driver string) error {
-	var err error
-	switch driver {
-	case "google":
-		certDriver, err = google.Driver(50, config.savePath, config.includeCTSubdomains, config.includeCTExpired)
-	case "crtsh":
-		certDriver, err = crtsh.Driver(1000, config.timeout, config.savePath, config.includeCTSubdomains, config.includeCTExpired)
-	case "http":
-		certDriver, err = http.Driver(config.timeout, config.savePath)
-	case "smtp":
-		certDriver, err = smtp.Driver(config.timeout, config.savePath)
-	default:
-		return fmt.Errorf("unknown driver name: %s", config.driver)
-	}
-	return err
+// seedProfile is the hostnames queried for a seed's apex domain by -profile-seeds
+type seedProfile struct {
+	apex  string
+	hosts []*graph.DomainNode
 }
 
-// verbose logging
-func v(a ...interface{}) {
-	if config.verbose {
-		e(a...)
+// profileSeeds queries the -profile-hosts of the apex domain of every seed without expanding the graph
+// returns the profile of each distinct apex domain in the order of the seeds
+func profileSeeds(ctx context.Context, seeds []string) []seedProfile {
+	profiles := make([]seedProfile, 0, len(seeds))
+	seenApexes := make(map[string]bool)
+	for _, seed := range seeds {
+		apexDomain, err := dns.ApexDomain(seed)
+		if err != nil {
+			apexDomain = seed
+		}
+		if seenApexes[apexDomain] {
+			continue
+		}
+		seenApexes[apexDomain] = true
+		profile := seedProfile{apex: apexDomain}
+		for _, host := range strings.Split(config.profileHosts, ",") {
+			host = strings.TrimSpace(host)
+			domain := apexDomain
+			if host != "@" {
+				domain = host + "." + apexDomain
+			}
+			if _, found := certGraph.GetDomain(domain); found || len(host) == 0 {
+				continue
+			}
+			domainNode := graph.NewDomainNode(domain, config.seedDepth)
+			domainNode.Root = true
+			certGraph.AddDomain(domainNode)
+			tracer.Record(trace.Event{Type: trace.Seed, Domain: domainNode.Domain, Depth: domainNode.Depth, Reason: "profile"})
+			profile.hosts = append(profile.hosts, domainNode)
+		}
+		profiles = append(profiles, profile)
 	}
-}
 
-func e(a ...interface{}) {
-	if a != nil {
-		fmt.Fprintln(os.Stderr, a...)
+	// query the hosts with the same parallelism as a crawl
+	var wg sync.WaitGroup
+	threadPass := make(chan bool, config.parallel)
+	for _, profile := range profiles {
+		for _, domainNode := range profile.hosts {
+			wg.Add(1)
+			threadPass <- true
+			go func(domainNode *graph.DomainNode) {
+				defer wg.Done()
+				defer func() { <-threadPass }()
+				v("Visiting", domainNode.Depth, domainNode.Domain)
+				safeVisit(ctx, domainNode)
+				certGraph.UpdateDomain(domainNode)
+				tracer.Record(trace.Event{Type: trace.Visited, Domain: domainNode.Domain, Depth: domainNode.Depth, Status: domainNode.Status.String()})
+			}(domainNode)
+		}
 	}
+	wg.Wait()
+	return profiles
 }
 
-// prints the graph as a json object
-func printJSONGraph() {
-	jsonGraph := certGraph.GenerateMap()
-	jsonGraph["certgraph"] = generateGraphMetadata()
-
-	j, err := json.MarshalIndent(jsonGraph, "", "\t")
-	if err != nil {
-		fmt.Println(err)
-		return
+// printProfiles prints each seed's apex domain followed by the status and certificates of its profile hostnames
+func printProfiles(profiles []seedProfile) {
+	for _, profile := range profiles {
+		fmt.Fprintln(os.Stdout, profile.apex)
+		for _, domainNode := range profile.hosts {
+			fingerprints := domainNode.GetCertificates()
+			if len(fingerprints) == 0 {
+				fmt.Fprintf(os.Stdout, "\t%s\t%s\n", domainNode.Domain, domainNode.Status.String())
+				continue
+			}
+			sort.Slice(fingerprints, func(i, j int) bool {
+				return fingerprints[i].HexString() < fingerprints[j].HexString()
+			})
+			for _, fp := range fingerprints {
+				certNode, found := certGraph.GetCert(fp)
+				if !found {
+					continue
+				}
+				fmt.Fprintf(os.Stdout, "\t%s\t%s\t%s\t%s\t%s\n", domainNode.Domain, domainNode.Status.String(), fp.HexString(), certNode.ValidationLevel(), certNode.NotAfter.Format("2006-01-02"))
+			}
+		}
 	}
-	fmt.Println(string(j))
 }
 
 // breathFirstSearch perform Breadth first search to build the graph
-func breathFirstSearch(roots []string) {
+// if input is not nil, seeds read from it one per line are also added as roots until it is closed, skipping lines starting with #
+// cancelling ctx stops the search from adding domains to the graph, the domains already being visited finish
+// returns true if the search stopped expanding the graph early because it reached the -max-sans-total, -mem-limit, or -limit limit
+func breathFirstSearch(ctx context.Context, roots []string, input io.Reader) bool {
 	var wg sync.WaitGroup
 	domainNodeInputChan := make(chan *graph.DomainNode, 5)  // input queue
 	domainNodeOutputChan := make(chan *graph.DomainNode, 5) // output queue
@@ -214,59 +1530,214 @@ func breathFirstSearch(roots []string) {
 		threadPass <- true
 	}
 
+	// apex domains with a domain in the graph or queue, used by -apex-new-only
+	var seenApexes sync.Map
+	for _, root := range roots {
+		apexDomain, err := dns.ApexDomain(root)
+		if err == nil {
+			seenApexes.Store(apexDomain, true)
+		}
+	}
+
+	// stop expanding the graph if it uses too much memory
+	memDone := make(chan bool)
+	memStopped := make(chan bool)
+	if config.memLimit > 0 {
+		go func() {
+			monitorMemory(memDone)
+			close(memStopped)
+		}()
+	} else {
+		close(memStopped)
+	}
+
+	// when streaming, roots wait for a slot before being queued so a fast input can't queue an unbounded number of roots
+	// a slot is released once the root is visited or dropped
+	var rootSlots chan bool
+	if input != nil {
+		parallelRoots := config.parallelRoots
+		if parallelRoots == 0 {
+			parallelRoots = config.parallel
+		}
+		rootSlots = make(chan bool, parallelRoots)
+	}
+	nodeDone := func(domainNode *graph.DomainNode) {
+		if rootSlots != nil && domainNode.Root {
+			<-rootSlots
+		}
+		wg.Done()
+	}
+
 	// thread to put root nodes/domains into queue
+	// the waitGroup Add and Done for this thread ensures that we don't exit before any of the inputs domains are put into the Queue
+	// once interrupted no more roots are queued and the search no longer waits for the thread, as the input may never be closed
+	var seedLock sync.Mutex
+	seeding := true
+	seedDone := func() {
+		seedLock.Lock()
+		defer seedLock.Unlock()
+		if seeding {
+			seeding = false
+			wg.Done()
+		}
+	}
+	// queueRoot queues the root domain, returning false if the search was interrupted
+	queueRoot := func(root, reason string) bool {
+		if rootSlots != nil {
+			select {
+			case rootSlots <- true:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		seedLock.Lock()
+		if !seeding {
+			seedLock.Unlock()
+			if rootSlots != nil {
+				<-rootSlots
+			}
+			return false
+		}
+		wg.Add(1)
+		seedLock.Unlock()
+		n := graph.NewDomainNode(root, config.seedDepth)
+		n.Root = true
+		tracer.Record(trace.Event{Type: trace.Seed, Domain: n.Domain, Depth: n.Depth, Reason: reason})
+		domainNodeInputChan <- n
+		return true
+	}
 	wg.Add(1)
 	go func() {
-		// the waitGroup Add and Done for this thread ensures that we don't exit before any of the inputs domains are put into the Queue
-		defer wg.Done()
+		<-ctx.Done()
+		seedDone()
+	}()
+	go func() {
+		defer seedDone()
 		for _, root := range roots {
-			wg.Add(1)
-			n := graph.NewDomainNode(root, 0)
-			n.Root = true
-			domainNodeInputChan <- n
+			if !queueRoot(root, "root") {
+				return
+			}
+		}
+		if input == nil {
+			return
+		}
+		err := scanSeeds(input, func(line string) bool {
+			seeds, err := seedDomains(ctx, line)
+			if err != nil {
+				e(err)
+				return true
+			}
+			for _, root := range seeds {
+				apexDomain, err := dns.ApexDomain(root)
+				if err == nil {
+					seenApexes.Store(apexDomain, true)
+				}
+				if !queueRoot(root, "stream") {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			e("Input:", err)
 		}
 	}()
 	// thread to start all other threads from DomainChan
+	// budgetReached is only written by this thread, and read once wg.Wait returns
+	budgetReached := false
 	go func() {
 		for {
 			domainNode := <-domainNodeInputChan
 
+			// interrupt check, root domains are also dropped
+			if ctx.Err() != nil {
+				tracer.Record(trace.Event{Type: trace.Dropped, Domain: domainNode.Domain, Depth: domainNode.Depth, Reason: "interrupted"})
+				nodeDone(domainNode)
+				continue
+			}
+
 			// depth check
 			if domainNode.Depth > config.maxDepth {
 				v("Max depth reached, skipping:", domainNode.Domain)
-				wg.Done()
+				tracer.Record(trace.Event{Type: trace.Dropped, Domain: domainNode.Domain, Depth: domainNode.Depth, Reason: "depth"})
+				nodeDone(domainNode)
 				continue
 			}
 			// use certGraph.domains map as list of
 			// domains that are queued to be visited, or already have been
 
 			if _, found := certGraph.GetDomain(domainNode.Domain); !found {
+				// scope check, root domains are always added
+				if !domainNode.Root && crawlScope != nil && !crawlScope.InScope(domainNode.Domain) {
+					v("Out of scope, skipping:", domainNode.Domain)
+					tracer.Record(trace.Event{Type: trace.Dropped, Domain: domainNode.Domain, Depth: domainNode.Depth, Reason: "scope"})
+					nodeDone(domainNode)
+					continue
+				}
+				// global domain budget check, root domains are always added
+				if config.maxSANsTotal > 0 && !domainNode.Root && certGraph.NumDomains() >= config.maxSANsTotal {
+					if !budgetReached {
+						v("Max total domains reached, no longer expanding graph")
+						budgetReached = true
+					}
+					tracer.Record(trace.Event{Type: trace.Dropped, Domain: domainNode.Domain, Depth: domainNode.Depth, Reason: "budget"})
+					nodeDone(domainNode)
+					continue
+				}
+				// memory check, root domains are always added
+				if !domainNode.Root && atomic.LoadInt32(&memoryLimited) == 1 {
+					tracer.Record(trace.Event{Type: trace.Dropped, Domain: domainNode.Domain, Depth: domainNode.Depth, Reason: "memory"})
+					nodeDone(domainNode)
+					continue
+				}
+				// output limit check, root domains are always added
+				if !domainNode.Root && atomic.LoadInt32(&outputLimited) == 1 {
+					tracer.Record(trace.Event{Type: trace.Dropped, Domain: domainNode.Domain, Depth: domainNode.Depth, Reason: "limit"})
+					nodeDone(domainNode)
+					continue
+				}
 				certGraph.AddDomain(domainNode)
+				tracer.Record(trace.Event{Type: trace.Enqueued, Domain: domainNode.Domain, Depth: domainNode.Depth})
 				go func(domainNode *graph.DomainNode) {
-					defer wg.Done()
+					defer nodeDone(domainNode)
 					// wait for pass
 					<-threadPass
 					defer func() { threadPass <- true }()
 
 					// operate on the node
 					v("Visiting", domainNode.Depth, domainNode.Domain)
-					visit(domainNode)
+					safeVisit(ctx, domainNode)
+					certGraph.UpdateDomain(domainNode)
+					tracer.Record(trace.Event{Type: trace.Visited, Domain: domainNode.Domain, Depth: domainNode.Depth, Status: domainNode.Status.String()})
 					domainNodeOutputChan <- domainNode
-					for _, neighbor := range certGraph.GetDomainNeighbors(domainNode.Domain, config.cdn, config.maxSANsSize) {
+					for _, neighbor := range certGraph.GetDomainNeighbors(domainNode.Domain, config.cdn, config.maxSANsSize, certFilter(domainNode)) {
 						wg.Add(1)
-						domainNodeInputChan <- graph.NewDomainNode(neighbor, domainNode.Depth+1)
+						tracer.Record(trace.Event{Type: trace.Neighbor, Domain: neighbor, Depth: domainNode.Depth + 1, From: domainNode.Domain})
+						neighborNode := graph.NewDomainNode(neighbor, domainNode.Depth+1)
+						neighborNode.Parent = domainNode.Domain
+						domainNodeInputChan <- neighborNode
 						if config.apex {
+							if config.apexDepth > 0 && domainNode.Depth+1 > config.apexDepth {
+								continue
+							}
 							apexDomain, err := dns.ApexDomain(neighbor)
 							if err != nil {
 								continue
 							}
+							if _, seen := seenApexes.LoadOrStore(apexDomain, true); seen && config.apexNewOnly {
+								continue
+							}
 							wg.Add(1)
-							domainNodeInputChan <- graph.NewDomainNode(apexDomain, domainNode.Depth+1)
+							tracer.Record(trace.Event{Type: trace.Neighbor, Domain: apexDomain, Depth: domainNode.Depth + 1, From: neighbor, Reason: "apex"})
+							apexNode := graph.NewDomainNode(apexDomain, domainNode.Depth+1)
+							apexNode.Parent = domainNode.Domain
+							domainNodeInputChan <- apexNode
 						}
 					}
 				}(domainNode)
 			} else {
-				wg.Done()
+				tracer.Record(trace.Event{Type: trace.Dropped, Domain: domainNode.Domain, Depth: domainNode.Depth, Reason: "duplicate"})
+				nodeDone(domainNode)
 			}
 		}
 	}()
@@ -274,13 +1745,22 @@ func breathFirstSearch(roots []string) {
 	// save/output thread
 	done := make(chan bool)
 	go func() {
+		printed := 0
 		for {
 			domainNode, more := <-domainNodeOutputChan
 			if more {
-				if !config.printJSON {
+				if streamOutput() {
+					if config.limit > 0 && printed >= config.limit {
+						continue
+					}
 					printNode(domainNode)
+					printed++
+					if printed == config.limit {
+						v("Output limit reached, no longer expanding graph")
+						atomic.StoreInt32(&outputLimited, 1)
+					}
 				} else if config.details {
-					fmt.Fprintln(os.Stderr, domainNode)
+					fmt.Fprintln(os.Stderr, nodeDetails(domainNode))
 				}
 			} else {
 				done <- true
@@ -290,31 +1770,129 @@ func breathFirstSearch(roots []string) {
 	}()
 
 	wg.Wait() // wait for querying to finish
+	close(memDone)
+	<-memStopped // wait for the memory check to stop logging
 	close(domainNodeOutputChan)
 	<-done // wait for save to finish
+	return budgetReached || atomic.LoadInt32(&memoryLimited) == 1 || atomic.LoadInt32(&outputLimited) == 1
+}
+
+// certFilter returns the filter for the certificates to crawl from the domain
+func certFilter(domainNode *graph.DomainNode) graph.CertFilter {
+	if !config.firstParty {
+		return nil
+	}
+	return func(certNode *graph.CertNode) bool {
+		if firstPartyCert(certNode) {
+			return true
+		}
+		tracer.Record(trace.Event{Type: trace.Filtered, Domain: domainNode.Domain, Depth: domainNode.Depth, Cert: certNode.Fingerprint.HexString(), Reason: "third_party"})
+		return false
+	}
+}
+
+// firstPartyCert returns true if enough of the certificate's apex domains are seed apex domains
+func firstPartyCert(certNode *graph.CertNode) bool {
+	if certNode.ApexFraction(seedApexes) >= config.firstPartyThreshold {
+		return true
+	}
+	v("Not crawling third party certificate", certNode.Fingerprint.HexString())
+	return false
+}
+
+// safeVisit calls visit on the node, recovering from any panic so one bad domain can't crash the whole crawl
+// domains that panic are marked with an error status
+func safeVisit(ctx context.Context, domainNode *graph.DomainNode) {
+	defer func() {
+		if r := recover(); r != nil {
+			e("Panic visiting", domainNode.Domain, r)
+			v(string(debug.Stack()))
+			domainNode.Status = status.NewMeta(status.ERROR, "panic")
+			if domainNode.Root {
+				atomic.AddInt32(&failedSeeds, 1)
+			}
+		}
+	}()
+	visit(ctx, domainNode)
 }
 
+// checkForDNS checks for DNS records of the domain's apex domain
+// it is a variable so tests don't have to look up real domains
+var checkForDNS = (*graph.DomainNode).CheckForDNS
+
 // visit visits each node and get and set its neighbors
-func visit(domainNode *graph.DomainNode) {
+// domains are skipped once ctx is cancelled, and cancelling it aborts the query in progress
+func visit(ctx context.Context, domainNode *graph.DomainNode) {
 	// check NS if necessary
-	if config.checkDNS {
-		_, err := domainNode.CheckForDNS(config.timeout)
+	// the apex domain is dead if it has no DNS records, lookup errors are not proof that it is dead
+	dead := false
+	if config.checkDNS || config.pruneDead {
+		hasDNS, err := checkForDNS(domainNode, config.timeout)
 		if err != nil {
 			v("CheckForNS", err)
 		}
+		dead = !hasDNS && err == nil
+	}
+	if config.pruneDead && dead && !domainNode.Root {
+		v("Pruning dead domain:", domainNode.Domain)
+		domainNode.Status = status.NewMeta(status.SKIPPED, "dead")
+		return
+	}
+
+	// resolve the domain's IPs if necessary
+	if config.resolve {
+		resolveDomain(domainNode)
+	}
+
+	// look up the registration of the domain's apex if necessary
+	if config.rdap {
+		lookupRegistration(domainNode)
 	}
 
 	// perform cert search
-	// TODO do pagination in multiple threads to not block on long searches
-	results, err := certDriver.QueryDomain(domainNode.Domain)
+	domainDriver, driverName := driverFor(domainNode.Domain)
+	crawlPause.wait(ctx)
+	if ctx.Err() != nil {
+		domainNode.Status = status.NewMeta(status.SKIPPED, "interrupted")
+		return
+	}
+	if !config.allowPrivate && isLiveDriver(driverName) && dns.AllPrivateIPs(domainNode.IPs) {
+		v("Skipping domain resolving to private IPs:", domainNode.Domain, domainNode.IPs)
+		domainNode.Status = status.NewMeta(status.SKIPPED, "private")
+		return
+	}
+	results, err := domainDriver.QueryDomain(ctx, domainNode.Domain)
+	if err != nil && ctx.Err() != nil {
+		v("Interrupted querying", domainNode.Domain)
+		domainNode.Status = status.NewMeta(status.SKIPPED, "interrupted")
+		return
+	}
 	if err != nil {
 		// this is VERY common to error, usually this is a DNS or tcp connection related issue
 		// we will skip the domain if we can't query it
-		v("QueryDomain", domainNode.Domain, err)
+		vErr("QueryDomain", domainNode.Domain, err)
+		if domainNode.Root {
+			atomic.AddInt32(&failedSeeds, 1)
+		}
 		return
 	}
 	statuses := results.GetStatus()
 	domainNode.AddStatusMap(statuses)
+	if sniResult, ok := results.(driver.SNIResult); ok {
+		if sni, found := sniResult.GetSNI()[domainNode.Domain]; found {
+			domainNode.SNI = sni.Requested
+			domainNode.SNIPresented = sni.Presented
+			domainNode.SNIMismatch = sni.Mismatch
+			if sni.Mismatch {
+				v("SNI mismatch:", domainNode.Domain, "presented", sni.Presented)
+			}
+		}
+	}
+
+	// check the domain for TLS versions below the policy minimum
+	if tlsPolicyMin > 0 && domainNode.Status.Status == status.GOOD {
+		checkTLSPolicy(ctx, domainDriver, domainNode)
+	}
 	relatedDomains, err := results.GetRelated()
 	if err != nil {
 		v("GetRelated", domainNode.Domain, err)
@@ -322,7 +1900,6 @@ func visit(domainNode *graph.DomainNode) {
 	}
 	domainNode.AddRelatedDomains(relatedDomains)
 
-	// TODO parallelize this
 	// TODO fix printing domains as they are found with new driver
 	// add cert nodes to graph
 	fingerprintMap, err := results.GetFingerprints()
@@ -332,33 +1909,168 @@ func visit(domainNode *graph.DomainNode) {
 	}
 
 	// fingerprints for the domain queried
+	// the certificates are looked up in parallel, but added to the graph in order
 	fingerprints := fingerprintMap[domainNode.Domain]
+	lookedUp := lookupCerts(results, fingerprints)
 	for _, fp := range fingerprints {
 		// add certnode to graph
 		certNode, exists := certGraph.GetCert(fp)
 		if !exists {
-			// get cert details
-			certResult, err := results.QueryCert(fp)
-			if err != nil {
-				v("QueryCert", err)
+			certNode = lookedUp[fp]
+			if certNode == nil {
 				continue
 			}
+		}
 
-			certNode = certNodeFromCertResult(certResult)
-			certGraph.AddCert(certNode)
+		reason := "known"
+		if !exists {
+			reason = "new"
 		}
+		tracer.Record(trace.Event{Type: trace.Cert, Domain: domainNode.Domain, Depth: domainNode.Depth, Cert: certNode.Fingerprint.HexString(), Reason: reason})
 
-		certNode.AddFound(certDriver.GetName())
-		domainNode.AddCertFingerprint(certNode.Fingerprint, certDriver.GetName())
+		// only new certificates are added to the graph, the drivers that found known certificates are added to them in place
+		// so the drivers that found them concurrently are not lost
+		sources := certSources(results, fp, driverName)
+		addSources := func(certNode *graph.CertNode) {
+			for _, source := range sources {
+				certNode.AddFound(source)
+			}
+		}
+		if exists {
+			certGraph.UpdateCert(fp, addSources)
+		} else {
+			addSources(certNode)
+			certGraph.AddCert(certNode)
+		}
+		for _, source := range sources {
+			domainNode.AddCertFingerprint(certNode.Fingerprint, source)
+		}
 	}
 
 	// we don't process any other certificates returned, they will be collected
 	//  when we process the related domains
 }
 
+// certSources returns the names of the drivers that found the certificate in the results of the named driver
+// the results of composite drivers are attributed to the drivers they merged that found the certificate
+func certSources(results driver.Result, fp fingerprint.Fingerprint, driverName string) []string {
+	if sourceResult, ok := results.(driver.SourceResult); ok {
+		if sources := sourceResult.Sources(fp); len(sources) > 0 {
+			return sources
+		}
+	}
+	return []string{driverName}
+}
+
+// lookupCerts returns the certificate nodes of the fingerprints that are not already in the graph, keyed by fingerprint
+// up to certQueryWorkers certificates are looked up at once, sharing certQuerySlots with the other domains being visited
+// certificates that could not be looked up are left out
+func lookupCerts(results driver.Result, fingerprints []fingerprint.Fingerprint) map[fingerprint.Fingerprint]*graph.CertNode {
+	unknown := make([]fingerprint.Fingerprint, 0, len(fingerprints))
+	seen := make(map[fingerprint.Fingerprint]bool, len(fingerprints))
+	for _, fp := range fingerprints {
+		if _, exists := certGraph.GetCert(fp); !exists && !seen[fp] {
+			seen[fp] = true
+			unknown = append(unknown, fp)
+		}
+	}
+
+	certNodes := make([]*graph.CertNode, len(unknown))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < certQueryWorkers && w < len(unknown); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				certNodes[i] = lookupCert(results, unknown[i])
+			}
+		}()
+	}
+	for i := range unknown {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	lookedUp := make(map[fingerprint.Fingerprint]*graph.CertNode, len(unknown))
+	for i, fp := range unknown {
+		if certNodes[i] != nil {
+			lookedUp[fp] = certNodes[i]
+		}
+	}
+	return lookedUp
+}
+
+// queryCert queries the certificate from the results once one of the crawl's certQuerySlots is free
+// a panic querying the certificate is returned as an error, as the lookup runs outside of the visit that recovers from them
+func queryCert(results driver.Result, fp fingerprint.Fingerprint) (certResult *driver.CertResult, err error) {
+	certQuerySlots <- true
+	defer func() {
+		<-certQuerySlots
+		if r := recover(); r != nil {
+			e("Panic querying certificate", fp.HexString(), r)
+			v(string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return results.QueryCert(fp)
+}
+
+// lookupCert returns the certificate node of the fingerprint from the driver's results, or nil if it could not be looked up
+func lookupCert(results driver.Result, fp fingerprint.Fingerprint) *graph.CertNode {
+	certResult, err := queryCert(results, fp)
+	if err != nil {
+		v("QueryCert", err)
+		return nil
+	}
+
+	certNode := certNodeFromCertResult(certResult)
+	if config.checkCRL {
+		certNode.CRLStatus = crlChecker.Check(certNode.SerialNumber, certNode.CRLDistributionPoints)
+	}
+	return certNode
+}
+
+// resolveDomain sets the IP addresses of the domain
+// addresses that match the wildcard DNS records of the domain's parent zone are suppressed
+func resolveDomain(domainNode *graph.DomainNode) {
+	ips, err := dns.Resolve(domainNode.Domain, config.timeout)
+	if err != nil {
+		v("Resolve", domainNode.Domain, err)
+		return
+	}
+	wildcard, err := wildcardDetector.IsWildcard(domainNode.Domain, ips)
+	if err != nil {
+		v("Wildcard detection", domainNode.Domain, err)
+	}
+	if wildcard {
+		v("Suppressing wildcard DNS result for", domainNode.Domain, ips)
+		domainNode.WildcardDNS = true
+		return
+	}
+	domainNode.IPs = ips
+}
+
+// lookupRegistration sets the registrar and registrant of the domain's apex domain
+// both are rdap.Unknown if they can't be found
+func lookupRegistration(domainNode *graph.DomainNode) {
+	domainNode.Registrar, domainNode.Registrant = rdap.Unknown, rdap.Unknown
+	apexDomain, err := dns.ApexDomain(domainNode.Domain)
+	if err != nil {
+		v("RDAP", domainNode.Domain, err)
+		return
+	}
+	registration, err := rdapClient.Lookup(apexDomain)
+	if err != nil {
+		vErr("RDAP", apexDomain, err)
+	}
+	domainNode.Registrar, domainNode.Registrant = registration.Registrar, registration.Registrant
+}
+
 func printNode(domainNode *graph.DomainNode) {
 	if config.details {
-		fmt.Fprintln(os.Stdout, domainNode)
+		fmt.Fprintln(os.Stdout, nodeDetails(domainNode))
 	} else {
 		fmt.Fprintln(os.Stdout, domainNode.Domain)
 	}
@@ -371,11 +2083,72 @@ func printNode(domainNode *graph.DomainNode) {
 	}
 }
 
+// nodeDetails returns the details of the domain printed by -details, ending with when the first of its certificates expires
+func nodeDetails(domainNode *graph.DomainNode) string {
+	var expires time.Time
+	for _, fp := range domainNode.GetCertificates() {
+		certNode, found := certGraph.GetCert(fp)
+		if !found || certNode.NotAfter.IsZero() {
+			continue
+		}
+		if expires.IsZero() || certNode.NotAfter.Before(expires) {
+			expires = certNode.NotAfter
+		}
+	}
+	if expires.IsZero() {
+		return domainNode.String()
+	}
+	return fmt.Sprintf("%s\tExpires %s", domainNode.String(), expires.UTC().Format("2006-01-02"))
+}
+
+// checkTLSPolicy sets the TLS policy result of the domain by checking if it accepts a TLS version below -tls-policy-min
+func checkTLSPolicy(ctx context.Context, d driver.Driver, domainNode *graph.DomainNode) {
+	prober, ok := driver.AsTLSProber(d)
+	if !ok {
+		return
+	}
+	accepted, err := prober.AcceptsTLSBelow(ctx, domainNode.Domain, tlsPolicyMin)
+	if err != nil {
+		vErr("TLS policy", domainNode.Domain, err)
+		return
+	}
+	domainNode.TLSPolicy = graph.TLSPolicyPass
+	if accepted {
+		v("TLS policy: accepted a version below", config.tlsPolicyMin, domainNode.Domain)
+		domainNode.TLSPolicy = graph.TLSPolicyFail
+	}
+}
+
 // certNodeFromCertResult convert certResult to certNode
 func certNodeFromCertResult(certResult *driver.CertResult) *graph.CertNode {
 	certNode := &graph.CertNode{
-		Fingerprint: certResult.Fingerprint,
-		Domains:     certResult.Domains,
+		Fingerprint:           certResult.Fingerprint,
+		Domains:               certResult.Domains,
+		SerialNumber:          certResult.SerialNumber,
+		NotBefore:             certResult.NotBefore,
+		NotAfter:              certResult.NotAfter,
+		OCSPServer:            certResult.OCSPServer,
+		IssuingCertificateURL: certResult.IssuingCertificateURL,
+		CRLDistributionPoints: certResult.CRLDistributionPoints,
+		PolicyOIDs:            certResult.PolicyOIDs,
+		Issuer:                certResult.Issuer,
+		KeyFingerprint:        certResult.KeyFingerprint,
+		Organization:          certResult.Organization,
+		OrganizationalUnit:    certResult.OrganizationalUnit,
+	}
+
+	// drop malformed SANs so that they are not crawled
+	if config.requireValidSAN {
+		validDomains := make([]string, 0, len(certNode.Domains))
+		for _, domain := range certNode.Domains {
+			if dns.ValidHostname(domain) {
+				validDomains = append(validDomains, domain)
+			} else {
+				v("Dropping malformed SAN", fmt.Sprintf("%q", domain), "from", certNode.Fingerprint.HexString())
+				certNode.MalformedDomains = append(certNode.MalformedDomains, domain)
+			}
+		}
+		certNode.Domains = validDomains
 	}
 	return certNode
 }
@@ -390,13 +2163,60 @@ func generateGraphMetadata() map[string]interface{} {
 	data["command"] = strings.Join(os.Args, " ")
 	options := make(map[string]interface{})
 	options["parallel"] = config.parallel
+	options["parallel_roots"] = config.parallelRoots
+	options["depth"] = config.maxDepth
+	options["seed_depth"] = config.seedDepth
 	options["driver"] = config.driver
+	options["driver_args"] = config.driverOptions.String()
+	options["driver_rules"] = config.driverRules
 	options["ct_subdomains"] = config.includeCTSubdomains
 	options["ct_expired"] = config.includeCTExpired
 	options["sanscap"] = config.maxSANsSize
+	options["max_sans_total"] = config.maxSANsTotal
+	options["limit"] = config.limit
+	options["mem_limit"] = config.memLimit
 	options["cdn"] = config.cdn
+	options["apex"] = config.apex
+	options["apex_new_only"] = config.apexNewOnly
+	options["apex_depth"] = config.apexDepth
+	options["profile_seeds"] = config.profileSeeds
+	options["collapse_renewals"] = config.collapseRenewals
+	options["profile_hosts"] = config.profileHosts
+	options["first_party"] = config.firstParty
+	options["first_party_threshold"] = config.firstPartyThreshold
 	options["timeout"] = config.timeout
+	options["resolve"] = config.resolve
+	options["prune_dead"] = config.pruneDead
+	options["include"] = config.include
+	options["exclude"] = config.exclude
+	options["allow_private"] = config.allowPrivate
+	options["rdap"] = config.rdap
+	options["crl"] = config.checkCRL
+	options["tls_policy_min"] = config.tlsPolicyMin
+	options["require_valid_san"] = config.requireValidSAN
+	options["max_response_size"] = config.maxResponseSize
+	options["max_conns_per_host"] = config.maxConnsPerHost
+	options["retries"] = config.retries
+	options["retry_budget"] = config.retryBudget
+	options["ssh_jump"] = config.sshJump
 	data["options"] = options
+	if config.certAges {
+		data["cert_ages"] = certGraph.CertAges(time.Now()).ToMap()
+	}
+	health := make([]map[string]interface{}, 0, len(driverHealthOrder))
+	for _, h := range driverHealthOrder {
+		health = append(health, h.ToMap())
+	}
+	data["driver_health"] = health
+	if config.retries > 0 {
+		data["retries"] = retryBudget.ToMap()
+	}
+	if importedMetadata != nil {
+		data["imported"] = map[string]interface{}{
+			"file":      config.importPath,
+			"certgraph": importedMetadata,
+		}
+	}
 	return data
 }
 
@@ -0,0 +1,1303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/dns"
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/fingerprint"
+	"github.com/lanrat/certgraph/graph"
+	"github.com/lanrat/certgraph/status"
+	"github.com/lanrat/certgraph/trace"
+)
+
+// fakeDriver returns the certificates of each domain without connecting to anything
+type fakeDriver struct {
+	name string
+	// certs are the certificates of each domain, domains without certificates have none
+	certs map[string][]*driver.CertResult
+	// errs are the errors returned when querying each domain
+	errs map[string]error
+	// panics are the domains that panic when queried
+	panics map[string]bool
+	// certPanics are the certificates that panic when queried
+	certPanics map[fingerprint.Fingerprint]bool
+	// certDelay is how long each certificate lookup takes
+	certDelay time.Duration
+	// query, if not nil, is called before each domain is queried and its error returned
+	query func(ctx context.Context, domain string) error
+}
+
+// fakeResult is the Result of a fakeDriver query
+type fakeResult struct {
+	d      *fakeDriver
+	domain string
+}
+
+func (d *fakeDriver) GetName() string {
+	return d.name
+}
+
+func (d *fakeDriver) QueryDomain(ctx context.Context, domain string) (driver.Result, error) {
+	if d.query != nil {
+		if err := d.query(ctx, domain); err != nil {
+			return nil, err
+		}
+	}
+	if d.panics[domain] {
+		panic("fake driver panic querying " + domain)
+	}
+	if err, ok := d.errs[domain]; ok {
+		return nil, err
+	}
+	return &fakeResult{d, domain}, nil
+}
+
+func (r *fakeResult) GetStatus() status.Map {
+	return status.NewMap(r.domain, status.New(status.GOOD))
+}
+
+func (r *fakeResult) GetRelated() ([]string, error) {
+	return nil, nil
+}
+
+func (r *fakeResult) GetFingerprints() (driver.FingerprintMap, error) {
+	fingerprints := make(driver.FingerprintMap)
+	for _, cert := range r.d.certs[r.domain] {
+		fingerprints.Add(r.domain, cert.Fingerprint)
+	}
+	return fingerprints, nil
+}
+
+func (r *fakeResult) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
+	if r.d.certDelay > 0 {
+		time.Sleep(r.d.certDelay)
+	}
+	if r.d.certPanics[fp] {
+		panic("fake driver panic querying certificate " + fp.HexString())
+	}
+	for _, cert := range r.d.certs[r.domain] {
+		if cert.Fingerprint == fp {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("certificate not found")
+}
+
+// testCert returns a certificate for the domains with a fingerprint starting with b
+func testCert(b byte, domains ...string) *driver.CertResult {
+	var fp fingerprint.Fingerprint
+	fp[0] = b
+	return &driver.CertResult{
+		Fingerprint: fp,
+		Domains:     domains,
+		NotBefore:   time.Now().Add(-24 * time.Hour),
+		NotAfter:    time.Now().Add(24 * time.Hour),
+	}
+}
+
+// newFakeDriver returns a fakeDriver for the certificates, each added to the domains in it
+// the graph of the certificates is a.test -> b.test -> c.test -> d.test
+func newFakeDriver(certs ...*driver.CertResult) *fakeDriver {
+	if len(certs) == 0 {
+		certs = []*driver.CertResult{
+			testCert(1, "a.test", "b.test"),
+			testCert(2, "b.test", "c.test"),
+			testCert(3, "c.test", "d.test"),
+		}
+	}
+	d := &fakeDriver{name: "fake", certs: make(map[string][]*driver.CertResult)}
+	for _, cert := range certs {
+		for _, domain := range cert.Domains {
+			d.certs[domain] = append(d.certs[domain], cert)
+		}
+	}
+	return d
+}
+
+// runCertgraph runs certgraph with the command line arguments, using the drivers by name in addition to the real ones
+// stdout and stderr are discarded
+func runCertgraph(t *testing.T, drivers map[string]driver.Driver, args ...string) int {
+	t.Helper()
+	return runCertgraphOutput(t, drivers, ioutil.Discard, args...)
+}
+
+// runCertgraphOutput runs certgraph like runCertgraph, copying stdout to w
+func runCertgraphOutput(t *testing.T, drivers map[string]driver.Driver, w io.Writer, args ...string) int {
+	t.Helper()
+	resetState()
+	newSingleDriver = func(name string, includeCTSubdomains bool, opts *driver.Options) (driver.Driver, error) {
+		if d, ok := drivers[name]; ok {
+			return d, nil
+		}
+		return singleDriver(name, includeCTSubdomains, opts)
+	}
+	defer func() {
+		newSingleDriver = singleDriver
+	}()
+	parseFlags(args)
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	output, err := ioutil.TempFile("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = output, devNull
+	code := run()
+	os.Stdout, os.Stderr = stdout, stderr
+
+	_, err = output.Seek(0, io.SeekStart)
+	if err == nil {
+		_, err = io.Copy(w, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// resetState resets certgraph's flags and the state of the previous run
+func resetState() {
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "driver-arg" && !strings.HasPrefix(f.Name, "test.") {
+			f.Value.Set(f.DefValue)
+		}
+	})
+	certGraph = graph.NewCertGraph()
+	failedSeeds = 0
+	certDriver = nil
+	queryDriver = nil
+	driverRules = nil
+	routedDrivers = nil
+	batchers = nil
+	tlsPolicyMin = 0
+	importedMetadata = nil
+	driverHealth = make(map[string]*driver.Health)
+	driverHealthOrder = nil
+	retryBudget = nil
+	memoryLimited = 0
+	outputLimited = 0
+	rdapClient = nil
+	certQuerySlots = nil
+	crlChecker = nil
+	wildcardDetector = nil
+	crawlScope = nil
+	seedApexes = nil
+	tracer = nil
+	priorGraph = nil
+}
+
+// interruptOnQuery returns a query function that interrupts the process when the domain is queried,
+// and waits for the query to be cancelled
+func interruptOnQuery(t *testing.T, domain string) func(ctx context.Context, domain string) error {
+	var once sync.Once
+	return func(ctx context.Context, queried string) error {
+		if queried != domain {
+			return nil
+		}
+		once.Do(func() {
+			p, err := os.FindProcess(os.Getpid())
+			if err == nil {
+				err = p.Signal(os.Interrupt)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		})
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return errors.New("query was not cancelled")
+		}
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	failing := newFakeDriver()
+	failing.errs = map[string]error{"a.test": errors.New("connection refused")}
+	interrupted := newFakeDriver()
+	interrupted.query = interruptOnQuery(t, "a.test")
+	drivers := map[string]driver.Driver{
+		"fake":        newFakeDriver(),
+		"failing":     failing,
+		"interrupted": interrupted,
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"ok", []string{"-driver", "fake", "a.test"}, exitOK},
+		{"no domains", []string{"-driver", "fake"}, exitUsage},
+		{"invalid flag", []string{"-driver", "fake", "-limit", "-1", "a.test"}, exitUsage},
+		{"conflicting flags", []string{"-driver", "fake", "-i", "-", "-stream-input"}, exitUsage},
+		{"unknown driver", []string{"-driver", "unknown", "a.test"}, exitDriver},
+		{"no results", []string{"-driver", "fake", "none.test"}, exitNoResults},
+		{"seeds failed", []string{"-driver", "failing", "a.test"}, exitSeedsFailed},
+		{"seeds partly failed", []string{"-driver", "failing", "a.test", "b.test"}, exitOK},
+		{"partial", []string{"-driver", "fake", "-max-sans-total", "2", "a.test"}, exitPartial},
+		{"cancelled", []string{"-driver", "interrupted", "a.test"}, exitCancelled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.name == "cancelled" && runtime.GOOS == "windows" {
+				t.Skip("interrupts can't be sent on this platform")
+			}
+			if got := runCertgraph(t, drivers, test.args...); got != test.want {
+				t.Errorf("certgraph %v exited with %d, want %d", test.args, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	code := runCertgraph(t, map[string]driver.Driver{"fake": newFakeDriver()}, "-driver", "fake", "a.test")
+	if code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	tests := []struct {
+		domain string
+		depth  uint
+		parent string
+		certs  int
+	}{
+		{"a.test", 0, "", 1},
+		{"b.test", 1, "a.test", 2},
+		{"c.test", 2, "b.test", 2},
+		{"d.test", 3, "c.test", 1},
+	}
+	if certGraph.NumDomains() != len(tests) || certGraph.NumCerts() != 3 {
+		t.Errorf("crawled %d domains and %d certs, want %d and 3", certGraph.NumDomains(), certGraph.NumCerts(), len(tests))
+	}
+	for _, test := range tests {
+		domainNode, ok := certGraph.GetDomain(test.domain)
+		if !ok {
+			t.Errorf("%s was not crawled", test.domain)
+			continue
+		}
+		if domainNode.Depth != test.depth || domainNode.Parent != test.parent || len(domainNode.Certs) != test.certs {
+			t.Errorf("%s has depth %d, parent %q, and %d certs, want %d, %q, and %d", test.domain, domainNode.Depth, domainNode.Parent, len(domainNode.Certs), test.depth, test.parent, test.certs)
+		}
+	}
+
+	// the depth limit stops the crawl expanding
+	runCertgraph(t, map[string]driver.Driver{"fake": newFakeDriver()}, "-driver", "fake", "-depth", "1", "a.test")
+	if _, ok := certGraph.GetDomain("c.test"); ok || certGraph.NumDomains() != 2 {
+		t.Errorf("crawled %d domains with -depth 1, want a.test and b.test", certGraph.NumDomains())
+	}
+}
+
+// countingResult is a Result that counts how many of its certificates are looked up at once
+type countingResult struct {
+	fakeResult
+	lock    sync.Mutex
+	current int
+	max     int
+}
+
+func (r *countingResult) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
+	r.lock.Lock()
+	r.current++
+	if r.current > r.max {
+		r.max = r.current
+	}
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		r.current--
+		r.lock.Unlock()
+	}()
+	return r.fakeResult.QueryCert(fp)
+}
+
+// manyCerts returns n certificates of the domain
+func manyCerts(domain string, n int) []*driver.CertResult {
+	certs := make([]*driver.CertResult, 0, n)
+	for i := 0; i < n; i++ {
+		certs = append(certs, testCert(byte(i+1), domain))
+	}
+	return certs
+}
+
+func TestLookupCerts(t *testing.T) {
+	tests := []struct {
+		name     string
+		parallel int
+		wantMax  int
+	}{
+		{"shared slots", 10, certQueryWorkers},
+		{"single slot", 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetState()
+			certQuerySlots = make(chan bool, test.parallel)
+			d := newFakeDriver(manyCerts("a.test", 12)...)
+			d.certDelay = 5 * time.Millisecond
+			d.certPanics = map[fingerprint.Fingerprint]bool{d.certs["a.test"][1].Fingerprint: true}
+			results := &countingResult{fakeResult: fakeResult{d, "a.test"}}
+
+			// certificates already in the graph are not looked up again
+			certGraph.AddCert(certNodeFromCertResult(d.certs["a.test"][0]))
+			fingerprints, _ := results.GetFingerprints()
+			fps := append(fingerprints["a.test"], fingerprints["a.test"][2])
+
+			lookedUp := lookupCerts(results, fps)
+			if len(lookedUp) != 10 {
+				t.Errorf("looked up %d certificates, want the 10 that are not known and did not panic", len(lookedUp))
+			}
+			for i, fp := range fingerprints["a.test"] {
+				certNode, found := lookedUp[fp]
+				if found != (i > 1) {
+					t.Errorf("certificate %d looked up = %v, want %v", i, found, i > 1)
+				}
+				if found && certNode.Fingerprint != fp {
+					t.Errorf("certificate %d has the fingerprint %s", i, certNode.Fingerprint.HexString())
+				}
+			}
+			if results.max != test.wantMax {
+				t.Errorf("looked up %d certificates at once, want %d", results.max, test.wantMax)
+			}
+			if len(certQuerySlots) != 0 {
+				t.Errorf("%d certificate query slots were not released", len(certQuerySlots))
+			}
+		})
+	}
+}
+
+func BenchmarkLookupCerts(b *testing.B) {
+	for _, parallel := range []int{1, 10} {
+		b.Run(fmt.Sprintf("parallel=%d", parallel), func(b *testing.B) {
+			resetState()
+			certQuerySlots = make(chan bool, parallel)
+			d := newFakeDriver(manyCerts("a.test", 20)...)
+			d.certDelay = time.Millisecond
+			results := &fakeResult{d, "a.test"}
+			fingerprints, _ := results.GetFingerprints()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lookupCerts(results, fingerprints["a.test"])
+			}
+		})
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	// a.test -> b.test and e.test, e.test -> f.test, e.test -> g.test by a certificate that panics
+	d := newFakeDriver(
+		testCert(1, "a.test", "b.test", "e.test"),
+		testCert(2, "b.test", "c.test"),
+		testCert(3, "e.test", "f.test"),
+		testCert(4, "e.test", "g.test"),
+	)
+	d.panics = map[string]bool{"b.test": true}
+	d.certPanics = map[fingerprint.Fingerprint]bool{d.certs["g.test"][0].Fingerprint: true}
+	code := runCertgraph(t, map[string]driver.Driver{"fake": d}, "-driver", "fake", "a.test")
+	if code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+
+	tests := []struct {
+		domain  string
+		crawled bool
+		status  status.DomainStatus
+	}{
+		{"a.test", true, status.GOOD},
+		{"b.test", true, status.ERROR},
+		{"c.test", false, 0},
+		{"e.test", true, status.GOOD},
+		{"f.test", true, status.GOOD},
+		{"g.test", false, 0},
+	}
+	for _, test := range tests {
+		domainNode, ok := certGraph.GetDomain(test.domain)
+		if ok != test.crawled {
+			t.Errorf("%s crawled = %v, want %v", test.domain, ok, test.crawled)
+			continue
+		}
+		if ok && domainNode.Status.Status != test.status {
+			t.Errorf("%s has status %s, want %s", test.domain, domainNode.Status.String(), test.status)
+		}
+	}
+	if b, ok := certGraph.GetDomain("b.test"); ok && b.Status.Meta != "panic" {
+		t.Errorf("b.test has status %s, want the panic recorded", b.Status.String())
+	}
+	if _, ok := certGraph.GetCert(d.certs["g.test"][0].Fingerprint); ok {
+		t.Error("the certificate that panicked was added to the graph")
+	}
+	if e, ok := certGraph.GetDomain("e.test"); !ok || len(e.Certs) != 2 {
+		t.Errorf("e.test has %v, want the 2 certificates that did not panic", e)
+	}
+
+	// a seed that panics fails the crawl
+	code = runCertgraph(t, map[string]driver.Driver{"fake": d}, "-driver", "fake", "b.test")
+	if code != exitSeedsFailed {
+		t.Errorf("crawl of a seed that panics exited with %d, want %d", code, exitSeedsFailed)
+	}
+}
+
+// canonicalGraph returns the nodes and links of the -json output of certgraph sorted, without the run's metadata
+func canonicalGraph(t *testing.T, output []byte) map[string][]string {
+	t.Helper()
+	var jsonGraph map[string]json.RawMessage
+	err := json.Unmarshal(output, &jsonGraph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonical := make(map[string][]string)
+	for _, key := range []string{"nodes", "links"} {
+		var entries []map[string]string
+		err := json.Unmarshal(jsonGraph[key], &entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			data, _ := json.Marshal(entry)
+			canonical[key] = append(canonical[key], string(data))
+		}
+		sort.Strings(canonical[key])
+	}
+	return canonical
+}
+
+func TestCrawlStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certs := []*driver.CertResult{
+		testCert(1, "a.test", "b.test"),
+		testCert(2, "b.test", "c.test"),
+		testCert(3, "b.test", "e.test", "f.test"),
+		testCert(4, "c.test", "d.test"),
+		testCert(5, "d.test"),
+	}
+	drivers := map[string]driver.Driver{"fake": newFakeDriver(certs...)}
+
+	var memory, bolt bytes.Buffer
+	if code := runCertgraphOutput(t, drivers, &memory, "-driver", "fake", "-json", "a.test"); code != exitOK {
+		t.Fatalf("crawl in memory exited with %d", code)
+	}
+	if code := runCertgraphOutput(t, drivers, &bolt, "-driver", "fake", "-json", "-bolt", filepath.Join(dir, "graph.db"), "a.test"); code != exitOK {
+		t.Fatalf("crawl with -bolt exited with %d", code)
+	}
+	memoryGraph, boltGraph := canonicalGraph(t, memory.Bytes()), canonicalGraph(t, bolt.Bytes())
+	if len(memoryGraph["nodes"]) != 11 {
+		t.Errorf("crawl in memory has %d nodes, want the 6 domains and 5 certificates", len(memoryGraph["nodes"]))
+	}
+	if !reflect.DeepEqual(memoryGraph, boltGraph) {
+		t.Errorf("the crawls in memory and with -bolt generated different graphs:\nmemory: %v\nbolt:   %v", memoryGraph, boltGraph)
+	}
+}
+
+// batchFakeDriver is a fakeDriver that queries domains in batches, recording the largest batch
+type batchFakeDriver struct {
+	*fakeDriver
+	lock     sync.Mutex
+	maxBatch int
+}
+
+func (d *batchFakeDriver) BatchSize() int {
+	return 10
+}
+
+func (d *batchFakeDriver) QueryDomains(ctx context.Context, domains []string) (map[string]driver.Result, error) {
+	d.lock.Lock()
+	if len(domains) > d.maxBatch {
+		d.maxBatch = len(domains)
+	}
+	d.lock.Unlock()
+	results := make(map[string]driver.Result, len(domains))
+	for _, domain := range domains {
+		result, err := d.QueryDomain(ctx, domain)
+		if err != nil {
+			return nil, err
+		}
+		results[domain] = result
+	}
+	return results, nil
+}
+
+func TestCrawlBatches(t *testing.T) {
+	certs := []*driver.CertResult{
+		testCert(1, "a.test", "b.test", "c.test", "d.test", "e.test"),
+		testCert(2, "b.test", "f.test"),
+		testCert(3, "c.test", "g.test"),
+		testCert(4, "h.test"),
+	}
+	batching := &batchFakeDriver{fakeDriver: newFakeDriver(certs...)}
+	drivers := map[string]driver.Driver{"fake": newFakeDriver(certs...), "batch": batching}
+	args := []string{"-json", "a.test", "h.test", "none.test"}
+
+	var single, batched bytes.Buffer
+	if code := runCertgraphOutput(t, drivers, &single, append([]string{"-driver", "fake"}, args...)...); code != exitOK {
+		t.Fatalf("crawl with single queries exited with %d", code)
+	}
+	if code := runCertgraphOutput(t, drivers, &batched, append([]string{"-driver", "batch"}, args...)...); code != exitOK {
+		t.Fatalf("crawl with batched queries exited with %d", code)
+	}
+	if batching.maxBatch < 2 {
+		t.Errorf("the largest batch queried %d domains, want the domains visited at once batched", batching.maxBatch)
+	}
+	singleGraph, batchedGraph := canonicalGraph(t, single.Bytes()), canonicalGraph(t, batched.Bytes())
+	if len(singleGraph["nodes"]) != 13 {
+		t.Errorf("crawl with single queries has %d nodes, want the 9 domains and 4 certificates", len(singleGraph["nodes"]))
+	}
+	if !reflect.DeepEqual(singleGraph, batchedGraph) {
+		t.Errorf("the crawls with single and batched queries generated different graphs:\nsingle:  %v\nbatched: %v", singleGraph, batchedGraph)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	drivers := map[string]driver.Driver{"fake": newFakeDriver()}
+
+	var crawled, saved bytes.Buffer
+	if code := runCertgraphOutput(t, drivers, &crawled, "-driver", "fake", "-json", "a.test"); code != exitOK {
+		t.Fatalf("crawl exited with %d", code)
+	}
+	if code := runCertgraphOutput(t, drivers, &saved, "-driver", "fake", "-format", "gob", "a.test"); code != exitOK {
+		t.Fatalf("crawl with -format gob exited with %d", code)
+	}
+	path := filepath.Join(dir, "graph.gob")
+	err = ioutil.WriteFile(path, saved.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var imported bytes.Buffer
+	if code := runCertgraphOutput(t, nil, &imported, "-import", path, "-json"); code != exitOK {
+		t.Fatalf("-import exited with %d", code)
+	}
+	if crawledGraph, importedGraph := canonicalGraph(t, crawled.Bytes()), canonicalGraph(t, imported.Bytes()); !reflect.DeepEqual(crawledGraph, importedGraph) {
+		t.Errorf("the imported graph differs from the crawl:\ncrawled:  %v\nimported: %v", crawledGraph, importedGraph)
+	}
+
+	// files that aren't gob graphs are rejected
+	err = ioutil.WriteFile(path, crawled.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := runCertgraph(t, nil, "-import", path, "-json"); code != exitError {
+		t.Errorf("-import of a json graph exited with %d, want %d", code, exitError)
+	}
+}
+
+func TestRequireValidSAN(t *testing.T) {
+	certs := []*driver.CertResult{
+		testCert(1, "a.test", "b.test", "bad name.test", "_srv.a.test", "localhost"),
+		testCert(2, "b.test", "c.test"),
+	}
+	tests := []struct {
+		name      string
+		args      []string
+		domains   int
+		malformed string
+	}{
+		{"all sans", []string{"-driver", "fake", "a.test"}, 6, ""},
+		{"valid sans", []string{"-driver", "fake", "-require-valid-san", "a.test"}, 3, "bad name.test _srv.a.test localhost"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code := runCertgraph(t, map[string]driver.Driver{"fake": newFakeDriver(certs...)}, test.args...)
+			if code != exitOK {
+				t.Fatalf("exit code %d", code)
+			}
+			if certGraph.NumDomains() != test.domains {
+				t.Errorf("crawled %d domains, want %d", certGraph.NumDomains(), test.domains)
+			}
+			certNode, ok := certGraph.GetCert(certs[0].Fingerprint)
+			if !ok {
+				t.Fatal("cert 1 is missing")
+			}
+			if got := strings.Join(certNode.MalformedDomains, " "); got != test.malformed {
+				t.Errorf("cert 1 has the malformed SANs %q, want %q", got, test.malformed)
+			}
+		})
+	}
+}
+
+func TestCrawlScope(t *testing.T) {
+	certs := []*driver.CertResult{
+		testCert(1, "a.test", "www.a.test", "cdn.a.test", "b.example"),
+		testCert(2, "www.a.test", "x.cdn.a.test"),
+		testCert(3, "b.example", "c.example"),
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		domains []string
+	}{
+		{"everything", nil, []string{"a.test", "b.example", "c.example", "cdn.a.test", "www.a.test", "x.cdn.a.test"}},
+		{"include", []string{"-include", "*.a.test"}, []string{"a.test", "cdn.a.test", "www.a.test", "x.cdn.a.test"}},
+		{"exclude", []string{"-include", "*.a.test", "-exclude", "^cdn\\.|\\.cdn\\."}, []string{"a.test", "www.a.test"}},
+		// root domains are always crawled
+		{"root", []string{"-include", "*.example"}, []string{"a.test", "b.example", "c.example"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append(append([]string{"-driver", "fake"}, test.args...), "a.test")
+			code := runCertgraph(t, map[string]driver.Driver{"fake": newFakeDriver(certs...)}, args...)
+			if code != exitOK {
+				t.Fatalf("exit code %d", code)
+			}
+			domains := make([]string, 0)
+			for _, domainNode := range certGraph.Domains() {
+				domains = append(domains, domainNode.Domain)
+			}
+			sort.Strings(domains)
+			if !reflect.DeepEqual(domains, test.domains) {
+				t.Errorf("crawled %v, want %v", domains, test.domains)
+			}
+		})
+	}
+
+	if code := runCertgraph(t, nil, "-include", "(", "a.test"); code != exitUsage {
+		t.Errorf("invalid -include pattern exited with %d, want %d", code, exitUsage)
+	}
+}
+
+// readTrace returns the events of the -trace file
+func readTrace(t *testing.T, path string) []trace.Event {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []trace.Event
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event trace.Event
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			t.Fatalf("%q is not a JSON event: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl")
+	if code := runCertgraph(t, map[string]driver.Driver{"fake": newFakeDriver()}, "-driver", "fake", "-trace", path, "a.test"); code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+
+	events := readTrace(t, path)
+	if len(events) < 2 || events[0].Type != trace.Start || events[len(events)-1].Type != trace.Done {
+		t.Fatalf("trace does not start with %s and end with %s: %v", trace.Start, trace.Done, events)
+	}
+
+	// each domain is enqueued, then visited, and its neighbors found after that
+	order := make(map[string]int)
+	for i, event := range events {
+		order[event.Type+" "+event.Domain] = i
+	}
+	for _, domain := range []string{"a.test", "b.test", "c.test", "d.test"} {
+		enqueued, isEnqueued := order[trace.Enqueued+" "+domain]
+		visited, isVisited := order[trace.Visited+" "+domain]
+		if !isEnqueued || !isVisited || enqueued > visited {
+			t.Errorf("%s enqueued at event %d and visited at event %d", domain, enqueued, visited)
+		}
+	}
+	for _, neighbor := range [][2]string{{"a.test", "b.test"}, {"b.test", "c.test"}, {"c.test", "d.test"}} {
+		if order[trace.Visited+" "+neighbor[0]] > order[trace.Neighbor+" "+neighbor[1]] {
+			t.Errorf("%s was found before %s was visited", neighbor[1], neighbor[0])
+		}
+	}
+}
+
+func TestUnreachedNeighbors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"depth", []string{"-depth", "1"}},
+		{"max sans total", []string{"-max-sans-total", "2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			args := append(append([]string{"-driver", "fake", "-json"}, test.args...), "a.test")
+			runCertgraphOutput(t, map[string]driver.Driver{"fake": newFakeDriver()}, &output, args...)
+			var jsonGraph struct {
+				Nodes []map[string]string `json:"nodes"`
+				Links []map[string]string `json:"links"`
+			}
+			err := json.Unmarshal(output.Bytes(), &jsonGraph)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// c.test is a SAN of cert 2 of b.test, but was never visited
+			nodes := make(map[string]map[string]string)
+			for _, node := range jsonGraph.Nodes {
+				nodes[node["id"]] = node
+			}
+			if c, ok := nodes["c.test"]; !ok || c["unreached"] != "true" {
+				t.Errorf("c.test is %v, want it as an unreached node", c)
+			}
+			if b, ok := nodes["b.test"]; !ok || b["unreached"] == "true" {
+				t.Errorf("b.test is %v, want it as a visited node", b)
+			}
+			if _, ok := nodes["d.test"]; ok {
+				t.Error("d.test, referenced only by a certificate that was never found, is in the graph")
+			}
+			fp := testCert(2).Fingerprint
+			referenced := false
+			for _, link := range jsonGraph.Links {
+				if link["source"] == fp.HexString() && link["target"] == "c.test" && link["type"] == "sans" {
+					referenced = true
+				}
+			}
+			if !referenced {
+				t.Error("the link from cert 2 to c.test is missing")
+			}
+		})
+	}
+}
+
+func TestInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "domains.txt")
+	err = ioutil.WriteFile(path, []byte("# inventory\n\na.test\n  H.test  \n#x.test\n\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := []*driver.CertResult{testCert(1, "a.test"), testCert(2, "h.test"), testCert(3, "x.test")}
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin bool
+	}{
+		{"file", []string{"-i", path}, false},
+		{"stdin", []string{"-i", "-"}, true},
+		// the seeds are read before the search to infer the first party scope
+		{"first party", []string{"-i", path, "-first-party"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.stdin {
+				f, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				stdin := os.Stdin
+				os.Stdin = f
+				defer func() { os.Stdin = stdin }()
+			}
+			args := append([]string{"-driver", "fake"}, test.args...)
+			if code := runCertgraph(t, map[string]driver.Driver{"fake": newFakeDriver(certs...)}, args...); code != exitOK {
+				t.Fatalf("exit code %d", code)
+			}
+			// blank lines and comments are skipped
+			if certGraph.NumDomains() != 2 {
+				t.Errorf("crawled %d domains, want the 2 seeds", certGraph.NumDomains())
+			}
+			for _, domain := range []string{"a.test", "h.test"} {
+				if domainNode, ok := certGraph.GetDomain(domain); !ok || !domainNode.Root {
+					t.Errorf("%s was not crawled as a seed", domain)
+				}
+			}
+		})
+	}
+
+	if code := runCertgraph(t, nil, "-i", filepath.Join(dir, "missing.txt")); code != exitError {
+		t.Errorf("-i of a file that doesn't exist exited with %d, want %d", code, exitError)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	defer func(interval time.Duration) { memCheckInterval = interval }(memCheckInterval)
+	memCheckInterval = 5 * time.Millisecond
+	// keep the heap over the 1MB limit
+	ballast := make([]byte, 8<<20)
+	defer runtime.KeepAlive(ballast)
+
+	// the seed is visited until the limit is reached, so none of its neighbors are added
+	d := newFakeDriver()
+	d.query = func(ctx context.Context, domain string) error {
+		for start := time.Now(); atomic.LoadInt32(&memoryLimited) == 0; time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				return errors.New("memory limit was not reached")
+			}
+		}
+		return nil
+	}
+	code := runCertgraph(t, map[string]driver.Driver{"fake": d}, "-driver", "fake", "-mem-limit", "1", "a.test")
+	if code != exitPartial {
+		t.Errorf("crawl over the memory limit exited with %d, want %d", code, exitPartial)
+	}
+	if _, ok := certGraph.GetDomain("b.test"); ok || certGraph.NumDomains() != 1 {
+		t.Errorf("crawled %d domains over the memory limit, want only the seed", certGraph.NumDomains())
+	}
+}
+
+func TestParallelRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "domains.txt")
+	var seeds strings.Builder
+	for i := 0; i < 12; i++ {
+		fmt.Fprintf(&seeds, "%d.test\n", i)
+	}
+	if err := ioutil.WriteFile(path, []byte(seeds.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"parallel roots", []string{"-parallel", "10", "-parallel-roots", "2"}, 2},
+		{"parallel", []string{"-parallel", "4"}, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// each seed has no certificates, so only roots are queried
+			var lock sync.Mutex
+			current, max := 0, 0
+			d := newFakeDriver()
+			d.query = func(ctx context.Context, domain string) error {
+				lock.Lock()
+				current++
+				if current > max {
+					max = current
+				}
+				lock.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				lock.Lock()
+				current--
+				lock.Unlock()
+				return nil
+			}
+			args := append([]string{"-driver", "fake", "-i", path}, test.args...)
+			runCertgraph(t, map[string]driver.Driver{"fake": d}, args...)
+			if certGraph.NumDomains() != 12 {
+				t.Errorf("crawled %d domains, want every seed", certGraph.NumDomains())
+			}
+			if max > test.want || max < 2 {
+				t.Errorf("%d seeds were visited at once, want between 2 and %d", max, test.want)
+			}
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	// c.test is visited once the limit is reached, so d.test is never added
+	d := newFakeDriver()
+	d.query = func(ctx context.Context, domain string) error {
+		if domain != "c.test" {
+			return nil
+		}
+		for start := time.Now(); atomic.LoadInt32(&outputLimited) == 0; time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				return errors.New("output limit was not reached")
+			}
+		}
+		return nil
+	}
+	var output bytes.Buffer
+	code := runCertgraphOutput(t, map[string]driver.Driver{"fake": d}, &output, "-driver", "fake", "-limit", "2", "a.test")
+	if code != exitPartial {
+		t.Errorf("crawl reaching -limit exited with %d, want %d", code, exitPartial)
+	}
+	if got := output.String(); got != "a.test\nb.test\n" {
+		t.Errorf("printed %q with -limit 2, want a.test and b.test", got)
+	}
+	if _, ok := certGraph.GetDomain("d.test"); ok {
+		t.Error("crawl kept expanding after reaching -limit")
+	}
+
+	// a crawl with fewer domains than the limit is complete
+	code = runCertgraphOutput(t, map[string]driver.Driver{"fake": newFakeDriver()}, ioutil.Discard, "-driver", "fake", "-limit", "10", "a.test")
+	if code != exitOK {
+		t.Errorf("crawl under -limit exited with %d, want %d", code, exitOK)
+	}
+}
+
+func TestApex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl")
+
+	// www.a.test -> x.b.test, y.b.test -> www.c.test
+	newApexDriver := func() *fakeDriver {
+		return newFakeDriver(testCert(1, "www.a.test", "x.b.test", "y.b.test"), testCert(2, "y.b.test", "www.c.test"))
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		crawled map[string]bool
+		// added is how many times the apex domain is added as a neighbor
+		added map[string]int
+	}{
+		{"no apex", nil, map[string]bool{"a.test": false, "b.test": false, "c.test": false}, map[string]int{"b.test": 0}},
+		// the apex domain is added every time a domain in it is found as a neighbor, the duplicates are dropped
+		{"apex", []string{"-apex"}, map[string]bool{"a.test": true, "b.test": true, "c.test": true}, map[string]int{"b.test": 5}},
+		// the seed's apex domain is already a root, b.test is only added for the first of x.b.test and y.b.test
+		{"new only", []string{"-apex", "-apex-new-only"}, map[string]bool{"a.test": true, "b.test": true, "c.test": true}, map[string]int{"a.test": 0, "b.test": 1, "c.test": 1}},
+		// www.c.test is found at depth 2
+		{"depth", []string{"-apex", "-apex-depth", "1"}, map[string]bool{"a.test": true, "b.test": true, "c.test": false}, map[string]int{"c.test": 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"-driver", "fake", "-trace", path}, test.args...)
+			code := runCertgraph(t, map[string]driver.Driver{"fake": newApexDriver()}, append(args, "www.a.test")...)
+			if code != exitOK {
+				t.Fatalf("exit code %d", code)
+			}
+			for domain, want := range test.crawled {
+				if _, ok := certGraph.GetDomain(domain); ok != want {
+					t.Errorf("%s crawled: %v, want %v", domain, ok, want)
+				}
+			}
+			if _, ok := certGraph.GetDomain("www.c.test"); !ok {
+				t.Error("www.c.test was not crawled")
+			}
+			added := make(map[string]int)
+			for _, event := range readTrace(t, path) {
+				if event.Type == trace.Neighbor && event.Reason == "apex" {
+					added[event.Domain]++
+				}
+			}
+			for domain, want := range test.added {
+				if added[domain] != want {
+					t.Errorf("%s added as an apex domain %d times, want %d", domain, added[domain], want)
+				}
+			}
+		})
+	}
+}
+
+func TestFirstParty(t *testing.T) {
+	// example.test -> www.example.test, cdn.other.test, which are half first party
+	// www.example.test -> one.x.test, two.y.test, which are a third first party
+	newFirstPartyDriver := func() *fakeDriver {
+		return newFakeDriver(testCert(1, "example.test", "www.example.test", "cdn.other.test"), testCert(2, "www.example.test", "one.x.test", "two.y.test"))
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		crawled map[string]bool
+	}{
+		{"every certificate", nil, map[string]bool{"www.example.test": true, "cdn.other.test": true, "one.x.test": true}},
+		{"first party", []string{"-first-party"}, map[string]bool{"www.example.test": true, "cdn.other.test": true, "one.x.test": false}},
+		{"threshold", []string{"-first-party", "-first-party-threshold", "1"}, map[string]bool{"www.example.test": false, "cdn.other.test": false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"-driver", "fake"}, test.args...)
+			code := runCertgraph(t, map[string]driver.Driver{"fake": newFirstPartyDriver()}, append(args, "example.test")...)
+			if code != exitOK {
+				t.Fatalf("exit code %d", code)
+			}
+			for domain, want := range test.crawled {
+				if _, ok := certGraph.GetDomain(domain); ok != want {
+					t.Errorf("%s crawled: %v, want %v", domain, ok, want)
+				}
+			}
+		})
+	}
+
+	// third party certificates are still in the graph for the domains that presented them
+	runCertgraph(t, map[string]driver.Driver{"fake": newFirstPartyDriver()}, "-driver", "fake", "-first-party", "example.test")
+	if www, ok := certGraph.GetDomain("www.example.test"); !ok || len(www.Certs) != 2 {
+		t.Error("www.example.test does not have both of its certificates")
+	}
+
+	if code := runCertgraph(t, nil, "-driver", "fake", "-first-party-threshold", "1.5", "example.test"); code != exitUsage {
+		t.Errorf("-first-party-threshold over 1 exited with %d, want %d", code, exitUsage)
+	}
+}
+
+func TestProfileSeeds(t *testing.T) {
+	apexCert, wwwCert := testCert(1, "example.test", "www.example.test", "neighbor.test"), testCert(2, "www.example.test")
+	apexCert.NotAfter = time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	wwwCert.NotAfter = time.Date(2030, 3, 4, 0, 0, 0, 0, time.UTC)
+	d := newFakeDriver(apexCert, wwwCert)
+
+	// seeds sharing an apex domain are profiled once, and nothing found is crawled
+	var output bytes.Buffer
+	code := runCertgraphOutput(t, map[string]driver.Driver{"fake": d}, &output, "-driver", "fake", "-profile-seeds", "-profile-hosts", "@,www,api", "www.example.test", "mail.example.test", "other.test")
+	if code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	want := fmt.Sprintf(`example.test
+	example.test	Good	%[1]s	Unknown/DV	2030-01-02
+	www.example.test	Good	%[1]s	Unknown/DV	2030-01-02
+	www.example.test	Good	%[2]s	Unknown/DV	2030-03-04
+	api.example.test	Good
+other.test
+	other.test	Good
+	www.other.test	Good
+	api.other.test	Good
+`, apexCert.Fingerprint.HexString(), wwwCert.Fingerprint.HexString())
+	if output.String() != want {
+		t.Errorf("-profile-seeds printed:\n%s\nwant:\n%s", output.String(), want)
+	}
+	for _, domain := range []string{"neighbor.test", "mail.example.test"} {
+		if _, ok := certGraph.GetDomain(domain); ok {
+			t.Errorf("%s was crawled with -profile-seeds", domain)
+		}
+	}
+}
+
+// useCheckForDNS makes the apex domains in dead have no DNS records, and those in failed fail to be looked up
+// every other domain has DNS records, call the returned function to restore the real lookups
+func useCheckForDNS(dead, failed map[string]bool) func() {
+	checkForDNS = func(domainNode *graph.DomainNode, timeout time.Duration) (bool, error) {
+		apexDomain, err := dns.ApexDomain(domainNode.Domain)
+		if err != nil || failed[apexDomain] {
+			return false, errors.New("lookup timed out")
+		}
+		domainNode.HasDNS = !dead[apexDomain]
+		return domainNode.HasDNS, nil
+	}
+	return func() {
+		checkForDNS = (*graph.DomainNode).CheckForDNS
+	}
+}
+
+func TestPruneDead(t *testing.T) {
+	defer useCheckForDNS(map[string]bool{"dead.test": true}, map[string]bool{"failed.test": true})()
+
+	// root.dead.test -> www.dead.test -> x.test, www.failed.test -> y.test, www.live.test -> z.test
+	certs := []*driver.CertResult{
+		testCert(1, "root.dead.test", "www.dead.test", "www.failed.test", "www.live.test"),
+		testCert(2, "www.dead.test", "x.test"),
+		testCert(3, "www.failed.test", "y.test"),
+		testCert(4, "www.live.test", "z.test"),
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		crawled map[string]bool
+	}{
+		{"no pruning", []string{"-dns"}, map[string]bool{"x.test": true, "y.test": true, "z.test": true}},
+		// dead roots are still visited, and failed lookups are not proof that a domain is dead
+		{"prune dead", []string{"-prune-dead"}, map[string]bool{"x.test": false, "y.test": true, "z.test": true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"-driver", "fake"}, test.args...)
+			code := runCertgraph(t, map[string]driver.Driver{"fake": newFakeDriver(certs...)}, append(args, "root.dead.test")...)
+			if code != exitOK {
+				t.Fatalf("exit code %d", code)
+			}
+			for domain, want := range test.crawled {
+				if _, ok := certGraph.GetDomain(domain); ok != want {
+					t.Errorf("%s crawled: %v, want %v", domain, ok, want)
+				}
+			}
+		})
+	}
+
+	if www, ok := certGraph.GetDomain("www.dead.test"); !ok || www.Status != status.NewMeta(status.SKIPPED, "dead") || len(www.Certs) != 0 {
+		t.Error("dead domain was not skipped with the status Skipped(dead)")
+	}
+}
+
+func TestSeedDepth(t *testing.T) {
+	code := runCertgraph(t, map[string]driver.Driver{"fake": newFakeDriver()}, "-driver", "fake", "-depth", "3", "-seed-depth", "1", "a.test")
+	if code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	for domain, depth := range map[string]uint{"a.test": 1, "b.test": 2, "c.test": 3} {
+		if domainNode, ok := certGraph.GetDomain(domain); !ok || domainNode.Depth != depth {
+			t.Errorf("%s was not crawled at depth %d", domain, depth)
+		}
+	}
+	if _, ok := certGraph.GetDomain("d.test"); ok || certGraph.NumDomains() != 3 {
+		t.Errorf("crawled %d domains with -depth 3 -seed-depth 1, want a.test to c.test", certGraph.NumDomains())
+	}
+
+	// seeds deeper than -depth are not crawled
+	code = runCertgraph(t, map[string]driver.Driver{"fake": newFakeDriver()}, "-driver", "fake", "-depth", "2", "-seed-depth", "3", "a.test")
+	if code != exitNoResults || certGraph.NumDomains() != 0 {
+		t.Errorf("crawl with -seed-depth over -depth exited with %d and %d domains, want %d and none", code, certGraph.NumDomains(), exitNoResults)
+	}
+}
+
+// orgFakeDriver is a fakeDriver that can search for the domains of organizations
+type orgFakeDriver struct {
+	*fakeDriver
+	// orgs are the domains in the certificates of each organization
+	orgs map[string][]string
+	// limit is the limit of the last search
+	limit int
+}
+
+func (d *orgFakeDriver) QueryOrganization(ctx context.Context, org string, limit int) ([]string, error) {
+	d.limit = limit
+	return d.orgs[org], nil
+}
+
+func TestOrg(t *testing.T) {
+	d := &orgFakeDriver{fakeDriver: newFakeDriver(), orgs: map[string][]string{"Example Inc": {"*.c.test", "x.test"}}}
+	drivers := map[string]driver.Driver{"org": d, "fake": newFakeDriver()}
+
+	// the organization's domains are seeds, with wildcards trimmed rather than expanded
+	code := runCertgraph(t, drivers, "-driver", "org", "-org", "Example Inc")
+	if code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	if d.limit != orgSearchLimit {
+		t.Errorf("organization searched with limit %d, want %d", d.limit, orgSearchLimit)
+	}
+	for domain, root := range map[string]bool{"c.test": true, "x.test": true, "b.test": false, "d.test": false} {
+		if domainNode, ok := certGraph.GetDomain(domain); !ok || domainNode.Root != root {
+			t.Errorf("%s was not crawled with root %v", domain, root)
+		}
+	}
+	if _, ok := certGraph.GetDomain("a.test"); !ok {
+		t.Error("a.test was not crawled from the organization's domains")
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown organization", []string{"-driver", "org", "-org", "Other Inc"}},
+		{"unsupported driver", []string{"-driver", "fake", "-org", "Example Inc"}},
+	}
+	for _, test := range tests {
+		if code := runCertgraph(t, drivers, test.args...); code != exitError {
+			t.Errorf("%s: exited with %d, want %d", test.name, code, exitError)
+		}
+	}
+}
+
+func TestJSONCompact(t *testing.T) {
+	var indented, compact bytes.Buffer
+	if code := runCertgraphOutput(t, map[string]driver.Driver{"fake": newFakeDriver()}, &indented, "-driver", "fake", "-json", "a.test"); code != exitOK {
+		t.Fatalf("crawl with -json exited with %d", code)
+	}
+	if code := runCertgraphOutput(t, map[string]driver.Driver{"fake": newFakeDriver()}, &compact, "-driver", "fake", "-json", "-json-compact", "a.test"); code != exitOK {
+		t.Fatalf("crawl with -json-compact exited with %d", code)
+	}
+	if lines := strings.Count(compact.String(), "\n"); lines != 1 || strings.Contains(compact.String(), "\t") {
+		t.Errorf("-json-compact printed %d lines with indentation: %s", lines, compact.String())
+	}
+	if !strings.Contains(indented.String(), "\n\t\"") {
+		t.Errorf("-json printed the graph without indentation: %s", indented.String())
+	}
+	if compact.Len() >= indented.Len() {
+		t.Errorf("-json-compact printed %d bytes, want fewer than the %d indented", compact.Len(), indented.Len())
+	}
+	if !reflect.DeepEqual(canonicalGraph(t, compact.Bytes()), canonicalGraph(t, indented.Bytes())) {
+		t.Error("-json-compact printed a different graph than -json")
+	}
+}
+
+func TestWildcardSeed(t *testing.T) {
+	ct := newFakeDriver(testCert(1, "a.test", "www.a.test", "*.mail.a.test", "b.test"))
+	ct.name = "crtsh"
+	code := runCertgraph(t, map[string]driver.Driver{"crtsh": ct}, "-driver", "crtsh", "*.a.test")
+	if code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	for _, domain := range []string{"www.a.test", "mail.a.test"} {
+		if domainNode, ok := certGraph.GetDomain(domain); !ok || !domainNode.Root {
+			t.Errorf("subdomain %s of the wildcard seed is not a root", domain)
+		}
+	}
+	if domainNode, ok := certGraph.GetDomain("a.test"); ok && domainNode.Root {
+		t.Error("the wildcard seed's domain is a root")
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupts can't be sent on this platform")
+	}
+	// interrupting the search for the subdomains cancels it
+	ct.query = interruptOnQuery(t, "a.test")
+	if code := runCertgraph(t, map[string]driver.Driver{"crtsh": ct}, "-driver", "crtsh", "*.a.test"); code != exitCancelled {
+		t.Errorf("interrupted wildcard search exited with %d, want %d", code, exitCancelled)
+	}
+}
+
+func TestAllowPrivate(t *testing.T) {
+	if ips, err := dns.Resolve("localhost", time.Second); err != nil || len(ips) == 0 {
+		t.Skip("localhost does not resolve")
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		queried bool
+		status  status.Status
+	}{
+		{"private", []string{"-resolve"}, false, status.NewMeta(status.SKIPPED, "private")},
+		{"allow private", []string{"-resolve", "-allow-private"}, true, status.New(status.GOOD)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var queried int32
+			live := newFakeDriver(testCert(1, "localhost"))
+			live.name = "http"
+			live.query = func(ctx context.Context, domain string) error {
+				atomic.AddInt32(&queried, 1)
+				return nil
+			}
+			args := append([]string{"-driver", "http"}, test.args...)
+			runCertgraph(t, map[string]driver.Driver{"http": live}, append(args, "localhost")...)
+			if got := atomic.LoadInt32(&queried) > 0; got != test.queried {
+				t.Errorf("localhost queried: %v, want %v", got, test.queried)
+			}
+			if domainNode, ok := certGraph.GetDomain("localhost"); !ok || domainNode.Status != test.status {
+				t.Errorf("localhost does not have the status %s", test.status.String())
+			}
+		})
+	}
+
+	if code := runCertgraph(t, nil, "-driver", "http", "-allow-private", "localhost"); code != exitUsage {
+		t.Errorf("-allow-private without -resolve exited with %d, want %d", code, exitUsage)
+	}
+}
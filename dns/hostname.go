@@ -0,0 +1,20 @@
+package dns
+
+import (
+	"regexp"
+	"strings"
+)
+
+// hostnameRegex matches plausibly valid hostnames made of at least two labels
+// with an optional leading wildcard label, the last label must start with a letter
+var hostnameRegex = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidHostname returns true if the domain is a plausibly valid hostname
+// wildcard domains are allowed, bare TLDs, spaces, underscores and other non-hostname strings are not
+func ValidHostname(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if len(domain) > 253 {
+		return false
+	}
+	return hostnameRegex.MatchString(domain)
+}
@@ -0,0 +1,41 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidHostname(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"example.com", true},
+		{"www.example.com", true},
+		{"WWW.Example.COM", true},
+		{"example.com.", true},
+		{"*.example.com", true},
+		{"xn--bcher-kva.example", true},
+		{"a-b.c-d.example.co.uk", true},
+		{"1.example.com", true},
+		{"com", false},
+		{"", false},
+		{"*.com.*", false},
+		{"www.*.example.com", false},
+		{"exa mple.com", false},
+		{"_dmarc.example.com", false},
+		{"-example.com", false},
+		{"example-.com", false},
+		{"example..com", false},
+		{"example.123", false},
+		{"192.0.2.1", false},
+		{"user@example.com", false},
+		{strings.Repeat("a", 64) + ".com", false},
+		{strings.Repeat(strings.Repeat("a", 63)+".", 4) + "com", false},
+	}
+	for _, test := range tests {
+		if got := ValidHostname(test.domain); got != test.want {
+			t.Errorf("ValidHostname(%q) = %v, want %v", test.domain, got, test.want)
+		}
+	}
+}
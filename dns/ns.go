@@ -4,17 +4,32 @@ package dns
 import (
 	"context"
 	"net"
+	"sync"
 	"time"
 )
 
+// resolver is the subset of net.Resolver used for DNS lookups, so it can be replaced in tests
+type resolver interface {
+	LookupNS(ctx context.Context, name string) ([]*net.NS, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
 var (
-	dnsCache    = make(map[string]bool)
-	dnsResolver = &net.Resolver{}
+	// dnsCache maps apex domains to their *recordsEntry
+	dnsCache    sync.Map
+	dnsResolver resolver = &net.Resolver{
+		//PreferGo: true,
+		StrictErrors: false,
+	}
 )
 
-func init() {
-	//dnsResolver.PreferGo = true
-	dnsResolver.StrictErrors = false
+// recordsEntry is the DNS record check of a single apex domain
+// done is closed once hasRecords and err are set
+type recordsEntry struct {
+	done       chan struct{}
+	hasRecords bool
+	err        error
 }
 
 func noSuchHostDNSError(err error) bool {
@@ -69,20 +84,39 @@ func HasRecords(domain string, timeout time.Duration) (bool, error) {
 	return false, nil
 }
 
-// HasRecordsCache returns true if the domain has no DNS records (at the apex domain level)
-// uses a cache to store results to prevent lots of DNS lookups
+// Resolve returns the IP addresses of the domain with a timeout
+// domains that do not exist have no addresses and are not an error
+func Resolve(domain string, timeout time.Duration) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := dnsResolver.LookupHost(ctx, domain)
+	if err != nil && noSuchHostDNSError(err) {
+		return nil, nil
+	}
+	return addrs, err
+}
+
+// HasRecordsCache returns true if the domain has DNS records (at the apex domain level)
+// the apex domain is only checked once, and the result, including domains that don't exist,
+// is cached and shared by every subdomain of it to prevent lots of DNS lookups
+// lookup errors such as timeouts are not cached, the next check of the apex domain looks it up again
+// safe for concurrent use, concurrent checks of the same apex domain wait for a single lookup
 func HasRecordsCache(domain string, timeout time.Duration) (bool, error) {
 	domain, err := ApexDomain(domain)
 	if err != nil {
 		return false, err
 	}
-	hasDNS, found := dnsCache[domain]
-	if found {
-		return hasDNS, nil
+	entry := &recordsEntry{done: make(chan struct{})}
+	if e, loaded := dnsCache.LoadOrStore(domain, entry); loaded {
+		entry = e.(*recordsEntry)
+		<-entry.done
+		return entry.hasRecords, entry.err
 	}
-	hasRecords, err := HasRecords(domain, timeout)
-	if err != nil {
-		dnsCache[domain] = hasRecords
+	entry.hasRecords, entry.err = HasRecords(domain, timeout)
+	if entry.err != nil {
+		// only the checks already waiting for the lookup share its error
+		dnsCache.Delete(domain)
 	}
-	return hasRecords, err
+	close(entry.done)
+	return entry.hasRecords, entry.err
 }
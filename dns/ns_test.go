@@ -0,0 +1,201 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	errNoSuchHost = &net.DNSError{Err: "no such host", Name: "test"}
+	errTimeout    = &net.DNSError{Err: "i/o timeout", Name: "test", IsTimeout: true}
+)
+
+// fakeResolver returns the records of each domain, domains without records don't exist
+// lookups wait for release to be closed if it is set
+type fakeResolver struct {
+	ns      map[string][]*net.NS
+	cname   map[string]string
+	hosts   map[string][]string
+	err     map[string]error
+	release chan struct{}
+	lookups int32
+}
+
+// useResolver replaces dnsResolver and empties the cache until the returned function is called
+func useResolver(r resolver) func() {
+	dnsCache = sync.Map{}
+	previous := dnsResolver
+	dnsResolver = r
+	return func() {
+		dnsResolver = previous
+		dnsCache = sync.Map{}
+	}
+}
+
+func (r *fakeResolver) lookup(name string) error {
+	atomic.AddInt32(&r.lookups, 1)
+	if r.release != nil {
+		<-r.release
+	}
+	if err, ok := r.err[name]; ok {
+		return err
+	}
+	return nil
+}
+
+func (r *fakeResolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	if err := r.lookup(name); err != nil {
+		return nil, err
+	}
+	if ns, ok := r.ns[name]; ok {
+		return ns, nil
+	}
+	return nil, errNoSuchHost
+}
+
+func (r *fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if err := r.lookup(host); err != nil {
+		return "", err
+	}
+	if cname, ok := r.cname[host]; ok {
+		return cname, nil
+	}
+	return "", errNoSuchHost
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if err := r.lookup(host); err != nil {
+		return nil, err
+	}
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, errNoSuchHost
+}
+
+func TestHasRecords(t *testing.T) {
+	r := &fakeResolver{
+		ns:    map[string][]*net.NS{"ns.example.com": {{Host: "ns1.example.com."}}},
+		cname: map[string]string{"cname.example.com": "target.example.net."},
+		hosts: map[string][]string{"host.example.com": {"192.0.2.1"}},
+		err:   map[string]error{"timeout.example.com": errTimeout},
+	}
+	defer useResolver(r)()
+
+	tests := []struct {
+		domain  string
+		want    bool
+		wantErr bool
+	}{
+		{"ns.example.com", true, false},
+		{"cname.example.com", true, false},
+		{"host.example.com", true, false},
+		{"missing.example.com", false, false},
+		{"timeout.example.com", false, true},
+	}
+	for _, test := range tests {
+		got, err := HasRecords(test.domain, time.Second)
+		if (err != nil) != test.wantErr {
+			t.Errorf("HasRecords(%s) error = %v, want error %v", test.domain, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("HasRecords(%s) = %v, want %v", test.domain, got, test.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := &fakeResolver{
+		hosts: map[string][]string{"host.example.com": {"192.0.2.1", "2001:db8::1"}},
+		err:   map[string]error{"timeout.example.com": errTimeout},
+	}
+	defer useResolver(r)()
+
+	addrs, err := Resolve("host.example.com", time.Second)
+	if err != nil || len(addrs) != 2 {
+		t.Errorf("Resolve(host.example.com) = %v, %v", addrs, err)
+	}
+	addrs, err = Resolve("missing.example.com", time.Second)
+	if err != nil || len(addrs) != 0 {
+		t.Errorf("Resolve of a domain that doesn't exist = %v, %v, want no addresses and no error", addrs, err)
+	}
+	if _, err = Resolve("timeout.example.com", time.Second); err == nil {
+		t.Error("Resolve of a domain that timed out did not fail")
+	}
+}
+
+func TestHasRecordsCacheConcurrent(t *testing.T) {
+	r := &fakeResolver{
+		ns:      map[string][]*net.NS{"example.com": {{Host: "ns1.example.com."}}},
+		release: make(chan struct{}),
+	}
+	defer useResolver(r)()
+
+	const checks = 20
+	var wg sync.WaitGroup
+	results := make([]bool, checks)
+	for i := 0; i < checks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hasRecords, err := HasRecordsCache(string(rune('a'+i))+".www.example.com", time.Second)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = hasRecords
+		}(i)
+	}
+	// let the checks queue up on the first lookup before it completes
+	time.Sleep(20 * time.Millisecond)
+	close(r.release)
+	wg.Wait()
+
+	if lookups := atomic.LoadInt32(&r.lookups); lookups != 1 {
+		t.Errorf("%d concurrent checks of the same apex domain made %d lookups, want 1", checks, lookups)
+	}
+	for i, hasRecords := range results {
+		if !hasRecords {
+			t.Errorf("check %d returned no records", i)
+		}
+	}
+}
+
+func TestHasRecordsCacheErrors(t *testing.T) {
+	r := &fakeResolver{
+		ns:  map[string][]*net.NS{"flaky.com": {{Host: "ns1.flaky.com."}}},
+		err: map[string]error{"flaky.com": errTimeout},
+	}
+	defer useResolver(r)()
+
+	// domains that don't exist are cached, each of the 3 lookups is made once
+	for i := 0; i < 3; i++ {
+		hasRecords, err := HasRecordsCache("www.missing.com", time.Second)
+		if hasRecords || err != nil {
+			t.Errorf("HasRecordsCache of a domain that doesn't exist = %v, %v", hasRecords, err)
+		}
+	}
+	if lookups := atomic.LoadInt32(&r.lookups); lookups != 3 {
+		t.Errorf("checking a domain that doesn't exist 3 times made %d lookups, want 3", lookups)
+	}
+
+	// errors are not cached
+	atomic.StoreInt32(&r.lookups, 0)
+	_, err := HasRecordsCache("www.flaky.com", time.Second)
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsTimeout {
+		t.Errorf("HasRecordsCache returned %v, want the timeout", err)
+	}
+	delete(r.err, "flaky.com")
+	hasRecords, err := HasRecordsCache("www.flaky.com", time.Second)
+	if !hasRecords || err != nil {
+		t.Errorf("HasRecordsCache after a timeout = %v, %v, want it to be looked up again", hasRecords, err)
+	}
+	if lookups := atomic.LoadInt32(&r.lookups); lookups != 2 {
+		t.Errorf("checking a domain after a timeout made %d lookups, want 2", lookups)
+	}
+}
@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"net"
+)
+
+// privateNetworks are the private, shared, and reserved IP ranges that are not reachable on the public internet
+var privateNetworks = parseNetworks(
+	"0.0.0.0/8",       // this network
+	"10.0.0.0/8",      // RFC1918
+	"100.64.0.0/10",   // carrier grade NAT
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link local
+	"172.16.0.0/12",   // RFC1918
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"192.168.0.0/16",  // RFC1918
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved and broadcast
+	"::/128",          // unspecified
+	"::1/128",         // loopback
+	"100::/64",        // discard only
+	"2001:db8::/32",   // documentation
+	"fc00::/7",        // unique local
+	"fe80::/10",       // link local
+	"ff00::/8",        // multicast
+)
+
+// parseNetworks parses the CIDR ranges, panicking on invalid ranges
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// IsPrivateIP returns true if the IP address is in a private, loopback, link local, or otherwise reserved range
+// invalid IP addresses are not private
+func IsPrivateIP(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllPrivateIPs returns true if there is at least one IP address and every one of them is private
+func AllPrivateIPs(ips []string) bool {
+	for _, ip := range ips {
+		if !IsPrivateIP(ip) {
+			return false
+		}
+	}
+	return len(ips) > 0
+}
@@ -0,0 +1,56 @@
+package dns
+
+import (
+	"testing"
+)
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"192.0.2.1", true},
+		{"224.0.0.251", true},
+		{"255.255.255.255", true},
+		{"::1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"2001:db8::1", true},
+		{"::ffff:10.0.0.1", true},
+		{"8.8.8.8", false},
+		{"172.32.0.1", false},
+		{"100.128.0.1", false},
+		{"2606:4700::1111", false},
+		{"not an ip", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := IsPrivateIP(test.ip); got != test.want {
+			t.Errorf("IsPrivateIP(%s) = %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestAllPrivateIPs(t *testing.T) {
+	tests := []struct {
+		ips  []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"10.0.0.1"}, true},
+		{[]string{"10.0.0.1", "fd00::1"}, true},
+		{[]string{"10.0.0.1", "8.8.8.8"}, false},
+	}
+	for _, test := range tests {
+		if got := AllPrivateIPs(test.ips); got != test.want {
+			t.Errorf("AllPrivateIPs(%v) = %v, want %v", test.ips, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Scope limits a crawl to the domains matching its include patterns and none of its exclude patterns
+// patterns in the form *.example.com match the subdomains of example.com, all other patterns are regular expressions
+type Scope struct {
+	include []scopePattern
+	exclude []scopePattern
+}
+
+// scopePattern is a single suffix or regex pattern
+type scopePattern struct {
+	suffix string
+	regex  *regexp.Regexp
+}
+
+// NewScope returns the Scope of the comma separated include and exclude patterns
+// an empty include list includes every domain
+func NewScope(include, exclude string) (*Scope, error) {
+	var s Scope
+	var err error
+	s.include, err = parseScopePatterns(include)
+	if err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	s.exclude, err = parseScopePatterns(exclude)
+	if err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	return &s, nil
+}
+
+// parseScopePatterns parses the comma separated patterns, skipping empty patterns
+func parseScopePatterns(patterns string) ([]scopePattern, error) {
+	parsed := make([]scopePattern, 0)
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) == 0 {
+			continue
+		}
+		if strings.HasPrefix(pattern, "*.") {
+			parsed = append(parsed, scopePattern{suffix: strings.ToLower(pattern[1:])})
+			continue
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		parsed = append(parsed, scopePattern{regex: regex})
+	}
+	return parsed, nil
+}
+
+// match returns true if the pattern matches the domain
+func (p scopePattern) match(domain string) bool {
+	if p.regex != nil {
+		return p.regex.MatchString(domain)
+	}
+	return strings.HasSuffix(domain, p.suffix)
+}
+
+// matchAny returns true if any of the patterns match the domain
+func matchAny(patterns []scopePattern, domain string) bool {
+	for _, pattern := range patterns {
+		if pattern.match(domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// InScope returns true if the domain matches an include pattern, or there are none, and no exclude pattern
+// wildcard domains are matched without their leading wildcard label
+func (s *Scope) InScope(domain string) bool {
+	domain = strings.TrimPrefix(strings.ToLower(domain), "*.")
+	if matchAny(s.exclude, domain) {
+		return false
+	}
+	return len(s.include) == 0 || matchAny(s.include, domain)
+}
+
+// Empty returns true if the scope has no patterns and includes every domain
+func (s *Scope) Empty() bool {
+	return len(s.include) == 0 && len(s.exclude) == 0
+}
@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		domain  string
+		want    bool
+	}{
+		{"empty", "", "", "anything.test", true},
+		{"suffix", "*.example.com", "", "www.example.com", true},
+		{"suffix case", "*.Example.com", "", "WWW.EXAMPLE.COM", true},
+		{"suffix apex", "*.example.com", "", "example.com", false},
+		{"suffix label", "*.example.com", "", "badexample.com", false},
+		{"regex", `^api\.`, "", "api.example.net", true},
+		{"regex miss", `^api\.`, "", "www.example.net", false},
+		{"list", "*.example.com, *.example.net", "", "www.example.net", true},
+		{"exclude", "", "*.cdn.example.com", "x.cdn.example.com", false},
+		{"exclude wins", "*.example.com", "*.cdn.example.com", "x.cdn.example.com", false},
+		{"exclude regex", "*.example.com", "^staging", "staging.example.com", false},
+		{"not excluded", "*.example.com", "*.cdn.example.com", "www.example.com", true},
+		{"wildcard", "*.example.com", "", "*.www.example.com", true},
+		{"wildcard excluded", "", "*.cdn.example.com", "*.x.cdn.example.com", false},
+	}
+	for _, test := range tests {
+		s, err := NewScope(test.include, test.exclude)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := s.InScope(test.domain); got != test.want {
+			t.Errorf("%s: InScope(%s) = %v, want %v", test.name, test.domain, got, test.want)
+		}
+	}
+}
+
+func TestScopeEmpty(t *testing.T) {
+	tests := []struct {
+		include string
+		exclude string
+		want    bool
+	}{
+		{"", "", true},
+		{" , ", ",", true},
+		{"*.example.com", "", false},
+		{"", "*.example.com", false},
+	}
+	for _, test := range tests {
+		s, err := NewScope(test.include, test.exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Empty(); got != test.want {
+			t.Errorf("NewScope(%q, %q).Empty() = %v, want %v", test.include, test.exclude, got, test.want)
+		}
+	}
+}
+
+func TestNewScopeErrors(t *testing.T) {
+	if _, err := NewScope("(", ""); err == nil || !strings.Contains(err.Error(), "include") {
+		t.Errorf("NewScope with an invalid include pattern returned %v", err)
+	}
+	if _, err := NewScope("", "*.example.com,["); err == nil || !strings.Contains(err.Error(), "exclude") {
+		t.Errorf("NewScope with an invalid exclude pattern returned %v", err)
+	}
+}
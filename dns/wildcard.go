@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WildcardDetector detects domains whose DNS records only come from a wildcard record in their parent zone
+// by resolving a random subdomain of the zone that should not exist
+// the result for each zone is cached
+type WildcardDetector struct {
+	timeout time.Duration
+	zones   sync.Map
+}
+
+// wildcardZone is the cached wildcard determination of a single zone
+type wildcardZone struct {
+	once sync.Once
+	ips  map[string]bool
+	err  error
+}
+
+// NewWildcardDetector returns a new WildcardDetector using the provided DNS timeout
+func NewWildcardDetector(timeout time.Duration) *WildcardDetector {
+	return &WildcardDetector{timeout: timeout}
+}
+
+// IsWildcard returns true if every one of the domain's addresses ips is also returned for a random
+// subdomain of the domain's parent zone, meaning the domain may only appear to exist because of a wildcard record
+// apex domains are never wildcards
+func (w *WildcardDetector) IsWildcard(domain string, ips []string) (bool, error) {
+	if len(ips) == 0 {
+		return false, nil
+	}
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	apex, err := ApexDomain(domain)
+	if err != nil || apex == domain {
+		return false, nil
+	}
+	zone := domain[strings.Index(domain, ".")+1:]
+	wildcardIPs, err := w.zoneWildcardIPs(zone)
+	if err != nil || len(wildcardIPs) == 0 {
+		return false, err
+	}
+	for _, ip := range ips {
+		if !wildcardIPs[ip] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// zoneWildcardIPs returns the addresses a random subdomain of the zone resolve to, if any
+func (w *WildcardDetector) zoneWildcardIPs(zone string) (map[string]bool, error) {
+	z, _ := w.zones.LoadOrStore(zone, new(wildcardZone))
+	wz := z.(*wildcardZone)
+	wz.once.Do(func() {
+		var label string
+		label, wz.err = randomLabel()
+		if wz.err != nil {
+			return
+		}
+		var addrs []string
+		addrs, wz.err = Resolve(label+"."+zone, w.timeout)
+		wz.ips = make(map[string]bool, len(addrs))
+		for _, addr := range addrs {
+			wz.ips[addr] = true
+		}
+	})
+	return wz.ips, wz.err
+}
+
+// randomLabel returns a random DNS label that is very unlikely to exist
+func randomLabel() (string, error) {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return "certgraph-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// wildcardResolver resolves every random subdomain of the zones in wildcards to the zone's addresses
+type wildcardResolver struct {
+	*fakeResolver
+	wildcards map[string][]string
+}
+
+func (r *wildcardResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if i := strings.Index(host, "."); i > 0 && strings.HasPrefix(host, "certgraph-") {
+		atomic.AddInt32(&r.lookups, 1)
+		if addrs, ok := r.wildcards[host[i+1:]]; ok {
+			return addrs, nil
+		}
+		return nil, errNoSuchHost
+	}
+	return r.fakeResolver.LookupHost(ctx, host)
+}
+
+func TestIsWildcard(t *testing.T) {
+	r := &wildcardResolver{
+		fakeResolver: &fakeResolver{err: map[string]error{}},
+		wildcards: map[string][]string{
+			"example.com":     {"192.0.2.1", "192.0.2.2"},
+			"dev.example.org": {"192.0.2.3"},
+		},
+	}
+	defer useResolver(r)()
+	w := NewWildcardDetector(time.Second)
+
+	tests := []struct {
+		domain string
+		ips    []string
+		want   bool
+	}{
+		{"www.example.com", []string{"192.0.2.1"}, true},
+		{"WWW.Example.com.", []string{"192.0.2.2", "192.0.2.1"}, true},
+		// an address the wildcard doesn't return is a real record
+		{"mail.example.com", []string{"192.0.2.1", "198.51.100.1"}, false},
+		{"example.com", []string{"192.0.2.1"}, false},
+		{"a.dev.example.org", []string{"192.0.2.3"}, true},
+		{"www.example.org", []string{"192.0.2.3"}, false},
+		{"www.example.com", nil, false},
+	}
+	for _, test := range tests {
+		got, err := w.IsWildcard(test.domain, test.ips)
+		if err != nil {
+			t.Errorf("IsWildcard(%s) returned %v", test.domain, err)
+		}
+		if got != test.want {
+			t.Errorf("IsWildcard(%s, %v) = %v, want %v", test.domain, test.ips, got, test.want)
+		}
+	}
+	// example.com, dev.example.org, and example.org are each looked up once
+	if lookups := atomic.LoadInt32(&r.lookups); lookups != 3 {
+		t.Errorf("made %d wildcard lookups, want one for each of the 3 zones", lookups)
+	}
+}
+
+func TestIsWildcardError(t *testing.T) {
+	defer useResolver(&timeoutResolver{&fakeResolver{}})()
+
+	if _, err := NewWildcardDetector(time.Second).IsWildcard("www.example.com", []string{"192.0.2.1"}); err == nil {
+		t.Error("IsWildcard of a zone that timed out did not fail")
+	}
+}
+
+// timeoutResolver times out every host lookup
+type timeoutResolver struct {
+	*fakeResolver
+}
+
+func (r *timeoutResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return nil, errTimeout
+}
@@ -0,0 +1,167 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBatcherClosed is returned by the QueryDomain calls of a Batcher that was closed
+var ErrBatcherClosed = errors.New("batcher closed")
+
+// BatchDriver is implemented by drivers that can query multiple domains in a single request
+type BatchDriver interface {
+	Driver
+
+	// QueryDomains returns the Result for each of the domains, keyed by domain
+	// cancelling ctx aborts the query
+	QueryDomains(ctx context.Context, domains []string) (map[string]Result, error)
+
+	// BatchSize returns the maximum number of domains to query in a single QueryDomains call
+	// a BatchSize less than 2 disables batching
+	BatchSize() int
+}
+
+// batchRequest is a single domain waiting to be queried as part of a batch
+type batchRequest struct {
+	ctx    context.Context
+	domain string
+	result chan batchResult
+}
+
+// batchResult is the result of a batchRequest
+type batchResult struct {
+	result Result
+	err    error
+}
+
+// Batcher is a Driver that coalesces concurrent QueryDomain calls into QueryDomains calls to a BatchDriver
+type Batcher struct {
+	BatchDriver
+	wait      time.Duration
+	requests  chan *batchRequest
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Unwrap returns the driver being batched
+func (b *Batcher) Unwrap() Driver {
+	return b.BatchDriver
+}
+
+// NewBatcher returns a Batcher for the driver
+// a batch is queried once it is full, or wait after its first domain was requested
+func NewBatcher(d BatchDriver, wait time.Duration) *Batcher {
+	b := &Batcher{
+		BatchDriver: d,
+		wait:        wait,
+		requests:    make(chan *batchRequest),
+		done:        make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Close stops collecting batches, the batches already collected are still queried
+func (b *Batcher) Close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+}
+
+// QueryDomain adds the domain to the next batch and waits for its result, or for ctx to be cancelled
+func (b *Batcher) QueryDomain(ctx context.Context, domain string) (Result, error) {
+	select {
+	case <-b.done:
+		return nil, ErrBatcherClosed
+	default:
+	}
+	request := &batchRequest{ctx: ctx, domain: domain, result: make(chan batchResult, 1)}
+	select {
+	case b.requests <- request:
+	case <-b.done:
+		return nil, ErrBatcherClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case result := <-request.result:
+		return result.result, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run collects the requests into batches until the Batcher is closed
+func (b *Batcher) run() {
+	for {
+		var batch []*batchRequest
+		select {
+		case request := <-b.requests:
+			batch = append(batch, request)
+		case <-b.done:
+			return
+		}
+		timer := time.NewTimer(b.wait)
+	collect:
+		for len(batch) < b.BatchSize() {
+			select {
+			case request := <-b.requests:
+				batch = append(batch, request)
+			case <-timer.C:
+				break collect
+			case <-b.done:
+				break collect
+			}
+		}
+		timer.Stop()
+		go b.query(batch)
+	}
+}
+
+// batchContext returns a context that is cancelled once the contexts of every request in the batch are,
+// and a function to release it once the batch has been queried
+func batchContext(batch []*batchRequest) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for _, request := range batch {
+			select {
+			case <-request.ctx.Done():
+			case <-ctx.Done():
+				return
+			}
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// query queries the domains in the batch and sends each request its result
+// the query is only aborted if every request in the batch was cancelled
+func (b *Batcher) query(batch []*batchRequest) {
+	domains := make([]string, 0, len(batch))
+	seen := make(map[string]bool, len(batch))
+	for _, request := range batch {
+		if !seen[request.domain] {
+			seen[request.domain] = true
+			domains = append(domains, request.domain)
+		}
+	}
+	ctx, cancel := batchContext(batch)
+	defer cancel()
+	results, err := b.QueryDomains(ctx, domains)
+	for _, request := range batch {
+		if err != nil {
+			request.result <- batchResult{err: err}
+			continue
+		}
+		result, ok := results[request.domain]
+		if !ok {
+			request.result <- batchResult{err: fmt.Errorf("no batch result for %s", request.domain)}
+			continue
+		}
+		request.result <- batchResult{result: result}
+	}
+}
@@ -0,0 +1,230 @@
+package driver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/fingerprint"
+	"github.com/lanrat/certgraph/status"
+)
+
+// fakeResult is a Result with fixed fingerprints for a single domain
+type fakeResult struct {
+	domain       string
+	fingerprints FingerprintMap
+	certs        map[fingerprint.Fingerprint]*CertResult
+}
+
+// fakeFingerprint returns a fingerprint starting with b
+func fakeFingerprint(b byte) fingerprint.Fingerprint {
+	var fp fingerprint.Fingerprint
+	fp[0] = b
+	return fp
+}
+
+func newFakeResult(domain string, certs ...*CertResult) *fakeResult {
+	result := &fakeResult{
+		domain:       domain,
+		fingerprints: make(FingerprintMap),
+		certs:        make(map[fingerprint.Fingerprint]*CertResult),
+	}
+	for _, cert := range certs {
+		result.fingerprints.Add(domain, cert.Fingerprint)
+		result.certs[cert.Fingerprint] = cert
+	}
+	return result
+}
+
+func (r *fakeResult) GetStatus() status.Map {
+	return status.NewMap(r.domain, status.New(status.GOOD))
+}
+
+func (r *fakeResult) GetRelated() ([]string, error) {
+	return nil, nil
+}
+
+func (r *fakeResult) GetFingerprints() (FingerprintMap, error) {
+	return r.fingerprints, nil
+}
+
+func (r *fakeResult) QueryCert(fp fingerprint.Fingerprint) (*CertResult, error) {
+	return r.certs[fp], nil
+}
+
+// fakeBatchDriver records the batches it is queried with
+// each query blocks until release is closed, or its context is cancelled
+type fakeBatchDriver struct {
+	size    int
+	release chan struct{}
+
+	sync.Mutex
+	batches   [][]string
+	cancelled int
+}
+
+func (d *fakeBatchDriver) GetName() string {
+	return "fake"
+}
+
+func (d *fakeBatchDriver) BatchSize() int {
+	return d.size
+}
+
+func (d *fakeBatchDriver) QueryDomain(ctx context.Context, domain string) (Result, error) {
+	results, err := d.QueryDomains(ctx, []string{domain})
+	if err != nil {
+		return nil, err
+	}
+	return results[domain], nil
+}
+
+func (d *fakeBatchDriver) QueryDomains(ctx context.Context, domains []string) (map[string]Result, error) {
+	d.Lock()
+	d.batches = append(d.batches, domains)
+	d.Unlock()
+	select {
+	case <-d.release:
+	case <-ctx.Done():
+		d.Lock()
+		d.cancelled++
+		d.Unlock()
+		return nil, ctx.Err()
+	}
+	results := make(map[string]Result, len(domains))
+	for _, domain := range domains {
+		results[domain] = newFakeResult(domain)
+	}
+	return results, nil
+}
+
+func TestBatcherQueriesDomains(t *testing.T) {
+	d := &fakeBatchDriver{size: 3, release: make(chan struct{})}
+	close(d.release)
+	b := NewBatcher(d, 50*time.Millisecond)
+	defer b.Close()
+
+	domains := []string{"a.test", "b.test", "c.test", "d.test", "a.test"}
+	results := make([]Result, len(domains))
+	var wg sync.WaitGroup
+	for i, domain := range domains {
+		wg.Add(1)
+		go func(i int, domain string) {
+			defer wg.Done()
+			result, err := b.QueryDomain(context.Background(), domain)
+			if err != nil {
+				t.Errorf("QueryDomain(%s): %v", domain, err)
+				return
+			}
+			results[i] = result
+		}(i, domain)
+	}
+	wg.Wait()
+
+	for i, domain := range domains {
+		result, ok := results[i].(*fakeResult)
+		if !ok || result.domain != domain {
+			t.Errorf("QueryDomain(%s) returned the result for %v", domain, results[i])
+		}
+	}
+	queried := 0
+	for _, batch := range d.batches {
+		if len(batch) > d.size {
+			t.Errorf("batch %v is larger than the batch size %d", batch, d.size)
+		}
+		queried += len(batch)
+	}
+	// the duplicate a.test is only queried once if it shared a batch with the first
+	if queried < 4 || queried > len(domains) {
+		t.Errorf("queried %d domains in %v, want between 4 and %d", queried, d.batches, len(domains))
+	}
+}
+
+func TestBatcherContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel []bool // which requests of the batch are cancelled
+		want   bool   // whether the query is cancelled
+	}{
+		{"none cancelled", []bool{false, false}, false},
+		{"first cancelled", []bool{true, false}, false},
+		{"last cancelled", []bool{false, true}, false},
+		{"all cancelled", []bool{true, true}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &fakeBatchDriver{size: len(test.cancel), release: make(chan struct{})}
+			b := NewBatcher(d, time.Second)
+			defer b.Close()
+
+			var wg sync.WaitGroup
+			cancels := make([]context.CancelFunc, len(test.cancel))
+			errs := make([]error, len(test.cancel))
+			for i := range test.cancel {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				cancels[i] = cancel
+				wg.Add(1)
+				go func(i int, ctx context.Context) {
+					defer wg.Done()
+					_, errs[i] = b.QueryDomain(ctx, "domain.test")
+				}(i, ctx)
+			}
+			waitFor(t, func() bool {
+				d.Lock()
+				defer d.Unlock()
+				return len(d.batches) == 1
+			})
+			for i, cancel := range test.cancel {
+				if cancel {
+					cancels[i]()
+				}
+			}
+			// give a cancelled query time to return before releasing it
+			time.Sleep(20 * time.Millisecond)
+			close(d.release)
+			wg.Wait()
+
+			d.Lock()
+			cancelled := d.cancelled == 1
+			d.Unlock()
+			if cancelled != test.want {
+				t.Errorf("query cancelled = %v, want %v", cancelled, test.want)
+			}
+			for i, cancel := range test.cancel {
+				if !cancel && errs[i] != nil {
+					t.Errorf("request %d failed: %v", i, errs[i])
+				}
+				if cancel && errs[i] != context.Canceled {
+					t.Errorf("cancelled request %d returned %v, want %v", i, errs[i], context.Canceled)
+				}
+			}
+		})
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	d := &fakeBatchDriver{size: 2, release: make(chan struct{})}
+	close(d.release)
+	b := NewBatcher(d, time.Millisecond)
+	b.Close()
+	b.Close()
+
+	_, err := b.QueryDomain(context.Background(), "a.test")
+	if err != ErrBatcherClosed {
+		t.Errorf("QueryDomain after Close returned %v, want %v", err, ErrBatcherClosed)
+	}
+}
+
+// waitFor waits up to a second for done to return true
+func waitFor(t *testing.T, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,260 @@
+// Package censys implements a certgraph driver for searching the certificates
+// collected by Censys, from Certificate Transparency logs and internet wide scans
+// https://search.censys.io/api
+//
+// The API requires an API ID and secret, which are read from the CENSYS_API_ID and
+// CENSYS_API_SECRET environment variables, or from the id and secret driver options.
+package censys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/fingerprint"
+	"github.com/lanrat/certgraph/status"
+)
+
+const driverName = "censys"
+
+func init() {
+	driver.AddDriver(driverName)
+}
+
+// defaultAPIURL is the base URL of the Censys search API
+const defaultAPIURL = "https://search.censys.io/api"
+
+// number of certificates to request per page of search results, the most the API allows
+const perPage = 100
+
+// termEscaper escapes the characters reserved by the search language, so a domain can be used in an unquoted term
+var termEscaper = strings.NewReplacer(
+	`\`, `\\`, `+`, `\+`, `-`, `\-`, `=`, `\=`, `&`, `\&`, `|`, `\|`, `>`, `\>`, `<`, `\<`,
+	`!`, `\!`, `(`, `\(`, `)`, `\)`, `{`, `\{`, `}`, `\}`, `[`, `\[`, `]`, `\]`, `^`, `\^`,
+	`"`, `\"`, `~`, `\~`, `*`, `\*`, `?`, `\?`, `:`, `\:`, `/`, `\/`, ` `, `\ `,
+)
+
+type censysCT struct {
+	apiURL            string
+	id                string
+	secret            string
+	maxPages          int
+	client            *http.Client
+	includeExpired    bool
+	includeSubdomains bool
+	maxResponseSize   int64
+}
+
+type censysCertDriver struct {
+	host         string
+	fingerprints driver.FingerprintMap
+	certs        map[fingerprint.Fingerprint]*driver.CertResult
+	driver       *censysCT
+}
+
+// certificate is a certificate in the API's responses
+type certificate struct {
+	Fingerprint string   `json:"fingerprint_sha256"`
+	Names       []string `json:"names"`
+	Parsed      struct {
+		IssuerDN       string `json:"issuer_dn"`
+		ValidityPeriod struct {
+			NotBefore time.Time `json:"not_before"`
+			NotAfter  time.Time `json:"not_after"`
+		} `json:"validity_period"`
+	} `json:"parsed"`
+}
+
+// searchResponse is a single page of certificate search results
+type searchResponse struct {
+	Result struct {
+		Hits  []certificate `json:"hits"`
+		Links struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	} `json:"result"`
+}
+
+// certResponse is the response of a certificate lookup
+type certResponse struct {
+	Result certificate `json:"result"`
+}
+
+func (c *censysCertDriver) GetFingerprints() (driver.FingerprintMap, error) {
+	return c.fingerprints, nil
+}
+
+func (c *censysCertDriver) GetStatus() status.Map {
+	return status.NewMap(c.host, status.New(status.CT))
+}
+
+func (c *censysCertDriver) GetRelated() ([]string, error) {
+	return make([]string, 0), nil
+}
+
+// QueryCert returns the certificate from the search results, or looks it up if it was not in them
+func (c *censysCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
+	cert, found := c.certs[fp]
+	if found {
+		return cert, nil
+	}
+	return c.driver.QueryCert(fp)
+}
+
+// Driver creates a new CT driver for censys
+// responses larger than maxResponseSize bytes are an error, 0 has no limit
+// driver options id and secret set the API credentials, defaulting to the CENSYS_API_ID and CENSYS_API_SECRET environment variables
+// driver option pages sets the maximum number of result pages to get for a domain, defaults to 10
+// driver option url sets the base URL of the API, defaults to https://search.censys.io/api
+func Driver(timeout time.Duration, savePath string, includeSubdomains, includeExpired bool, maxResponseSize int64, opts *driver.Options) (driver.Driver, error) {
+	d := new(censysCT)
+	d.apiURL = strings.TrimSuffix(opts.Get("url", defaultAPIURL), "/")
+	d.id = opts.Get("id", os.Getenv("CENSYS_API_ID"))
+	d.secret = opts.Get("secret", os.Getenv("CENSYS_API_SECRET"))
+	if len(d.id) == 0 || len(d.secret) == 0 {
+		return nil, errors.New("censys driver requires an API ID and secret, set CENSYS_API_ID and CENSYS_API_SECRET")
+	}
+	var err error
+	d.maxPages, err = opts.Int("pages", 10)
+	if err != nil {
+		return nil, err
+	}
+	d.maxResponseSize = maxResponseSize
+	d.client = &http.Client{Timeout: timeout, Transport: driver.HTTPTransport()}
+	d.includeExpired = includeExpired
+	d.includeSubdomains = includeSubdomains
+
+	if len(savePath) > 0 {
+		return d, errors.New("censys driver does not support saving")
+	}
+
+	return d, nil
+}
+
+func (d *censysCT) GetName() string {
+	return driverName
+}
+
+// getJSON gets the JSON response of the API endpoint at path with the query and parses it into target
+func (d *censysCT) getJSON(ctx context.Context, path string, query url.Values, target interface{}) error {
+	u := d.apiURL + path
+	if len(query) > 0 {
+		u = u + "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(d.id, d.secret)
+	req.Header.Set("Accept", "application/json")
+	r, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("censys API unreachable: %w", err)
+	}
+	defer r.Body.Close()
+	switch r.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w on URL: %s", driver.ErrRateLimited, u)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("censys API rejected the credentials: '%s' on URL: %s", r.Status, u)
+	default:
+		return errors.New("Got non OK HTTP status: '" + r.Status + "' on URL: " + u)
+	}
+
+	respData, err := ioutil.ReadAll(driver.LimitReader(r.Body, d.maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("%w on URL: %s", err, u)
+	}
+	return json.Unmarshal(respData, target)
+}
+
+// searchQuery returns the search query for the certificates of domain
+func (d *censysCT) searchQuery(domain string) string {
+	query := fmt.Sprintf("names: %s", strconv.Quote(domain))
+	if d.includeSubdomains {
+		// the wildcard term is left unquoted so it matches every subdomain rather than only wildcard certificates,
+		// with the domain escaped so it can't change the query
+		query = fmt.Sprintf("(names: %s or names: *.%s)", strconv.Quote(domain), termEscaper.Replace(domain))
+	}
+	if !d.includeExpired {
+		query = fmt.Sprintf("%s and parsed.validity_period.not_after: [%s TO *]", query, time.Now().UTC().Format("2006-01-02"))
+	}
+	return query
+}
+
+func (d *censysCT) QueryDomain(ctx context.Context, domain string) (driver.Result, error) {
+	results := &censysCertDriver{
+		host:         domain,
+		fingerprints: make(driver.FingerprintMap),
+		certs:        make(map[fingerprint.Fingerprint]*driver.CertResult),
+		driver:       d,
+	}
+
+	query := url.Values{}
+	query.Set("q", d.searchQuery(domain))
+	query.Set("per_page", strconv.Itoa(perPage))
+
+	// iterate over the pages of results, each page links to the cursor of the next
+	for page := 1; page <= d.maxPages; page++ {
+		var resp searchResponse
+		err := d.getJSON(ctx, "/v2/certificates/search", query, &resp)
+		if err != nil {
+			return results, err
+		}
+		for _, hit := range resp.Result.Hits {
+			certResult, err := hit.certResult()
+			if err != nil {
+				return results, err
+			}
+			if _, found := results.certs[certResult.Fingerprint]; !found {
+				results.certs[certResult.Fingerprint] = certResult
+				results.fingerprints.Add(domain, certResult.Fingerprint)
+			}
+		}
+		if len(resp.Result.Links.Next) == 0 {
+			break
+		}
+		query.Set("cursor", resp.Result.Links.Next)
+	}
+
+	return results, nil
+}
+
+// QueryCert looks up the certificate with the fingerprint
+func (d *censysCT) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
+	var resp certResponse
+	err := d.getJSON(context.Background(), "/v2/certificates/"+strings.ToLower(fp.HexString()), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Result.certResult()
+}
+
+// certResult returns the CertResult of the certificate
+func (c *certificate) certResult() (*driver.CertResult, error) {
+	fp, err := fingerprint.FromHex(c.Fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate fingerprint %q: %w", c.Fingerprint, err)
+	}
+	certResult := &driver.CertResult{
+		Fingerprint: fp,
+		Domains:     make([]string, 0, len(c.Names)),
+		NotBefore:   c.Parsed.ValidityPeriod.NotBefore,
+		NotAfter:    c.Parsed.ValidityPeriod.NotAfter,
+		Issuer:      c.Parsed.IssuerDN,
+	}
+	for _, name := range c.Names {
+		certResult.Domains = append(certResult.Domains, strings.ToLower(name))
+	}
+	return certResult, nil
+}
@@ -0,0 +1,160 @@
+package censys
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+)
+
+func TestSearchQuery(t *testing.T) {
+	today := time.Now().UTC().Format("2006-01-02")
+	tests := []struct {
+		domain            string
+		includeSubdomains bool
+		includeExpired    bool
+		want              string
+	}{
+		{"example.com", false, true, `names: "example.com"`},
+		{"example.com", false, false, `names: "example.com" and parsed.validity_period.not_after: [` + today + ` TO *]`},
+		{"my-site.example.com", true, true, `(names: "my-site.example.com" or names: *.my\-site.example.com)`},
+		// a domain can't close the term and add its own clauses
+		{`x.com or names: *`, true, true, `(names: "x.com or names: *" or names: *.x.com\ or\ names\:\ \*)`},
+		{`x.com) or (names: y.com`, true, true, `(names: "x.com) or (names: y.com" or names: *.x.com\)\ or\ \(names\:\ y.com)`},
+		{`x.com" or "y`, false, true, `names: "x.com\" or \"y"`},
+	}
+	for _, test := range tests {
+		d := &censysCT{includeSubdomains: test.includeSubdomains, includeExpired: test.includeExpired}
+		if got := d.searchQuery(test.domain); got != test.want {
+			t.Errorf("searchQuery(%q) = %s, want %s", test.domain, got, test.want)
+		}
+	}
+}
+
+// hit returns a search result for the certificate with the fingerprint byte and names
+func hit(b byte, names ...string) certificate {
+	var cert certificate
+	cert.Fingerprint = strings.Repeat(string("0123456789abcdef"[b%16]), 64)
+	cert.Names = names
+	cert.Parsed.IssuerDN = "CN=Test CA"
+	return cert
+}
+
+func TestQueryDomain(t *testing.T) {
+	pages := map[string]searchResponse{}
+	var first, second searchResponse
+	first.Result.Hits = []certificate{hit(1, "Example.com", "www.example.com"), hit(2, "example.com")}
+	first.Result.Links.Next = "page2"
+	second.Result.Hits = []certificate{hit(2, "example.com"), hit(3, "example.com", "mail.example.com")}
+	pages[""] = first
+	pages["page2"] = second
+
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "id" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/certificates/search" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		queries = append(queries, r.URL.Query().Get("q"))
+		json.NewEncoder(w).Encode(pages[r.URL.Query().Get("cursor")])
+	}))
+	defer server.Close()
+
+	opts := driver.NewOptions()
+	opts.Set("censys.url=" + server.URL)
+	opts.Set("censys.id=id")
+	opts.Set("censys.secret=secret")
+	d, err := Driver(time.Second, "", false, true, 0, opts.Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := d.QueryDomain(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || queries[0] != `names: "example.com"` {
+		t.Errorf("queried %v, want 2 pages of the example.com query", queries)
+	}
+
+	fingerprints, err := result.GetFingerprints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fingerprints["example.com"]) != 3 {
+		t.Fatalf("found %d certificates, want the 3 distinct certificates of both pages", len(fingerprints["example.com"]))
+	}
+	cert, err := result.QueryCert(fingerprints["example.com"][0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Domains) != 2 || cert.Domains[0] != "example.com" || cert.Issuer != "CN=Test CA" {
+		t.Errorf("QueryCert returned %v", cert)
+	}
+
+	// rejected credentials are an error rather than no results
+	opts.Set("censys.secret=wrong")
+	d, err = Driver(time.Second, "", false, true, 0, opts.Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.QueryDomain(context.Background(), "example.com"); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("QueryDomain with the wrong secret returned %v, want a credentials error", err)
+	}
+}
+
+// TestCensysAPI queries the real API, it only runs if CENSYS_API_ID and CENSYS_API_SECRET are set
+func TestCensysAPI(t *testing.T) {
+	if len(os.Getenv("CENSYS_API_ID")) == 0 || len(os.Getenv("CENSYS_API_SECRET")) == 0 {
+		t.Skip("CENSYS_API_ID and CENSYS_API_SECRET are not set")
+	}
+	d, err := Driver(30*time.Second, "", true, false, 50<<20, driver.NewOptions().Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := d.QueryDomain(context.Background(), "censys.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprints, err := result.GetFingerprints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fingerprints["censys.io"]) == 0 {
+		t.Error("found no certificates for censys.io")
+	}
+}
+
+func TestQueryDomainTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response searchResponse
+		for i := 0; i < 100; i++ {
+			response.Result.Hits = append(response.Result.Hits, hit(byte(i), "example.com"))
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	opts := driver.NewOptions()
+	opts.Set("censys.url=" + server.URL)
+	opts.Set("censys.id=id")
+	opts.Set("censys.secret=secret")
+	d, err := Driver(time.Second, "", false, true, 1024, opts.Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.QueryDomain(context.Background(), "example.com"); !errors.Is(err, driver.ErrResponseTooLarge) {
+		t.Errorf("QueryDomain of a response larger than the maximum returned %v, want %v", err, driver.ErrResponseTooLarge)
+	}
+}
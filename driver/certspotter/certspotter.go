@@ -0,0 +1,240 @@
+// Package certspotter implements a certgraph driver for searching the certificate
+// issuances found in Certificate Transparency logs by SSLMate's Cert Spotter
+// https://sslmate.com/help/reference/ct_search_api_v1
+//
+// The API can be used without an account with a low rate limit, an API key raises the limit and
+// is read from the CERTSPOTTER_API_KEY environment variable, or from the key driver option.
+package certspotter
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/fingerprint"
+	"github.com/lanrat/certgraph/status"
+)
+
+const driverName = "certspotter"
+
+func init() {
+	driver.AddDriver(driverName)
+}
+
+// defaultAPIURL is the base URL of the Cert Spotter API
+const defaultAPIURL = "https://api.certspotter.com"
+
+type certspotterCT struct {
+	apiURL            string
+	key               string
+	maxPages          int
+	client            *http.Client
+	includeExpired    bool
+	includeSubdomains bool
+	maxResponseSize   int64
+	save              bool
+	savePath          string
+}
+
+type certspotterCertDriver struct {
+	host         string
+	fingerprints driver.FingerprintMap
+	certs        map[fingerprint.Fingerprint]*driver.CertResult
+}
+
+// issuance is a certificate issuance in the API's responses
+type issuance struct {
+	ID         string    `json:"id"`
+	CertSHA256 string    `json:"cert_sha256"`
+	DNSNames   []string  `json:"dns_names"`
+	NotBefore  time.Time `json:"not_before"`
+	NotAfter   time.Time `json:"not_after"`
+	Issuer     struct {
+		Name string `json:"name"`
+	} `json:"issuer"`
+	Cert struct {
+		Data string `json:"data"`
+	} `json:"cert"`
+}
+
+func (c *certspotterCertDriver) GetFingerprints() (driver.FingerprintMap, error) {
+	return c.fingerprints, nil
+}
+
+func (c *certspotterCertDriver) GetStatus() status.Map {
+	return status.NewMap(c.host, status.New(status.CT))
+}
+
+func (c *certspotterCertDriver) GetRelated() ([]string, error) {
+	return make([]string, 0), nil
+}
+
+// QueryCert returns the certificate from the issuances of the domain
+func (c *certspotterCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
+	cert, found := c.certs[fp]
+	if found {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("certificate with Fingerprint %s not found", fp.HexString())
+}
+
+// Driver creates a new CT driver for certspotter
+// responses larger than maxResponseSize bytes are an error, 0 has no limit
+// driver option key sets the API key, defaulting to the CERTSPOTTER_API_KEY environment variable
+// driver option pages sets the maximum number of result pages to get for a domain, defaults to 10
+// driver option url sets the base URL of the API, defaults to https://api.certspotter.com
+func Driver(timeout time.Duration, savePath string, includeSubdomains, includeExpired bool, maxResponseSize int64, opts *driver.Options) (driver.Driver, error) {
+	d := new(certspotterCT)
+	d.apiURL = strings.TrimSuffix(opts.Get("url", defaultAPIURL), "/")
+	d.key = opts.Get("key", os.Getenv("CERTSPOTTER_API_KEY"))
+	var err error
+	d.maxPages, err = opts.Int("pages", 10)
+	if err != nil {
+		return nil, err
+	}
+	d.maxResponseSize = maxResponseSize
+	d.client = &http.Client{Timeout: timeout, Transport: driver.HTTPTransport()}
+	d.includeExpired = includeExpired
+	d.includeSubdomains = includeSubdomains
+
+	if len(savePath) > 0 {
+		d.save = true
+		d.savePath = savePath
+	}
+
+	return d, nil
+}
+
+func (d *certspotterCT) GetName() string {
+	return driverName
+}
+
+// getIssuances gets a single page of the issuances matching the query
+func (d *certspotterCT) getIssuances(ctx context.Context, query url.Values) ([]issuance, error) {
+	u := d.apiURL + "/v1/issuances?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.key) > 0 {
+		req.Header.Set("Authorization", "Bearer "+d.key)
+	}
+	req.Header.Set("Accept", "application/json")
+	r, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("certspotter API unreachable: %w", err)
+	}
+	defer r.Body.Close()
+	switch r.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		if retryAfter := r.Header.Get("Retry-After"); len(retryAfter) > 0 {
+			return nil, fmt.Errorf("%w, retry after %s seconds, on URL: %s", driver.ErrRateLimited, retryAfter, u)
+		}
+		return nil, fmt.Errorf("%w on URL: %s", driver.ErrRateLimited, u)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("certspotter API rejected the API key: '%s' on URL: %s", r.Status, u)
+	default:
+		return nil, errors.New("Got non OK HTTP status: '" + r.Status + "' on URL: " + u)
+	}
+
+	respData, err := ioutil.ReadAll(driver.LimitReader(r.Body, d.maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w on URL: %s", err, u)
+	}
+	var issuances []issuance
+	err = json.Unmarshal(respData, &issuances)
+	return issuances, err
+}
+
+func (d *certspotterCT) QueryDomain(ctx context.Context, domain string) (driver.Result, error) {
+	results := &certspotterCertDriver{
+		host:         domain,
+		fingerprints: make(driver.FingerprintMap),
+		certs:        make(map[fingerprint.Fingerprint]*driver.CertResult),
+	}
+
+	query := url.Values{}
+	query.Set("domain", domain)
+	query["expand"] = []string{"dns_names", "issuer", "cert"}
+	if d.includeSubdomains {
+		query.Set("include_subdomains", "true")
+	}
+
+	// iterate over the pages of results, each page continues after the id of the last issuance of the previous page
+	now := time.Now()
+	for page := 1; page <= d.maxPages; page++ {
+		issuances, err := d.getIssuances(ctx, query)
+		if err != nil {
+			return results, err
+		}
+		for _, issuance := range issuances {
+			if !d.includeExpired && now.After(issuance.NotAfter) {
+				continue
+			}
+			certResult, der, err := issuance.certResult()
+			if err != nil {
+				return results, err
+			}
+			if _, found := results.certs[certResult.Fingerprint]; !found {
+				results.certs[certResult.Fingerprint] = certResult
+				results.fingerprints.Add(domain, certResult.Fingerprint)
+				// only the certificates included in the issuance can be saved
+				if d.save && der != nil {
+					err = driver.RawCertToPEMFile(der, path.Join(d.savePath, certResult.Fingerprint.HexString())+".pem")
+					if err != nil {
+						return results, err
+					}
+				}
+			}
+		}
+		if len(issuances) == 0 {
+			break
+		}
+		query.Set("after", issuances[len(issuances)-1].ID)
+	}
+
+	return results, nil
+}
+
+// certResult returns the CertResult of the issuance, and the DER of its certificate if it was included
+// the certificate is parsed when it was included so the fingerprint and details match those of the other drivers
+func (i *issuance) certResult() (*driver.CertResult, []byte, error) {
+	if len(i.Cert.Data) > 0 {
+		der, err := base64.StdEncoding.DecodeString(i.Cert.Data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid certificate data of issuance %s: %w", i.ID, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err == nil {
+			return driver.NewCertResult(cert), der, nil
+		}
+	}
+
+	fp, err := fingerprint.FromHex(i.CertSHA256)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate fingerprint %q: %w", i.CertSHA256, err)
+	}
+	certResult := &driver.CertResult{
+		Fingerprint: fp,
+		Domains:     make([]string, 0, len(i.DNSNames)),
+		NotBefore:   i.NotBefore,
+		NotAfter:    i.NotAfter,
+		Issuer:      i.Issuer.Name,
+	}
+	for _, name := range i.DNSNames {
+		certResult.Domains = append(certResult.Domains, strings.ToLower(name))
+	}
+	return certResult, nil, nil
+}
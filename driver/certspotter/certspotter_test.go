@@ -0,0 +1,234 @@
+package certspotter
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+// testIssuance returns an issuance of the certificate with the fingerprint byte, valid until notAfter
+func testIssuance(id string, b byte, notAfter time.Time, names ...string) issuance {
+	var i issuance
+	i.ID = id
+	i.CertSHA256 = strings.Repeat(string("0123456789abcdef"[b%16]), 64)
+	i.DNSNames = names
+	i.NotBefore = notAfter.AddDate(-1, 0, 0)
+	i.NotAfter = notAfter
+	i.Issuer.Name = "CN=Test CA"
+	return i
+}
+
+// testCertData returns the base64 DER of a self signed certificate for the domain
+func testCertData(t *testing.T, domain string) (string, fingerprint.Fingerprint) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(der), fingerprint.FromBytes(der)
+}
+
+// newTestDriver returns a certspotter driver using the API at url
+func newTestDriver(t *testing.T, apiURL string, includeSubdomains, includeExpired bool, options ...string) driver.Driver {
+	t.Helper()
+	opts := driver.NewOptions()
+	opts.Set("certspotter.url=" + apiURL)
+	opts.Set("certspotter.key=key")
+	for _, option := range options {
+		opts.Set("certspotter." + option)
+	}
+	d, err := Driver(time.Second, "", includeSubdomains, includeExpired, 0, opts.Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestQueryDomain(t *testing.T) {
+	future := time.Now().AddDate(1, 0, 0)
+	past := time.Now().AddDate(-1, 0, 0)
+	certData, certFP := testCertData(t, "parsed.example.com")
+	parsed := testIssuance("3", 4, future, "ignored.example.com")
+	parsed.Cert.Data = certData
+	// each page continues after the id of the last issuance of the previous page
+	pages := map[string][]issuance{
+		"":  {testIssuance("1", 1, future, "Example.com", "www.example.com"), testIssuance("2", 2, past, "example.com")},
+		"2": {testIssuance("2b", 1, future, "example.com"), parsed},
+		"3": {},
+	}
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		queries = append(queries, r.URL.Query())
+		json.NewEncoder(w).Encode(pages[r.URL.Query().Get("after")])
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name              string
+		includeSubdomains bool
+		includeExpired    bool
+		options           []string
+		want              int
+		wantQueries       int
+	}{
+		{"current", false, false, nil, 2, 3},
+		{"expired", false, true, nil, 3, 3},
+		{"subdomains", true, false, nil, 2, 3},
+		{"max pages", false, true, []string{"pages=1"}, 2, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queries = nil
+			d := newTestDriver(t, server.URL, test.includeSubdomains, test.includeExpired, test.options...)
+			result, err := d.QueryDomain(context.Background(), "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(queries) != test.wantQueries {
+				t.Errorf("made %d queries, want %d", len(queries), test.wantQueries)
+			}
+			if len(queries) > 0 {
+				query := queries[0]
+				if query.Get("domain") != "example.com" || (query.Get("include_subdomains") == "true") != test.includeSubdomains {
+					t.Errorf("queried %v", query)
+				}
+			}
+			fingerprints, _ := result.GetFingerprints()
+			if len(fingerprints["example.com"]) != test.want {
+				t.Errorf("found %d certificates, want %d", len(fingerprints["example.com"]), test.want)
+			}
+		})
+	}
+
+	// certificates included in the issuance are parsed, the others use the issuance's details
+	result, err := newTestDriver(t, server.URL, false, false).QueryDomain(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := result.QueryCert(certFP)
+	if err != nil || len(cert.Domains) != 1 || cert.Domains[0] != "parsed.example.com" {
+		t.Errorf("QueryCert of the parsed certificate returned %v, %v", cert, err)
+	}
+	fp, _ := fingerprint.FromHex(strings.Repeat("1", 64))
+	cert, err = result.QueryCert(fp)
+	if err != nil || strings.Join(cert.Domains, " ") != "example.com www.example.com" || cert.Issuer != "CN=Test CA" {
+		t.Errorf("QueryCert of the issuance returned %v, %v", cert, err)
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certData, certFP := testCertData(t, "example.com")
+	parsed := testIssuance("1", 1, time.Now().AddDate(1, 0, 0), "example.com")
+	parsed.Cert.Data = certData
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Query().Get("after")) > 0 {
+			w.Write([]byte("[]"))
+			return
+		}
+		json.NewEncoder(w).Encode([]issuance{parsed, testIssuance("2", 2, time.Now().AddDate(1, 0, 0), "example.com")})
+	}))
+	defer server.Close()
+
+	opts := driver.NewOptions()
+	opts.Set("url=" + server.URL)
+	d, err := Driver(time.Second, dir, false, false, 0, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.QueryDomain(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the certificate included in its issuance can be saved
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != certFP.HexString()+".pem" {
+		t.Fatalf("saved %v, want only %s.pem", files, certFP.HexString())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" || base64.StdEncoding.EncodeToString(block.Bytes) != certData {
+		t.Errorf("saved %q, want the PEM of the issuance's certificate", data)
+	}
+}
+
+func TestQueryDomainErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		body   string
+		want   string
+		is     error
+	}{
+		{"rate limited", http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}, "", "retry after 30 seconds", driver.ErrRateLimited},
+		{"bad key", http.StatusUnauthorized, nil, "", "rejected the API key", nil},
+		{"server error", http.StatusInternalServerError, nil, "", "non OK HTTP status", nil},
+		{"bad fingerprint", http.StatusOK, nil, `[{"id": "1", "cert_sha256": "xyz", "not_after": "2100-01-01T00:00:00Z"}]`, "invalid certificate fingerprint", nil},
+		{"bad json", http.StatusOK, nil, `{`, "unexpected end of JSON input", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, value := range test.header {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			_, err := newTestDriver(t, server.URL, false, false).QueryDomain(context.Background(), "example.com")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("QueryDomain returned %v, want an error containing %q", err, test.want)
+			}
+			if test.is != nil && !errors.Is(err, test.is) {
+				t.Errorf("QueryDomain returned %v, want %v", err, test.is)
+			}
+		})
+	}
+}
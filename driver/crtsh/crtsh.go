@@ -10,15 +10,18 @@ package crtsh
 // TODO running in verbose gives error: pq: unnamed prepared statement does not exist
 
 import (
+	"context"
+	"crypto/x509"
 	"database/sql"
 	"fmt"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/lanrat/certgraph/driver"
 	"github.com/lanrat/certgraph/fingerprint"
 	"github.com/lanrat/certgraph/status"
-	_ "github.com/lib/pq" // portgresql
+	"github.com/lib/pq" // portgresql
 )
 
 const connStr = "postgresql://guest@crt.sh/certwatch?sslmode=disable"
@@ -31,6 +34,7 @@ func init() {
 type crtsh struct {
 	db                *sql.DB
 	queryLimit        int
+	batchSize         int
 	timeout           time.Duration
 	save              bool
 	savePath          string
@@ -61,12 +65,21 @@ func (c *crtshCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertRes
 }
 
 // Driver creates a new CT driver for crt.sh
-func Driver(maxQueryResults int, timeout time.Duration, savePath string, includeSubdomains, includeExpired bool) (driver.Driver, error) {
+// driver option limit sets the maximum number of certificates to return for a domain, defaults to 1000
+// driver option batch sets the maximum number of concurrent domain queries to combine into one, defaults to 20
+func Driver(timeout time.Duration, savePath string, includeSubdomains, includeExpired bool, opts *driver.Options) (driver.Driver, error) {
 	d := new(crtsh)
-	d.queryLimit = maxQueryResults
+	var err error
+	d.queryLimit, err = opts.Int("limit", 1000)
+	if err != nil {
+		return nil, err
+	}
+	d.batchSize, err = opts.Int("batch", 20)
+	if err != nil {
+		return nil, err
+	}
 	d.includeSubdomains = includeSubdomains
 	d.includeExpired = includeExpired
-	var err error
 
 	if len(savePath) > 0 {
 		d.save = true
@@ -77,6 +90,7 @@ func Driver(maxQueryResults int, timeout time.Duration, savePath string, include
 	if err != nil {
 		return nil, err
 	}
+	d.db.SetMaxOpenConns(driver.MaxConnsPerHost())
 
 	err = d.setSQLTimeout(d.timeout.Seconds())
 
@@ -92,25 +106,63 @@ func (d *crtsh) setSQLTimeout(sec float64) error {
 	return err
 }
 
-func (d *crtsh) QueryDomain(domain string) (driver.Result, error) {
+func (d *crtsh) QueryDomain(ctx context.Context, domain string) (driver.Result, error) {
 	results := &crtshCertDriver{
 		host:         domain,
 		fingerprints: make(driver.FingerprintMap),
 		driver:       d,
 	}
 
-	queryStr := ""
+	queryStr := d.domainQuery()
+	queryDomain := domain
+	if d.includeSubdomains {
+		queryDomain = fmt.Sprintf("%%.%s", domain)
+	}
 
+	try := 0
+	var err error
+	var rows *sql.Rows
+	for try < 5 {
+		// this is a hack while crt.sh gets there stuff togeather
+		try++
+		rows, err = d.db.QueryContext(ctx, queryStr, queryDomain, d.queryLimit)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	/*if try > 1 {
+		fmt.Println("QueryDomain try ", try)
+	}*/
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash []byte
+		err = rows.Scan(&hash)
+		if err != nil {
+			return results, err
+		}
+		results.fingerprints.Add(domain, fingerprint.FromHashBytes(hash))
+	}
+
+	return results, rows.Err()
+}
+
+// domainQuery returns the SQL query for the certificates of the domain $1, limited to $2 results
+// every result is returned by the one query, so there are no pages to fetch
+func (d *crtsh) domainQuery() string {
 	if d.includeSubdomains {
 		if d.includeExpired {
-			queryStr = `SELECT digest(certificate.certificate, 'sha256') sha256
+			return `SELECT digest(certificate.certificate, 'sha256') sha256
 					FROM certificate_identity, certificate
 					WHERE certificate.id = certificate_identity.certificate_id
 					AND (reverse(lower(certificate_identity.name_value)) LIKE reverse(lower('%%.'||$1))
                 	OR reverse(lower(certificate_identity.name_value)) LIKE reverse(lower($1)))
 					LIMIT $2`
 		} else {
-			queryStr = `SELECT digest(certificate.certificate, 'sha256') sha256
+			return `SELECT digest(certificate.certificate, 'sha256') sha256
 					FROM certificate_identity, certificate
 					WHERE certificate.id = certificate_identity.certificate_id
 					AND x509_notAfter(certificate.certificate) > statement_timestamp()
@@ -120,13 +172,13 @@ func (d *crtsh) QueryDomain(domain string) (driver.Result, error) {
 		}
 	} else {
 		if d.includeExpired {
-			queryStr = `SELECT digest(certificate.certificate, 'sha256') sha256
+			return `SELECT digest(certificate.certificate, 'sha256') sha256
 					FROM certificate_identity, certificate
 					WHERE certificate.id = certificate_identity.certificate_id
 					AND reverse(lower(certificate_identity.name_value)) LIKE reverse(lower($1))
 					LIMIT $2`
 		} else {
-			queryStr = `SELECT digest(certificate.certificate, 'sha256') sha256
+			return `SELECT digest(certificate.certificate, 'sha256') sha256
 					FROM certificate_identity, certificate
 					WHERE certificate.id = certificate_identity.certificate_id
 					AND x509_notAfter(certificate.certificate) > statement_timestamp()
@@ -134,51 +186,92 @@ func (d *crtsh) QueryDomain(domain string) (driver.Result, error) {
 					LIMIT $2`
 		}
 	}
+}
 
-	if d.includeSubdomains {
-		domain = fmt.Sprintf("%%.%s", domain)
+// QueryDomains returns the certificates for each of the domains using a single query
+func (d *crtsh) QueryDomains(ctx context.Context, domains []string) (map[string]driver.Result, error) {
+	results := make(map[string]driver.Result, len(domains))
+	queryDomains := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		results[domain] = &crtshCertDriver{
+			host:         domain,
+			fingerprints: make(driver.FingerprintMap),
+			driver:       d,
+		}
+		if d.includeSubdomains {
+			queryDomains = append(queryDomains, fmt.Sprintf("%%.%s", domain))
+		} else {
+			queryDomains = append(queryDomains, domain)
+		}
 	}
 
+	// run the single domain query for each domain, keeping its per domain limit
+	queryStr := `SELECT batch.n, c.sha256
+				FROM unnest($1::text[]) WITH ORDINALITY batch(domain, n)
+				CROSS JOIN LATERAL (` + strings.Replace(d.domainQuery(), "$1", "batch.domain", -1) + `) c`
+
 	try := 0
 	var err error
 	var rows *sql.Rows
 	for try < 5 {
 		// this is a hack while crt.sh gets there stuff togeather
 		try++
-		rows, err = d.db.Query(queryStr, domain, d.queryLimit)
-		if err == nil {
+		rows, err = d.db.QueryContext(ctx, queryStr, pq.Array(queryDomains), d.queryLimit)
+		if err == nil || ctx.Err() != nil {
 			break
 		}
 	}
-	/*if try > 1 {
-		fmt.Println("QueryDomain try ", try)
-	}*/
 	if err != nil {
 		return results, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
+		var n int
 		var hash []byte
-		err = rows.Scan(&hash)
+		err = rows.Scan(&n, &hash)
 		if err != nil {
 			return results, err
 		}
-		results.fingerprints.Add(domain, fingerprint.FromHashBytes(hash))
+		if n < 1 || n > len(domains) {
+			return results, fmt.Errorf("crtsh: unexpected batch index %d", n)
+		}
+		domain := domains[n-1]
+		results[domain].(*crtshCertDriver).fingerprints.Add(domain, fingerprint.FromHashBytes(hash))
 	}
 
-	return results, nil
+	return results, rows.Err()
 }
 
-func (d *crtsh) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
-	certNode := new(driver.CertResult)
-	certNode.Fingerprint = fp
-	certNode.Domains = make([]string, 0, 5)
+// BatchSize returns the maximum number of domains to query at once
+func (d *crtsh) BatchSize() int {
+	return d.batchSize
+}
+
+// QueryOrganization returns up to limit domains from the certificates whose subject organizationName is org
+func (d *crtsh) QueryOrganization(ctx context.Context, org string, limit int) ([]string, error) {
+	domains := make([]string, 0, 5)
 
-	queryStr := `SELECT DISTINCT certificate_identity.name_value
-				FROM certificate, certificate_identity
-				WHERE certificate.id = certificate_identity.certificate_id
-				AND certificate_identity.name_type in ('dNSName', 'commonName')
-				AND digest(certificate.certificate, 'sha256') = $1`
+	queryStr := ""
+	if d.includeExpired {
+		queryStr = `SELECT DISTINCT san.name_value
+				FROM certificate_identity org, certificate_identity san
+				WHERE org.name_type = 'organizationName'
+				AND reverse(lower(org.name_value)) = reverse(lower($1))
+				AND san.certificate_id = org.certificate_id
+				AND san.name_type = 'dNSName'
+				LIMIT $2`
+	} else {
+		queryStr = `SELECT DISTINCT san.name_value
+				FROM certificate_identity org, certificate_identity san, certificate
+				WHERE org.name_type = 'organizationName'
+				AND reverse(lower(org.name_value)) = reverse(lower($1))
+				AND certificate.id = org.certificate_id
+				AND x509_notAfter(certificate.certificate) > statement_timestamp()
+				AND san.certificate_id = org.certificate_id
+				AND san.name_type = 'dNSName'
+				LIMIT $2`
+	}
 
 	try := 0
 	var err error
@@ -186,38 +279,66 @@ func (d *crtsh) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error
 	for try < 5 {
 		// this is a hack while crt.sh gets there stuff togeather
 		try++
-		rows, err = d.db.Query(queryStr, fp[:])
-		if err == nil {
+		rows, err = d.db.QueryContext(ctx, queryStr, org, limit)
+		if err == nil || ctx.Err() != nil {
 			break
 		}
 	}
-	/*if try > 1 {
-		fmt.Println("QueryCert try ", try)
-	}*/
 	if err != nil {
-		return certNode, err
+		return domains, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var domain string
 		err = rows.Scan(&domain)
 		if err != nil {
-			return nil, err
+			return domains, err
 		}
-		certNode.Domains = append(certNode.Domains, domain)
+		domains = append(domains, strings.ToLower(domain))
 	}
 
-	if d.save {
-		var rawCert []byte
-		queryStr = `SELECT certificate.certificate
-					FROM certificate
-					WHERE digest(certificate.certificate, 'sha256') = $1`
-		row := d.db.QueryRow(queryStr, fp[:])
-		err = row.Scan(&rawCert)
-		if err != nil {
-			return certNode, err
+	return domains, rows.Err()
+}
+
+func (d *crtsh) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
+	certNode := new(driver.CertResult)
+	certNode.Fingerprint = fp
+	certNode.Domains = make([]string, 0, 5)
+
+	queryStr := `SELECT certificate.certificate,
+				ARRAY(SELECT DISTINCT certificate_identity.name_value
+					FROM certificate_identity
+					WHERE certificate_identity.certificate_id = certificate.id
+					AND certificate_identity.name_type in ('dNSName', 'commonName'))
+				FROM certificate
+				WHERE digest(certificate.certificate, 'sha256') = $1`
+
+	try := 0
+	var err error
+	var rawCert []byte
+	var domains []string
+	for try < 5 {
+		// this is a hack while crt.sh gets there stuff togeather
+		try++
+		err = d.db.QueryRow(queryStr, fp[:]).Scan(&rawCert, pq.Array(&domains))
+		if err == nil || err == sql.ErrNoRows {
+			break
 		}
+	}
+	if err != nil {
+		return certNode, err
+	}
 
+	// the details of the certificate come from the certificate itself, the domains from crt.sh's identities
+	cert, err := x509.ParseCertificate(rawCert)
+	if err == nil {
+		certNode = driver.NewCertResult(cert)
+		certNode.Domains = make([]string, 0, len(domains))
+	}
+	certNode.Domains = append(certNode.Domains, domains...)
+
+	if d.save {
 		err = driver.RawCertToPEMFile(rawCert, path.Join(d.savePath, fp.HexString())+".pem")
 		if err != nil {
 			return certNode, err
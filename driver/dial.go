@@ -0,0 +1,102 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// DialFunc dials a connection to addr on the named network
+type DialFunc func(network, addr string) (net.Conn, error)
+
+// dial is used by the live drivers to connect to the domains, nil dials directly
+var dial DialFunc
+
+// SetDial sets the function the live drivers use to connect to the domains, such as through a tunnel
+// nil dials directly, should be called before any drivers are created
+func SetDial(d DialFunc) {
+	dial = d
+}
+
+// Dial connects to addr on the named network with the function set by SetDial, giving up after timeout
+func Dial(network, addr string, timeout time.Duration) (net.Conn, error) {
+	return DialContext(context.Background(), network, addr, timeout)
+}
+
+// DialContext is Dial, also giving up if ctx is cancelled
+func DialContext(ctx context.Context, network, addr string, timeout time.Duration) (net.Conn, error) {
+	if dial == nil {
+		dialer := &net.Dialer{Timeout: timeout}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	if timeout <= 0 && ctx.Done() == nil {
+		return dial(network, addr)
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	result := make(chan dialResult, 1)
+	go func() {
+		conn, err := dial(network, addr)
+		result <- dialResult{conn, err}
+	}()
+	// close the connection if it is made after giving up on it
+	abandon := func() {
+		go func() {
+			r := <-result
+			if r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+	}
+	select {
+	case r := <-result:
+		return r.conn, r.err
+	case <-expired:
+		abandon()
+		return nil, &net.OpError{Op: "dial", Net: network, Err: timeoutError(fmt.Sprintf("dial %s timed out after %s", addr, timeout))}
+	case <-ctx.Done():
+		abandon()
+		return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+	}
+}
+
+// CloseOnCancel closes conn if ctx is cancelled before the returned stop function is called
+// this aborts any reads and writes in progress on conn
+func CloseOnCancel(ctx context.Context, conn net.Conn) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// both are ready if ctx was cancelled after stop, before this goroutine ran
+			select {
+			case <-stopped:
+			default:
+				conn.Close()
+			}
+		case <-stopped:
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(stopped) }) }
+}
+
+// timeoutError is a net.Error for dials that timed out
+type timeoutError string
+
+func (e timeoutError) Error() string   { return string(e) }
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return true }
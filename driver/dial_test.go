@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// useDial sets the dial function until the returned function is called
+func useDial(d DialFunc) func() {
+	previous := dial
+	SetDial(d)
+	return func() {
+		SetDial(previous)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	release := make(chan struct{})
+	closed := make(chan struct{})
+	dialed := make(chan string, 10)
+	defer useDial(func(network, addr string) (net.Conn, error) {
+		dialed <- addr
+		client, server := net.Pipe()
+		server.Close()
+		if addr == "slow:443" {
+			<-release
+			return closeNotifier{client, closed}, nil
+		}
+		return client, nil
+	})()
+
+	conn, err := Dial("tcp", "fast:443", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if addr := <-dialed; addr != "fast:443" {
+		t.Errorf("dialed %s, want the address through the dial function", addr)
+	}
+
+	_, err = Dial("tcp", "slow:443", 10*time.Millisecond)
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("Dial that took longer than the timeout returned %v, want a timeout", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = DialContext(ctx, "tcp", "slow:443", time.Second); err == nil {
+		t.Error("DialContext with a cancelled context did not fail")
+	}
+
+	// the connections given up on are closed once they are made
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatal("a connection made after giving up on it was not closed")
+		}
+	}
+}
+
+// closeNotifier is a net.Conn that signals closed when it is closed
+type closeNotifier struct {
+	net.Conn
+	closed chan struct{}
+}
+
+func (c closeNotifier) Close() error {
+	c.closed <- struct{}{}
+	return c.Conn.Close()
+}
+
+func TestCloseOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client, server := net.Pipe()
+	defer server.Close()
+	CloseOnCancel(ctx, client)
+	cancel()
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.ErrClosedPipe {
+		t.Errorf("Read after cancelling returned %v, want the connection to be closed", err)
+	}
+
+	// stopped before the context is cancelled
+	ctx, cancel = context.WithCancel(context.Background())
+	client, server = net.Pipe()
+	defer server.Close()
+	stop := CloseOnCancel(ctx, client)
+	stop()
+	stop()
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	go server.Write([]byte{1})
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != nil {
+		t.Errorf("Read after stopping returned %v, want the connection to stay open", err)
+	}
+}
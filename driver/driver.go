@@ -2,16 +2,17 @@
 package driver
 
 import (
+	"context"
 	"crypto/x509"
+	"math/big"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/lanrat/certgraph/fingerprint"
 	"github.com/lanrat/certgraph/status"
 )
 
-// TODO add context instead of timeout on all requests
-
 // Drivers contains all the drivers that have been registered
 var Drivers []string
 
@@ -25,12 +26,19 @@ type Driver interface {
 	// QueryDomain is the main entrypoint for Driver Searching
 	// The domain provided will return a CertDriver instance which can be used to query the
 	// certificates for the provided domain using the driver
-	QueryDomain(domain string) (Result, error)
+	// cancelling ctx aborts the query
+	QueryDomain(ctx context.Context, domain string) (Result, error)
 
 	// GetName returns the name of the driver
 	GetName() string
 }
 
+// OrganizationDriver is implemented by drivers that can search for certificates by their subject organization
+type OrganizationDriver interface {
+	// QueryOrganization returns up to limit domains from the certificates issued to the organization
+	QueryOrganization(ctx context.Context, org string, limit int) ([]string, error)
+}
+
 // Result is a sub-driver that allows querying certificate details from a previously queried domain
 type Result interface {
 	// GetStatus returns the status of the initial domain queried with the Driver.QueryDomain call
@@ -44,9 +52,16 @@ type Result interface {
 	GetFingerprints() (FingerprintMap, error)
 
 	// QueryCert returns the details of the provided certificate or an error if not found
+	// it must be safe for concurrent use, as the certificates of a domain are looked up in parallel
 	QueryCert(fp fingerprint.Fingerprint) (*CertResult, error)
 }
 
+// SourceResult is implemented by the results of drivers that merge the results of other drivers
+type SourceResult interface {
+	// Sources returns the names of the drivers that found the certificate
+	Sources(fp fingerprint.Fingerprint) []string
+}
+
 // FingerprintMap stores a mapping of domains to Fingerprints returned from the driver
 // in the case where multiple domains where queries (redirects, related, etc..) the
 // matching certificates will be in this map
@@ -60,8 +75,23 @@ func (f FingerprintMap) Add(domain string, fp fingerprint.Fingerprint) {
 
 // CertResult is an object to hold the fingerprint and Domains for a returned certificate
 type CertResult struct {
-	Fingerprint fingerprint.Fingerprint
-	Domains     []string
+	Fingerprint  fingerprint.Fingerprint
+	Domains      []string
+	SerialNumber *big.Int
+	NotBefore    time.Time
+	NotAfter     time.Time
+	// Authority Information Access and CRL Distribution Point URLs, if known
+	OCSPServer            []string
+	IssuingCertificateURL []string
+	CRLDistributionPoints []string
+	// certificate policy OIDs, if known
+	PolicyOIDs []string
+	// issuer distinguished name and the fingerprint of the public key, if known
+	Issuer         string
+	KeyFingerprint fingerprint.Fingerprint
+	// subject organization (O) and organizational units (OU), usually only set in OV and EV certificates
+	Organization       []string
+	OrganizationalUnit []string
 }
 
 // NewCertResult creates a new CertResult struct from an x509 cert
@@ -90,5 +120,23 @@ func NewCertResult(cert *x509.Certificate) *CertResult {
 	}
 	sort.Strings(certResult.Domains)
 
+	certResult.SerialNumber = cert.SerialNumber
+	certResult.NotBefore = cert.NotBefore
+	certResult.NotAfter = cert.NotAfter
+	certResult.Issuer = cert.Issuer.String()
+	certResult.KeyFingerprint = fingerprint.FromBytes(cert.RawSubjectPublicKeyInfo)
+	certResult.Organization = cert.Subject.Organization
+	certResult.OrganizationalUnit = cert.Subject.OrganizationalUnit
+
+	// AIA & CRL
+	certResult.OCSPServer = cert.OCSPServer
+	certResult.IssuingCertificateURL = cert.IssuingCertificateURL
+	certResult.CRLDistributionPoints = cert.CRLDistributionPoints
+
+	// certificate policies
+	for _, oid := range cert.PolicyIdentifiers {
+		certResult.PolicyOIDs = append(certResult.PolicyOIDs, oid.String())
+	}
+
 	return certResult
 }
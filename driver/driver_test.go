@@ -0,0 +1,93 @@
+package driver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+// newTestCertificate returns the self signed certificate of the template
+func newTestCertificate(t *testing.T, template *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(1234)
+	template.NotBefore = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	template.NotAfter = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestNewCertResult(t *testing.T) {
+	cert := newTestCertificate(t, &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "Example.com",
+			Organization:       []string{"Example Inc"},
+			OrganizationalUnit: []string{"Web"},
+		},
+		DNSNames:              []string{"www.example.com", "example.com", "WWW.Example.com", ""},
+		OCSPServer:            []string{"http://ocsp.example.com"},
+		IssuingCertificateURL: []string{"http://ca.example.com/ca.crt"},
+		CRLDistributionPoints: []string{"http://crl.example.com/ca.crl"},
+		PolicyIdentifiers:     []asn1.ObjectIdentifier{{2, 23, 140, 1, 2, 2}, {1, 3, 6, 1, 4, 1, 4146, 1, 20}},
+	})
+	certResult := NewCertResult(cert)
+
+	if certResult.Fingerprint != fingerprint.FromBytes(cert.Raw) {
+		t.Errorf("Fingerprint = %s, want the fingerprint of the raw certificate", certResult.Fingerprint.HexString())
+	}
+	if certResult.KeyFingerprint != fingerprint.FromBytes(cert.RawSubjectPublicKeyInfo) {
+		t.Errorf("KeyFingerprint = %s, want the fingerprint of the public key", certResult.KeyFingerprint.HexString())
+	}
+	if certResult.SerialNumber.Int64() != 1234 || !certResult.NotBefore.Equal(cert.NotBefore) || !certResult.NotAfter.Equal(cert.NotAfter) {
+		t.Errorf("serial %v valid from %v to %v, want the certificate's", certResult.SerialNumber, certResult.NotBefore, certResult.NotAfter)
+	}
+	tests := []struct {
+		field string
+		got   interface{}
+		want  interface{}
+	}{
+		// the common name is a domain, each domain once in lower case
+		{"Domains", certResult.Domains, []string{"example.com", "www.example.com"}},
+		{"OCSPServer", certResult.OCSPServer, []string{"http://ocsp.example.com"}},
+		{"IssuingCertificateURL", certResult.IssuingCertificateURL, []string{"http://ca.example.com/ca.crt"}},
+		{"CRLDistributionPoints", certResult.CRLDistributionPoints, []string{"http://crl.example.com/ca.crl"}},
+		{"PolicyOIDs", certResult.PolicyOIDs, []string{"2.23.140.1.2.2", "1.3.6.1.4.1.4146.1.20"}},
+		{"Issuer", certResult.Issuer, "CN=Example.com,OU=Web,O=Example Inc"},
+		{"Organization", certResult.Organization, []string{"Example Inc"}},
+		{"OrganizationalUnit", certResult.OrganizationalUnit, []string{"Web"}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s = %#v, want %#v", test.field, test.got, test.want)
+		}
+	}
+}
+
+func TestNewCertResultWithoutExtensions(t *testing.T) {
+	certResult := NewCertResult(newTestCertificate(t, &x509.Certificate{DNSNames: []string{"example.com"}}))
+	if !reflect.DeepEqual(certResult.Domains, []string{"example.com"}) {
+		t.Errorf("Domains = %v, want [example.com]", certResult.Domains)
+	}
+	if certResult.OCSPServer != nil || certResult.IssuingCertificateURL != nil || certResult.CRLDistributionPoints != nil || certResult.PolicyOIDs != nil || certResult.Organization != nil {
+		t.Errorf("certificate without extensions has %+v", certResult)
+	}
+}
@@ -1,10 +1,13 @@
 package driver
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // Example provides a simple entrypoint to test a driver on an individual domain
 func Example(domain string, driver Driver) error {
-	certDriver, err := driver.QueryDomain(domain)
+	certDriver, err := driver.QueryDomain(context.Background(), domain)
 	if err != nil {
 		return err
 	}
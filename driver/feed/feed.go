@@ -0,0 +1,244 @@
+// Package feed implements a passive certgraph driver that builds the graph
+// from a feed of previously observed certificates instead of actively querying
+//
+// The feed is a stream of JSON records, one per certificate, read from a file or URL.
+// Each record has the following fields:
+//
+//	{
+//	  "fingerprint": "<hex sha256 of the DER certificate>",
+//	  "der": "<base64 DER certificate>",
+//	  "pem": "<PEM certificate>",
+//	  "sans": ["example.com", "www.example.com"],
+//	  "seen_time": "2020-01-02T15:04:05Z"
+//	}
+//
+// Either der or pem should be provided when available, in which case the fingerprint
+// and domains are taken from the certificate itself and any sans are added to them.
+// Otherwise both fingerprint and sans are required.
+// seen_time is optional and informational only.
+package feed
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/fingerprint"
+	"github.com/lanrat/certgraph/status"
+)
+
+const driverName = "feed"
+
+func init() {
+	driver.AddDriver(driverName)
+}
+
+// Record is a single certificate observation in the feed
+type Record struct {
+	Fingerprint string    `json:"fingerprint"`
+	DER         []byte    `json:"der"`
+	PEM         string    `json:"pem"`
+	SANs        []string  `json:"sans"`
+	SeenTime    time.Time `json:"seen_time"`
+}
+
+type feedDriver struct {
+	save     bool
+	savePath string
+	domains  map[string][]fingerprint.Fingerprint
+	certs    map[fingerprint.Fingerprint]*driver.CertResult
+}
+
+type feedCertDriver struct {
+	host         string
+	fingerprints driver.FingerprintMap
+	driver       *feedDriver
+}
+
+func (c *feedCertDriver) GetFingerprints() (driver.FingerprintMap, error) {
+	return c.fingerprints, nil
+}
+
+func (c *feedCertDriver) GetStatus() status.Map {
+	// passively observed certificates tell us nothing about the domain's current status
+	return make(status.Map)
+}
+
+func (c *feedCertDriver) GetRelated() ([]string, error) {
+	return make([]string, 0), nil
+}
+
+func (c *feedCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
+	cert, found := c.driver.certs[fp]
+	if found {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("certificate with Fingerprint %s not found", fp.HexString())
+}
+
+// Driver creates a new passive driver from the feed at source, which may be a file path or http(s) URL
+// feeds downloaded from a URL larger than maxResponseSize bytes are an error, 0 has no limit
+// driver option source sets the feed source to use instead of the provided source
+func Driver(source string, timeout time.Duration, savePath string, maxResponseSize int64, opts *driver.Options) (driver.Driver, error) {
+	source = opts.Get("source", source)
+	d := new(feedDriver)
+	d.domains = make(map[string][]fingerprint.Fingerprint)
+	d.certs = make(map[fingerprint.Fingerprint]*driver.CertResult)
+	if len(savePath) > 0 {
+		d.save = true
+		d.savePath = savePath
+	}
+
+	if len(source) == 0 {
+		return nil, errors.New("feed driver requires a feed source")
+	}
+
+	var r io.Reader
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: timeout, Transport: driver.HTTPTransport()}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, errors.New("Got non OK HTTP status: '" + resp.Status + "' on URL: " + source)
+		}
+		defer resp.Body.Close()
+		r = driver.LimitReader(resp.Body, maxResponseSize)
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	err := d.load(r)
+	return d, err
+}
+
+// load reads all of the records from the feed into the driver's index
+func (d *feedDriver) load(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var record Record
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("feed record %d: %w", n, err)
+		}
+		err = d.add(&record)
+		if err != nil {
+			return fmt.Errorf("feed record %d: %w", n, err)
+		}
+	}
+}
+
+// add adds a single record to the driver's index
+func (d *feedDriver) add(record *Record) error {
+	var certResult *driver.CertResult
+
+	der := record.DER
+	if len(der) == 0 && len(record.PEM) > 0 {
+		block, _ := pem.Decode([]byte(record.PEM))
+		if block == nil {
+			return errors.New("unable to decode pem")
+		}
+		der = block.Bytes
+	}
+
+	if len(der) > 0 {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return err
+		}
+		certResult = driver.NewCertResult(cert)
+		if d.save {
+			err = driver.RawCertToPEMFile(der, path.Join(d.savePath, certResult.Fingerprint.HexString())+".pem")
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		if len(record.Fingerprint) == 0 || len(record.SANs) == 0 {
+			return errors.New("records without a certificate require a fingerprint and sans")
+		}
+		fp, err := fingerprint.FromHex(record.Fingerprint)
+		if err != nil {
+			return err
+		}
+		certResult = &driver.CertResult{Fingerprint: fp}
+	}
+
+	// merge the certificate with any previous records for it
+	if existing, found := d.certs[certResult.Fingerprint]; found {
+		certResult = existing
+	} else {
+		d.certs[certResult.Fingerprint] = certResult
+		for _, domain := range certResult.Domains {
+			d.addDomain(domain, certResult.Fingerprint)
+		}
+	}
+	for _, san := range record.SANs {
+		san = strings.ToLower(san)
+		if len(san) == 0 || contains(certResult.Domains, san) {
+			continue
+		}
+		certResult.Domains = append(certResult.Domains, san)
+		d.addDomain(san, certResult.Fingerprint)
+	}
+	sort.Strings(certResult.Domains)
+	return nil
+}
+
+// addDomain indexes the fingerprint under the non-wildcard version of the domain
+func (d *feedDriver) addDomain(domain string, fp fingerprint.Fingerprint) {
+	domain = strings.TrimPrefix(domain, "*.")
+	for _, existing := range d.domains[domain] {
+		if existing == fp {
+			return
+		}
+	}
+	d.domains[domain] = append(d.domains[domain], fp)
+}
+
+func (d *feedDriver) GetName() string {
+	return driverName
+}
+
+// QueryDomain returns the certificates in the feed for the provided domain, ignoring its case
+func (d *feedDriver) QueryDomain(ctx context.Context, domain string) (driver.Result, error) {
+	results := &feedCertDriver{
+		host:         domain,
+		fingerprints: make(driver.FingerprintMap),
+		driver:       d,
+	}
+	for _, fp := range d.domains[strings.ToLower(domain)] {
+		results.fingerprints.Add(domain, fp)
+	}
+	return results, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package feed
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+// testCertDER returns the DER of a self signed certificate for the domains
+func testCertDER(t *testing.T, domains ...string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// writeFeed writes the feed to a temporary file, returning its path and a function to remove it
+func writeFeed(t *testing.T, feed string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "feed.json")
+	err = ioutil.WriteFile(path, []byte(feed), 0644)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return path, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+// domainCerts returns the fingerprints the driver returns for the domain
+func domainCerts(t *testing.T, d driver.Driver, domain string) []fingerprint.Fingerprint {
+	t.Helper()
+	result, err := d.QueryDomain(context.Background(), domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprints, _ := result.GetFingerprints()
+	return fingerprints[domain]
+}
+
+func TestFeed(t *testing.T) {
+	derA := testCertDER(t, "a.test", "*.a.test")
+	derB := testCertDER(t, "b.test")
+	fpA, fpB := fingerprint.FromBytes(derA), fingerprint.FromBytes(derB)
+	pemB := strings.Replace(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derB})), "\n", "\\n", -1)
+	fpC := strings.Repeat("c", 64)
+	feed := fmt.Sprintf(`{"der": "%s", "sans": ["Extra.a.test"]}
+{"pem": "%s", "seen_time": "2020-01-02T15:04:05Z"}
+{"fingerprint": "%s", "sans": ["c.test", "a.test"]}
+{"fingerprint": "%s", "sans": ["more.c.test"]}
+`, base64.StdEncoding.EncodeToString(derA), pemB, fpC, fpC)
+	path, remove := writeFeed(t, feed)
+	defer remove()
+
+	d, err := Driver(path, time.Second, "", 0, driver.NewOptions().Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certC, _ := fingerprint.FromHex(fpC)
+	tests := []struct {
+		domain string
+		want   []fingerprint.Fingerprint
+	}{
+		{"a.test", []fingerprint.Fingerprint{fpA, certC}},
+		{"extra.a.test", []fingerprint.Fingerprint{fpA}},
+		{"Extra.A.test", []fingerprint.Fingerprint{fpA}},
+		{"b.test", []fingerprint.Fingerprint{fpB}},
+		{"c.test", []fingerprint.Fingerprint{certC}},
+		{"more.c.test", []fingerprint.Fingerprint{certC}},
+		{"d.test", nil},
+	}
+	for _, test := range tests {
+		got := domainCerts(t, d, test.domain)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("QueryDomain(%s) returned %v, want %v", test.domain, got, test.want)
+		}
+	}
+
+	// records for the same certificate are merged
+	result, _ := d.QueryDomain(context.Background(), "c.test")
+	cert, err := result.QueryCert(certC)
+	if err != nil || strings.Join(cert.Domains, " ") != "a.test c.test more.c.test" {
+		t.Errorf("QueryCert returned %v, %v, want the merged sans", cert, err)
+	}
+	cert, err = result.QueryCert(fpA)
+	if err != nil || strings.Join(cert.Domains, " ") != "*.a.test a.test extra.a.test" {
+		t.Errorf("QueryCert returned %v, %v, want the certificate's domains and the record's sans", cert, err)
+	}
+	if status := result.GetStatus(); len(status) != 0 {
+		t.Errorf("passive results have the status %v", status)
+	}
+}
+
+func TestFeedURL(t *testing.T) {
+	feed := fmt.Sprintf(`{"fingerprint": "%s", "sans": ["a.test"]}`, strings.Repeat("a", 64))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(feed))
+	}))
+	defer server.Close()
+
+	// the source driver option replaces the source
+	opts := driver.NewOptions()
+	opts.Set("feed.source=" + server.URL + "/feed.json")
+	d, err := Driver("unused.json", time.Second, "", 0, opts.Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs := domainCerts(t, d, "a.test"); len(certs) != 1 {
+		t.Errorf("found %v, want the certificate in the feed", certs)
+	}
+
+	if _, err := Driver(server.URL+"/missing.json", time.Second, "", 0, driver.NewOptions().Sub(driverName)); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Driver of a missing feed returned %v", err)
+	}
+	if _, err := Driver(server.URL+"/feed.json", time.Second, "", 10, driver.NewOptions().Sub(driverName)); err == nil || !strings.Contains(err.Error(), driver.ErrResponseTooLarge.Error()) {
+		t.Errorf("Driver of a feed larger than the maximum response size returned %v", err)
+	}
+}
+
+func TestFeedErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		feed string
+		want string
+	}{
+		{"bad json", `{"sans": [`, "feed record 1"},
+		{"no certificate", `{"sans": ["a.test"]}`, "require a fingerprint and sans"},
+		{"no sans", fmt.Sprintf(`{"fingerprint": "%s"}`, strings.Repeat("a", 64)), "require a fingerprint and sans"},
+		{"bad fingerprint", `{"fingerprint": "xyz", "sans": ["a.test"]}`, "feed record 1"},
+		{"bad pem", `{"pem": "not pem"}`, "unable to decode pem"},
+		{"bad der", `{"der": "AAAA"}`, "feed record 1"},
+		{"second record", fmt.Sprintf("{\"fingerprint\": \"%s\", \"sans\": [\"a.test\"]}\n{\"sans\": []}", strings.Repeat("a", 64)), "feed record 2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, remove := writeFeed(t, test.feed)
+			defer remove()
+			_, err := Driver(path, time.Second, "", 0, driver.NewOptions().Sub(driverName))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Driver returned %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+	if _, err := Driver("", time.Second, "", 0, driver.NewOptions().Sub(driverName)); err == nil {
+		t.Error("Driver without a source did not fail")
+	}
+}
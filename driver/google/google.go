@@ -8,12 +8,15 @@
 package google
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lanrat/certgraph/driver"
@@ -27,20 +30,32 @@ func init() {
 	driver.AddDriver(driverName)
 }
 
-// Base URLs for Google's CT API
+// Base URL and paths for Google's CT API
 const (
-	searchURL1 = "https://transparencyreport.google.com/transparencyreport/api/v3/httpsreport/ct/certsearch?include_expired=false&include_subdomains=false&domain=example.com"
-	searchURL2 = "https://transparencyreport.google.com/transparencyreport/api/v3/httpsreport/ct/certsearch/page?p=DEADBEEF"
-	certURL    = "https://transparencyreport.google.com/transparencyreport/api/v3/httpsreport/ct/certbyhash?hash=DEADBEEF"
+	defaultAPIURL = "https://transparencyreport.google.com"
+	searchURL1    = "/transparencyreport/api/v3/httpsreport/ct/certsearch?include_expired=false&include_subdomains=false&domain=example.com"
+	searchURL2    = "/transparencyreport/api/v3/httpsreport/ct/certsearch/page?p=DEADBEEF"
+	certURL       = "/transparencyreport/api/v3/httpsreport/ct/certbyhash?hash=DEADBEEF"
 	//summaryURL is not currently used
-	//summaryURL = "https://transparencyreport.google.com/transparencyreport/api/v3/httpsreport/ct/summary"
+	//summaryURL = "/transparencyreport/api/v3/httpsreport/ct/summary"
+)
+
+// indexes of the fields of the certificate info in a certbyhash response
+// [subject, issuer, serial number, not before ms, not after ms, ?, ?, [domains], ...]
+const (
+	certInfoIssuer    = 1
+	certInfoNotBefore = 3
+	certInfoNotAfter  = 4
+	certInfoDomains   = 7
 )
 
 type googleCT struct {
+	apiURL            string
 	maxPages          float64 // this is a float because that is the type automatically decoded from the JSON response
 	jsonClient        *http.Client
 	includeExpired    bool
 	includeSubdomains bool
+	maxResponseSize   int64
 }
 
 type googleCertDriver struct {
@@ -66,10 +81,19 @@ func (c *googleCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertRe
 }
 
 // Driver creates a new CT driver for google
-func Driver(maxQueryPages int, savePath string, includeSubdomains, includeExpired bool) (driver.Driver, error) {
+// responses larger than maxResponseSize bytes are an error, 0 has no limit
+// driver option pages sets the maximum number of result pages to get for a domain, defaults to 50
+// driver option url sets the base URL of the API
+func Driver(savePath string, includeSubdomains, includeExpired bool, maxResponseSize int64, opts *driver.Options) (driver.Driver, error) {
 	d := new(googleCT)
+	maxQueryPages, err := opts.Int("pages", 50)
+	if err != nil {
+		return nil, err
+	}
 	d.maxPages = float64(maxQueryPages)
-	d.jsonClient = &http.Client{Timeout: 10 * time.Second}
+	d.apiURL = strings.TrimSuffix(opts.Get("url", defaultAPIURL), "/")
+	d.maxResponseSize = maxResponseSize
+	d.jsonClient = &http.Client{Timeout: 10 * time.Second, Transport: driver.HTTPTransport()}
 	d.includeExpired = includeExpired
 	d.includeSubdomains = includeSubdomains
 
@@ -86,19 +110,26 @@ func (d *googleCT) GetName() string {
 }
 
 // getJsonP gets JSON from url and parses it into target object
-func (d *googleCT) getJSONP(url string, target interface{}) error {
-	r, err := d.jsonClient.Get(url)
+func (d *googleCT) getJSONP(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	r, err := d.jsonClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer r.Body.Close()
+	if r.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w on URL: %s", driver.ErrRateLimited, url)
+	}
 	if r.StatusCode != http.StatusOK {
 		return errors.New("Got non OK HTTP status: '" + r.Status + "' on URL: " + url)
 	}
 
-	respData, err := ioutil.ReadAll(r.Body)
+	respData, err := ioutil.ReadAll(driver.LimitReader(r.Body, d.maxResponseSize))
 	if err != nil {
-		return err
+		return fmt.Errorf("%w on URL: %s", err, url)
 	}
 
 	respData = respData[5:] // this removes the leading ")]}'" from the response
@@ -106,14 +137,14 @@ func (d *googleCT) getJSONP(url string, target interface{}) error {
 	return json.Unmarshal(respData, target)
 }
 
-func (d *googleCT) QueryDomain(domain string) (driver.Result, error) {
+func (d *googleCT) QueryDomain(ctx context.Context, domain string) (driver.Result, error) {
 	results := &googleCertDriver{
 		fingerprints: make(driver.FingerprintMap),
 		driver:       d,
 		host:         domain,
 	}
 
-	u, err := url.Parse(searchURL1)
+	u, err := url.Parse(d.apiURL + searchURL1)
 	if err != nil {
 		return results, err
 	}
@@ -133,7 +164,7 @@ func (d *googleCT) QueryDomain(domain string) (driver.Result, error) {
 
 	// iterate over results
 	for len(nextURL) > 1 && currentPage <= d.maxPages {
-		err = d.getJSONP(nextURL, &raw)
+		err = d.getJSONP(ctx, nextURL, &raw)
 		if err != nil {
 			return results, err
 		}
@@ -168,7 +199,7 @@ func (d *googleCT) QueryDomain(domain string) (driver.Result, error) {
 		// create url or next page
 		nextURL = ""
 		if pageInfo[1] != nil {
-			u, err := url.Parse(searchURL2)
+			u, err := url.Parse(d.apiURL + searchURL2)
 			if err != nil {
 				return results, err
 			}
@@ -189,7 +220,7 @@ func (d *googleCT) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, er
 	certNode.Fingerprint = fp
 	certNode.Domains = make([]string, 0, 5)
 
-	u, err := url.Parse(certURL)
+	u, err := url.Parse(d.apiURL + certURL)
 	if err != nil {
 		return certNode, err
 	}
@@ -200,7 +231,7 @@ func (d *googleCT) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, er
 
 	var raw [][]interface{}
 
-	err = d.getJSONP(u.String(), &raw)
+	err = d.getJSONP(context.Background(), u.String(), &raw)
 	if err != nil {
 		return certNode, err
 	}
@@ -215,12 +246,31 @@ func (d *googleCT) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, er
 		return certNode, errors.New("Cert Does not exist! output: " + raw[0][0].(string))
 	}
 
-	certInfo := raw[0][1].([]interface{})
-	domains := certInfo[7].([]interface{})
+	certInfo, ok := raw[0][1].([]interface{})
+	if !ok || len(certInfo) <= certInfoDomains {
+		return certNode, errors.New("Got Unexpected Cert info: " + fmt.Sprint(raw[0][1]))
+	}
+	domains, _ := certInfo[certInfoDomains].([]interface{})
 
 	for _, domain := range domains {
-		certNode.Domains = append(certNode.Domains, domain.(string))
+		if name, ok := domain.(string); ok {
+			certNode.Domains = append(certNode.Domains, name)
+		}
 	}
 
+	// the validity period and issuer are left zero valued if they are missing
+	certNode.Issuer, _ = certInfo[certInfoIssuer].(string)
+	certNode.NotBefore = msTime(certInfo[certInfoNotBefore])
+	certNode.NotAfter = msTime(certInfo[certInfoNotAfter])
+
 	return certNode, nil
 }
+
+// msTime returns the time of a JSON number of milliseconds since the epoch, or the zero time if v is not one
+func msTime(v interface{}) time.Time {
+	ms, ok := v.(float64)
+	if !ok || ms <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC()
+}
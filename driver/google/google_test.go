@@ -0,0 +1,123 @@
+package google
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+func TestGetJSONP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte(")]}'\n[[\"https.ct.cdsr\",[]]]"))
+		case "/ratelimited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path            string
+		maxResponseSize int64
+		want            string
+		is              error
+	}{
+		{"/ok", 0, "", nil},
+		{"/ratelimited", 0, "rate limited", driver.ErrRateLimited},
+		{"/missing", 0, "non OK HTTP status", nil},
+		{"/ok", 10, "exceeded maximum response size", driver.ErrResponseTooLarge},
+	}
+	for _, test := range tests {
+		d, err := Driver("", false, false, test.maxResponseSize, driver.NewOptions().Sub(driverName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var raw [][]interface{}
+		err = d.(*googleCT).getJSONP(context.Background(), server.URL+test.path, &raw)
+		if len(test.want) == 0 {
+			// the leading )]}' is removed before parsing
+			if err != nil || len(raw) != 1 || raw[0][0] != "https.ct.cdsr" {
+				t.Errorf("getJSONP(%s) = %v, %v", test.path, raw, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("getJSONP(%s) returned %v, want an error containing %q", test.path, err, test.want)
+		}
+		if test.is != nil && !errors.Is(err, test.is) {
+			t.Errorf("getJSONP(%s) returned %v, want %v", test.path, err, test.is)
+		}
+	}
+}
+
+// certByHash is a certbyhash response with the certificate's subject, issuer, serial number, validity period, and domains
+const certByHash = `)]}'
+[["https.ct.chr",["CN=www.example.com","C=US, O=Let's Encrypt, CN=R3","03:a1:5e",1600000000000,1607776000000,"aGFzaA==",null,["www.example.com","example.com"],null,1],[]]]`
+
+// certByHashWithoutMetadata is a certbyhash response without the validity period or issuer
+const certByHashWithoutMetadata = `)]}'
+[["https.ct.chr",["CN=www.example.com",null,null,null,null,null,null,["www.example.com"]],[]]]`
+
+func TestQueryCert(t *testing.T) {
+	responses := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/transparencyreport/api/v3/httpsreport/ct/certbyhash" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(responses[r.URL.Query().Get("hash")]))
+	}))
+	defer server.Close()
+
+	opts := driver.NewOptions()
+	opts.Set("google.url=" + server.URL + "/")
+	d, err := Driver("", false, false, 0, opts.Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var full, bare, missing fingerprint.Fingerprint
+	full[0], bare[0], missing[0] = 1, 2, 3
+	responses[full.B64Encode()] = certByHash
+	responses[bare.B64Encode()] = certByHashWithoutMetadata
+	responses[missing.B64Encode()] = ")]}'\n[[\"https.ct.chr\"]]"
+
+	cert, err := d.(*googleCT).QueryCert(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cert.Domains, []string{"www.example.com", "example.com"}) {
+		t.Errorf("QueryCert found the domains %v", cert.Domains)
+	}
+	if cert.Issuer != "C=US, O=Let's Encrypt, CN=R3" {
+		t.Errorf("QueryCert found the issuer %q", cert.Issuer)
+	}
+	if want := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC); !cert.NotBefore.Equal(want) {
+		t.Errorf("QueryCert found NotBefore %s, want %s", cert.NotBefore, want)
+	}
+	if want := time.Date(2020, 12, 12, 12, 26, 40, 0, time.UTC); !cert.NotAfter.Equal(want) {
+		t.Errorf("QueryCert found NotAfter %s, want %s", cert.NotAfter, want)
+	}
+
+	cert, err = d.(*googleCT).QueryCert(bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Domains) != 1 || len(cert.Issuer) != 0 || !cert.NotBefore.IsZero() || !cert.NotAfter.IsZero() {
+		t.Errorf("QueryCert of a certificate without metadata = %+v, want it left zero valued", cert)
+	}
+
+	if _, err := d.(*googleCT).QueryCert(missing); err == nil {
+		t.Error("QueryCert of a certificate that does not exist did not fail")
+	}
+}
@@ -0,0 +1,114 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lanrat/certgraph/status"
+)
+
+// ErrRateLimited is returned by drivers when the upstream service has rate limited the request
+var ErrRateLimited = errors.New("rate limited")
+
+// Health counts the outcomes of a driver's domain queries
+type Health struct {
+	Name        string
+	lock        sync.Mutex
+	queries     int
+	succeeded   int
+	failed      int
+	timedOut    int
+	rateLimited int
+	latency     time.Duration
+}
+
+// NewHealth returns a new Health for the named driver
+func NewHealth(name string) *Health {
+	return &Health{Name: name}
+}
+
+// Record records the outcome of a single query that took latency
+func (h *Health) Record(err error, latency time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.queries++
+	h.latency += latency
+	switch {
+	case err == nil:
+		h.succeeded++
+	case errors.Is(err, ErrRateLimited):
+		h.rateLimited++
+	case isTimeout(err):
+		h.timedOut++
+	default:
+		h.failed++
+	}
+}
+
+// isTimeout returns true if err or any error it wraps is a timeout
+func isTimeout(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if status.CheckNetErr(err) == status.TIMEOUT {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a one line summary of the driver's health
+func (h *Health) String() string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return fmt.Sprintf("%s: %d queries, %d succeeded, %d failed, %d timed out, %d rate limited, %s average latency",
+		h.Name, h.queries, h.succeeded, h.failed, h.timedOut, h.rateLimited, h.averageLatency())
+}
+
+// ToMap returns a map of the driver's health for JSON serialization
+func (h *Health) ToMap() map[string]interface{} {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return map[string]interface{}{
+		"driver":          h.Name,
+		"queries":         h.queries,
+		"succeeded":       h.succeeded,
+		"failed":          h.failed,
+		"timed_out":       h.timedOut,
+		"rate_limited":    h.rateLimited,
+		"average_latency": h.averageLatency().Seconds(),
+	}
+}
+
+// averageLatency returns the average latency of the queries, the lock must be held
+func (h *Health) averageLatency() time.Duration {
+	if h.queries == 0 {
+		return 0
+	}
+	return h.latency / time.Duration(h.queries)
+}
+
+// healthDriver is a Driver that records the outcome of the domain queries made to the Driver it wraps
+type healthDriver struct {
+	Driver
+	health *Health
+}
+
+// MonitorHealth returns the driver with the outcome of every domain query recorded to h
+func MonitorHealth(d Driver, h *Health) Driver {
+	return &healthDriver{Driver: d, health: h}
+}
+
+// Unwrap returns the driver being monitored
+func (d *healthDriver) Unwrap() Driver {
+	return d.Driver
+}
+
+// QueryDomain queries the domain and records the outcome
+func (d *healthDriver) QueryDomain(ctx context.Context, domain string) (Result, error) {
+	start := time.Now()
+	result, err := d.Driver.QueryDomain(ctx, domain)
+	d.health.Record(err, time.Since(start))
+	return result, err
+}
@@ -0,0 +1,58 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	h := NewHealth("fake")
+	outcomes := []error{
+		nil,
+		nil,
+		errors.New("bad response"),
+		fmt.Errorf("crtsh: %w", ErrRateLimited),
+		&net.DNSError{Err: "i/o timeout", IsTimeout: true},
+		fmt.Errorf("query: %w", &net.DNSError{Err: "i/o timeout", IsTimeout: true}),
+	}
+	for _, err := range outcomes {
+		h.Record(err, time.Second)
+	}
+	want := map[string]interface{}{
+		"driver":          "fake",
+		"queries":         6,
+		"succeeded":       2,
+		"failed":          1,
+		"timed_out":       2,
+		"rate_limited":    1,
+		"average_latency": float64(1),
+	}
+	if m := h.ToMap(); fmt.Sprint(m) != fmt.Sprint(want) {
+		t.Errorf("ToMap() = %v, want %v", m, want)
+	}
+	if s := h.String(); s != "fake: 6 queries, 2 succeeded, 1 failed, 2 timed out, 1 rate limited, 1s average latency" {
+		t.Errorf("String() = %s", s)
+	}
+	if s := NewHealth("idle").String(); s != "idle: 0 queries, 0 succeeded, 0 failed, 0 timed out, 0 rate limited, 0s average latency" {
+		t.Errorf("String() of a driver without queries = %s", s)
+	}
+}
+
+func TestMonitorHealth(t *testing.T) {
+	h := NewHealth("fake")
+	d := &failingDriver{fakeDriver: fakeDriver{result: newFakeResult("a.test")}, err: ErrRateLimited, failures: 1}
+	monitored := MonitorHealth(d, h)
+	for i := 0; i < 3; i++ {
+		monitored.QueryDomain(context.Background(), "a.test")
+	}
+	if m := h.ToMap(); m["queries"] != 3 || m["succeeded"] != 2 || m["rate_limited"] != 1 {
+		t.Errorf("recorded %v, want 3 queries, 2 succeeded, and 1 rate limited", m)
+	}
+	if monitored.(unwrapper).Unwrap() != d {
+		t.Error("Unwrap did not return the monitored driver")
+	}
+}
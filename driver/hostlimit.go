@@ -0,0 +1,72 @@
+package driver
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// maxConnsPerHost is the maximum number of concurrent connections to make to a single host, 0 has no limit
+var maxConnsPerHost int
+
+// hostSlots holds a semaphore for each host connected to while maxConnsPerHost is set
+var hostSlots = struct {
+	sync.Mutex
+	hosts map[string]chan bool
+}{hosts: make(map[string]chan bool)}
+
+// SetMaxConnsPerHost sets the maximum number of concurrent connections drivers will make to a single host, 0 has no limit
+// should be called before any drivers are created
+func SetMaxConnsPerHost(max int) {
+	maxConnsPerHost = max
+}
+
+// MaxConnsPerHost returns the maximum number of concurrent connections drivers will make to a single host, 0 has no limit
+func MaxConnsPerHost() int {
+	return maxConnsPerHost
+}
+
+// AcquireHost blocks until a new connection may be made to host without exceeding the per host limit
+// the returned function must be called once the connection is closed to release it
+func AcquireHost(host string) (release func()) {
+	if maxConnsPerHost <= 0 {
+		return func() {}
+	}
+	hostSlots.Lock()
+	slots, ok := hostSlots.hosts[host]
+	if !ok {
+		slots = make(chan bool, maxConnsPerHost)
+		hostSlots.hosts[host] = slots
+	}
+	hostSlots.Unlock()
+
+	slots <- true
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-slots })
+	}
+}
+
+// hostConn is a net.Conn that releases its host's connection slot when closed
+type hostConn struct {
+	net.Conn
+	release func()
+}
+
+// Close closes the connection and releases its slot
+func (c *hostConn) Close() error {
+	defer c.release()
+	return c.Conn.Close()
+}
+
+// LimitConn returns conn wrapped to call release when it is closed
+func LimitConn(conn net.Conn, release func()) net.Conn {
+	return &hostConn{Conn: conn, release: release}
+}
+
+// HTTPTransport returns a new http.Transport with the default settings that honors the per host connection limit
+func HTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = maxConnsPerHost
+	return transport
+}
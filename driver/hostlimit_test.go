@@ -0,0 +1,140 @@
+package driver
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useMaxConnsPerHost sets the per host connection limit with new host slots until the returned function is called
+func useMaxConnsPerHost(max int) func() {
+	previous := maxConnsPerHost
+	SetMaxConnsPerHost(max)
+	hostSlots.hosts = make(map[string]chan bool)
+	return func() {
+		SetMaxConnsPerHost(previous)
+		hostSlots.hosts = make(map[string]chan bool)
+	}
+}
+
+// concurrency tracks the most calls in progress at once
+type concurrency struct {
+	lock    sync.Mutex
+	current int
+	max     int
+}
+
+func (c *concurrency) start() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.current++
+	if c.current > c.max {
+		c.max = c.current
+	}
+}
+
+func (c *concurrency) end() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.current--
+}
+
+func TestAcquireHost(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int
+		// want is the most connections to a.test at once, with all of its 10 connections attempted at once
+		want int
+	}{
+		{"no limit", 0, 10},
+		{"limit", 2, 2},
+		{"single", 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer useMaxConnsPerHost(test.max)()
+			var hosts [2]concurrency
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(host int) {
+					defer wg.Done()
+					release := AcquireHost([]string{"a.test", "b.test"}[host])
+					hosts[host].start()
+					time.Sleep(50 * time.Millisecond)
+					hosts[host].end()
+					release()
+					// releasing twice only frees the slot once
+					release()
+				}(i % 2)
+			}
+			wg.Wait()
+			for i := range hosts {
+				if hosts[i].max != test.want {
+					t.Errorf("host %d had %d connections at once, want %d", i, hosts[i].max, test.want)
+				}
+			}
+			if test.max > 0 && len(hostSlots.hosts["a.test"]) != 0 {
+				t.Errorf("%d slots of a.test were not released", len(hostSlots.hosts["a.test"]))
+			}
+		})
+	}
+}
+
+func TestLimitConn(t *testing.T) {
+	defer useMaxConnsPerHost(1)()
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := LimitConn(client, AcquireHost("a.test"))
+
+	acquired := make(chan func())
+	go func() {
+		acquired <- AcquireHost("a.test")
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("a second connection was allowed while the first was open")
+	case <-time.After(20 * time.Millisecond):
+	}
+	conn.Close()
+	conn.Close()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("closing the connection did not release its slot")
+	}
+}
+
+func TestHTTPTransport(t *testing.T) {
+	defer useMaxConnsPerHost(2)()
+	var requests concurrency
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.start()
+		defer requests.end()
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: HTTPTransport()}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	if requests.max > 2 {
+		t.Errorf("server had %d requests at once, want at most 2", requests.max)
+	}
+}
@@ -2,11 +2,13 @@
 package http
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"path"
+	"strconv"
 	"time"
 
 	"github.com/lanrat/certgraph/driver"
@@ -30,11 +32,14 @@ type httpDriver struct {
 
 type httpCertDriver struct {
 	parent       *httpDriver
+	ctx          context.Context
 	client       *http.Client
+	transport    *http.Transport
 	fingerprints driver.FingerprintMap
 	status       status.Map
 	related      []string
 	certs        map[fingerprint.Fingerprint]*driver.CertResult
+	sni          map[string]driver.SNI
 }
 
 func (c *httpCertDriver) GetFingerprints() (driver.FingerprintMap, error) {
@@ -49,6 +54,11 @@ func (c *httpCertDriver) GetRelated() ([]string, error) {
 	return c.related, nil
 }
 
+// GetSNI returns the SNI of the handshake with each host connected to, including redirects
+func (c *httpCertDriver) GetSNI() map[string]driver.SNI {
+	return c.sni
+}
+
 func (c *httpCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
 	cert, found := c.certs[fp]
 	if found {
@@ -58,9 +68,13 @@ func (c *httpCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResu
 }
 
 // Driver creates a new SSL driver for HTTP Connections
-func Driver(timeout time.Duration, savePath string) (driver.Driver, error) {
+// driver option port sets the port to connect to, defaults to 443
+func Driver(timeout time.Duration, savePath string, opts *driver.Options) (driver.Driver, error) {
 	d := new(httpDriver)
-	d.port = "443"
+	d.port = opts.Get("port", "443")
+	if _, err := strconv.ParseUint(d.port, 10, 16); err != nil {
+		return nil, fmt.Errorf("invalid http port: %q", d.port)
+	}
 	if len(savePath) > 0 {
 		d.save = true
 		d.savePath = savePath
@@ -77,33 +91,46 @@ func (d *httpDriver) GetName() string {
 	return driverName
 }
 
-func (d *httpDriver) newHTTPCertDriver() *httpCertDriver {
+func (d *httpDriver) newHTTPCertDriver(ctx context.Context) *httpCertDriver {
 	result := &httpCertDriver{
 		parent:       d,
+		ctx:          ctx,
 		status:       make(status.Map),
 		fingerprints: make(driver.FingerprintMap),
 		certs:        make(map[fingerprint.Fingerprint]*driver.CertResult),
+		sni:          make(map[string]driver.SNI),
 	}
 	// set client & client.Transport separately so that dialTLS checkRedirect can be referenced
 	result.client = &http.Client{
 		Timeout:       d.timeout,
 		CheckRedirect: result.checkRedirect,
 	}
-	result.client.Transport = &http.Transport{
+	result.transport = &http.Transport{
 		TLSClientConfig:       d.tlsConfig,
 		TLSHandshakeTimeout:   d.timeout,
 		ResponseHeaderTimeout: d.timeout,
 		ExpectContinueTimeout: d.timeout,
 		DialTLS:               result.dialTLS,
 	}
+	result.client.Transport = result.transport
 	return result
 }
 
 // GetCert gets the certificates found for a given domain
-func (d *httpDriver) QueryDomain(host string) (driver.Result, error) {
-	results := d.newHTTPCertDriver()
-
-	resp, err := results.client.Get(fmt.Sprintf("https://%s", host))
+func (d *httpDriver) QueryDomain(ctx context.Context, host string) (driver.Result, error) {
+	results := d.newHTTPCertDriver(ctx)
+	// don't keep idle connections open once the query is done, they hold a host connection slot
+	defer results.transport.CloseIdleConnections()
+
+	url := fmt.Sprintf("https://%s", host)
+	if d.port != "443" {
+		url = fmt.Sprintf("https://%s", net.JoinHostPort(host, d.port))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return results, err
+	}
+	resp, err := results.client.Do(req)
 	fullStatus := status.CheckNetErr(err)
 	if fullStatus != status.GOOD {
 		return results, err // in some rare cases this error can be ignored
@@ -133,22 +160,36 @@ func (c *httpCertDriver) checkRedirect(req *http.Request, via []*http.Request) e
 }
 
 func (c *httpCertDriver) dialTLS(network, addr string) (net.Conn, error) {
-	dialer := &net.Dialer{Timeout: c.client.Timeout}
-	conn, err := tls.DialWithDialer(dialer, network, addr, c.parent.tlsConfig)
-	if conn == nil {
-		return conn, err
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	release := driver.AcquireHost(host)
+	rawConn, err := driver.DialContext(c.ctx, network, addr, c.client.Timeout)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// once the handshake is done the transport closes the connection if the request is cancelled
+	stop := driver.CloseOnCancel(c.ctx, rawConn)
+	tlsConn, err := tlsHandshake(rawConn, host, c.parent.tlsConfig, c.client.Timeout)
+	stop()
+	if err != nil {
+		rawConn.Close()
+		release()
+		return nil, err
 	}
+	conn := driver.LimitConn(tlsConn, release)
 	// get certs passing by
-	connState := conn.ConnectionState()
+	connState := tlsConn.ConnectionState()
 
 	// only look at leaf certificate which is valid for domain, rest of cert chain is ignored
 	certResult := driver.NewCertResult(connState.PeerCertificates[0])
 	c.certs[certResult.Fingerprint] = certResult
-	host, _, err := net.SplitHostPort(addr)
-	if err != nil {
-		return conn, err
-	}
 	c.fingerprints.Add(host, certResult.Fingerprint)
+	if _, found := c.sni[host]; !found {
+		c.sni[host] = driver.NewSNI(host, connState.PeerCertificates[0])
+	}
 
 	// save
 	if c.parent.save && len(connState.PeerCertificates) > 0 {
@@ -157,3 +198,37 @@ func (c *httpCertDriver) dialTLS(network, addr string) (net.Conn, error) {
 
 	return conn, err
 }
+
+// AcceptsTLSBelow returns true if the host completes a TLS handshake with a version below minVersion
+// only a handshake the host refused is false, connection failures during the handshake are errors
+func (d *httpDriver) AcceptsTLSBelow(ctx context.Context, host string, minVersion uint16) (bool, error) {
+	release := driver.AcquireHost(host)
+	defer release()
+	conn, err := driver.DialContext(ctx, "tcp", net.JoinHostPort(host, d.port), d.timeout)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	stop := driver.CloseOnCancel(ctx, conn)
+	defer stop()
+	_, err = tlsHandshake(conn, host, driver.BelowTLSConfig(d.tlsConfig, minVersion), d.timeout)
+	// any error left is from the handshake
+	if driver.HandshakeRejected(err) && ctx.Err() == nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// tlsHandshake performs a TLS handshake with host over conn, giving up after timeout
+func tlsHandshake(conn net.Conn, host string, config *tls.Config, timeout time.Duration) (*tls.Conn, error) {
+	if len(config.ServerName) == 0 {
+		config = config.Clone()
+		config.ServerName = host
+	}
+	tlsConn := tls.Client(conn, config)
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	return tlsConn, tlsConn.Handshake()
+}
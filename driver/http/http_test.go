@@ -0,0 +1,231 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/driver/internal/testutil"
+	"github.com/lanrat/certgraph/status"
+)
+
+// newSNIServer returns a TLS server presenting the certificate of the requested SNI, or the default certificate
+// requests to localhost are redirected to 127.0.0.1 if redirect is set
+func newSNIServer(t *testing.T, certs map[string]tls.Certificate, redirect bool) (*httptest.Server, string) {
+	t.Helper()
+	var port string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if redirect && r.Host == net.JoinHostPort("localhost", port) {
+			http.Redirect(w, r, "https://"+net.JoinHostPort("127.0.0.1", port)+"/", http.StatusFound)
+		}
+	}))
+	// the default certificate is also used for connections without SNI
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{certs[""]},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, ok := certs[hello.ServerName]
+			if !ok {
+				cert = certs[""]
+			}
+			return &cert, nil
+		},
+	}
+	server.StartTLS()
+	_, port, _ = net.SplitHostPort(server.Listener.Addr().String())
+	return server, port
+}
+
+// newTestDriver returns an http driver connecting to the port
+func newTestDriver(t *testing.T, port string) *httpDriver {
+	t.Helper()
+	opts := driver.NewOptions()
+	opts.Set("http.port=" + port)
+	d, err := Driver(time.Second, "", opts.Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.(*httpDriver)
+}
+
+func TestQueryDomainSNI(t *testing.T) {
+	defaultCert := testutil.Certificate(t, "default.test")
+	tests := []struct {
+		name      string
+		certs     map[string]tls.Certificate
+		presented string
+		mismatch  bool
+	}{
+		{"sni", map[string]tls.Certificate{"": defaultCert, "localhost": testutil.Certificate(t, "localhost")}, "localhost", false},
+		{"default certificate", map[string]tls.Certificate{"": defaultCert}, "default.test", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, port := newSNIServer(t, test.certs, false)
+			defer server.Close()
+
+			result, err := newTestDriver(t, port).QueryDomain(context.Background(), "localhost")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := result.GetStatus()["localhost"]; s.Status != status.GOOD {
+				t.Errorf("status %s, want Good", s.String())
+			}
+			sni := result.(driver.SNIResult).GetSNI()["localhost"]
+			want := driver.SNI{Requested: "localhost", Presented: test.presented, Mismatch: test.mismatch}
+			if sni != want {
+				t.Errorf("GetSNI returned %+v, want %+v", sni, want)
+			}
+			fingerprints, _ := result.GetFingerprints()
+			if len(fingerprints["localhost"]) != 1 {
+				t.Fatalf("found %v, want the certificate presented", fingerprints)
+			}
+			cert, err := result.QueryCert(fingerprints["localhost"][0])
+			if err != nil || cert.Domains[0] != test.presented {
+				t.Errorf("QueryCert returned %v, %v", cert, err)
+			}
+		})
+	}
+}
+
+func TestQueryDomainRedirect(t *testing.T) {
+	certs := map[string]tls.Certificate{"": testutil.Certificate(t, "default.test"), "localhost": testutil.Certificate(t, "localhost")}
+	server, port := newSNIServer(t, certs, true)
+	defer server.Close()
+
+	result, err := newTestDriver(t, port).QueryDomain(context.Background(), "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := result.GetStatus()
+	if s := statuses["localhost"]; s.Status != status.REDIRECT || s.Meta != "127.0.0.1" {
+		t.Errorf("localhost has status %s, want a redirect to 127.0.0.1", s.String())
+	}
+	if s := statuses["127.0.0.1"]; s.Status != status.GOOD {
+		t.Errorf("127.0.0.1 has status %s, want Good", s.String())
+	}
+	if related, _ := result.GetRelated(); len(related) != 1 || related[0] != "127.0.0.1" {
+		t.Errorf("GetRelated returned %v, want the redirect", related)
+	}
+
+	// the SNI of each host connected to is recorded, no SNI is sent for IP addresses
+	sni := result.(driver.SNIResult).GetSNI()
+	want := map[string]driver.SNI{
+		"localhost": {Requested: "localhost", Presented: "localhost"},
+		"127.0.0.1": {Requested: "127.0.0.1", Presented: "default.test", Mismatch: true},
+	}
+	for host, wantSNI := range want {
+		if sni[host] != wantSNI {
+			t.Errorf("SNI of %s is %+v, want %+v", host, sni[host], wantSNI)
+		}
+	}
+}
+
+func TestQueryDomainRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	result, err := newTestDriver(t, port).QueryDomain(context.Background(), "127.0.0.1")
+	if err == nil {
+		t.Fatal("QueryDomain of a closed port did not fail")
+	}
+	if fingerprints, _ := result.GetFingerprints(); len(fingerprints) != 0 {
+		t.Errorf("found %v on a closed port", fingerprints)
+	}
+}
+
+func TestAcceptsTLSBelow(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverMin  uint16
+		minVersion uint16
+		want       bool
+	}{
+		{"accepts old tls", tls.VersionTLS10, tls.VersionTLS13, true},
+		{"rejects old tls", tls.VersionTLS12, tls.VersionTLS12, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{testutil.Certificate(t, "localhost")}, MinVersion: test.serverMin}
+			// the rejected handshakes are expected
+			server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+			server.StartTLS()
+			defer server.Close()
+			_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+			accepts, err := newTestDriver(t, port).AcceptsTLSBelow(context.Background(), "localhost", test.minVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accepts != test.want {
+				t.Errorf("AcceptsTLSBelow = %v, want %v", accepts, test.want)
+			}
+		})
+	}
+}
+
+func TestAcceptsTLSBelowErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	release := make(chan struct{})
+	defer close(release)
+	closing := int32(1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if atomic.LoadInt32(&closing) == 1 {
+				conn.Close()
+				continue
+			}
+			go func() {
+				<-release
+				conn.Close()
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	d := newTestDriver(t, port)
+
+	// a connection closed during the handshake is not a refusal
+	if _, err := d.AcceptsTLSBelow(context.Background(), "127.0.0.1", tls.VersionTLS12); err == nil {
+		t.Error("AcceptsTLSBelow of a host that closed the connection did not fail")
+	}
+
+	atomic.StoreInt32(&closing, 0)
+	start := time.Now()
+	_, err = d.AcceptsTLSBelow(context.Background(), "127.0.0.1", tls.VersionTLS12)
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("AcceptsTLSBelow of a host that never finished the handshake returned %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second/2 {
+		t.Errorf("AcceptsTLSBelow gave up after %s, want the driver timeout", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start = time.Now()
+	if _, err := d.AcceptsTLSBelow(ctx, "127.0.0.1", tls.VersionTLS12); err == nil {
+		t.Error("AcceptsTLSBelow that was cancelled did not fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second/2 {
+		t.Errorf("AcceptsTLSBelow that was cancelled took %s, want it to stop once cancelled", elapsed)
+	}
+}
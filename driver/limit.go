@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrResponseTooLarge is returned when a response is larger than the maximum response size
+var ErrResponseTooLarge = errors.New("response exceeded maximum response size")
+
+// limitedReader reads from r until more than max bytes have been read
+type limitedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, fmt.Errorf("%w of %d bytes", ErrResponseTooLarge, l.max)
+	}
+	return n, err
+}
+
+// LimitReader returns a Reader that reads from r but returns ErrResponseTooLarge
+// once more than max bytes have been read, max <= 0 has no limit
+// used to protect against arbitrarily large responses from remote servers
+func LimitReader(r io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return &limitedReader{
+		r:   io.LimitReader(r, max+1),
+		max: max,
+	}
+}
@@ -0,0 +1,38 @@
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestLimitReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		max     int64
+		wantErr bool
+	}{
+		{"under", 10, 100, false},
+		{"exactly", 100, 100, false},
+		{"over", 101, 100, true},
+		{"far over", 1 << 20, 100, true},
+		{"no limit", 1 << 20, 0, false},
+	}
+	for _, test := range tests {
+		data, err := ioutil.ReadAll(LimitReader(bytes.NewReader(make([]byte, test.size)), test.max))
+		if test.wantErr {
+			if !errors.Is(err, ErrResponseTooLarge) {
+				t.Errorf("%s: reading %d bytes with a limit of %d returned %v, want %v", test.name, test.size, test.max, err, ErrResponseTooLarge)
+			}
+			if int64(len(data)) > test.max+1 {
+				t.Errorf("%s: read %d bytes past the limit of %d", test.name, len(data), test.max)
+			}
+			continue
+		}
+		if err != nil || len(data) != test.size {
+			t.Errorf("%s: read %d bytes and %v, want all %d bytes", test.name, len(data), err, test.size)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package multi implements a composite certgraph driver that queries multiple drivers
+// and merges their results
+package multi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/fingerprint"
+	"github.com/lanrat/certgraph/status"
+)
+
+type multiDriver struct {
+	name    string
+	drivers []driver.Driver
+}
+
+type multiCertDriver struct {
+	results      []driver.Result
+	fingerprints driver.FingerprintMap
+	// index of the result each certificate was found in
+	certResults map[fingerprint.Fingerprint]int
+	// names of the drivers each certificate was found by
+	certSources map[fingerprint.Fingerprint][]string
+}
+
+// Driver returns a driver that queries every one of the drivers for each domain and merges their results
+func Driver(drivers []driver.Driver) (driver.Driver, error) {
+	if len(drivers) == 0 {
+		return nil, fmt.Errorf("multi driver requires at least one driver")
+	}
+	names := make([]string, 0, len(drivers))
+	for _, d := range drivers {
+		names = append(names, d.GetName())
+	}
+	return &multiDriver{
+		name:    strings.Join(names, ","),
+		drivers: drivers,
+	}, nil
+}
+
+func (d *multiDriver) GetName() string {
+	return d.name
+}
+
+// QueryDomain queries all of the drivers in parallel
+// it is only an error if every driver fails to query the domain
+func (d *multiDriver) QueryDomain(ctx context.Context, domain string) (driver.Result, error) {
+	results := make([]driver.Result, len(d.drivers))
+	errs := make([]error, len(d.drivers))
+	var wg sync.WaitGroup
+	for i := range d.drivers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = d.drivers[i].QueryDomain(ctx, domain)
+		}(i)
+	}
+	wg.Wait()
+
+	multiResult := &multiCertDriver{
+		fingerprints: make(driver.FingerprintMap),
+		certResults:  make(map[fingerprint.Fingerprint]int),
+		certSources:  make(map[fingerprint.Fingerprint][]string),
+	}
+	var firstErr error
+	for i, result := range results {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", d.drivers[i].GetName(), errs[i])
+			}
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		multiResult.add(d.drivers[i].GetName(), result)
+	}
+	if len(multiResult.results) == 0 {
+		return multiResult, firstErr
+	}
+	return multiResult, nil
+}
+
+// AcceptsTLSBelow returns true if the domain accepted a TLS version below minVersion with any of the drivers that can check
+// it is only an error if none of the drivers could check the domain
+func (d *multiDriver) AcceptsTLSBelow(ctx context.Context, domain string, minVersion uint16) (bool, error) {
+	var firstErr error
+	checked := false
+	for _, child := range d.drivers {
+		prober, ok := driver.AsTLSProber(child)
+		if !ok {
+			continue
+		}
+		accepted, err := prober.AcceptsTLSBelow(ctx, domain, minVersion)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", child.GetName(), err)
+			}
+			continue
+		}
+		if accepted {
+			return true, nil
+		}
+		checked = true
+	}
+	if checked {
+		return false, nil
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("none of the %s drivers can check TLS versions", d.name)
+	}
+	return false, firstErr
+}
+
+// add merges the fingerprints of the result found by the named driver with the others
+func (c *multiCertDriver) add(name string, result driver.Result) {
+	fingerprintMap, err := result.GetFingerprints()
+	if err != nil {
+		return
+	}
+	c.results = append(c.results, result)
+	index := len(c.results) - 1
+	for domain, fingerprints := range fingerprintMap {
+		for _, fp := range fingerprints {
+			c.addSource(fp, name)
+			if _, found := c.certResults[fp]; found {
+				continue
+			}
+			c.certResults[fp] = index
+			c.fingerprints.Add(domain, fp)
+		}
+	}
+}
+
+// addSource records that the named driver found the certificate
+func (c *multiCertDriver) addSource(fp fingerprint.Fingerprint, name string) {
+	for _, source := range c.certSources[fp] {
+		if source == name {
+			return
+		}
+	}
+	c.certSources[fp] = append(c.certSources[fp], name)
+}
+
+// Sources returns the names of the drivers that found the certificate, in the order of the drivers
+func (c *multiCertDriver) Sources(fp fingerprint.Fingerprint) []string {
+	return c.certSources[fp]
+}
+
+func (c *multiCertDriver) GetFingerprints() (driver.FingerprintMap, error) {
+	return c.fingerprints, nil
+}
+
+// GetStatus returns the status reported by the first driver for each domain
+func (c *multiCertDriver) GetStatus() status.Map {
+	statuses := make(status.Map)
+	for _, result := range c.results {
+		for domain, s := range result.GetStatus() {
+			if _, found := statuses[domain]; !found {
+				statuses[domain] = s
+			}
+		}
+	}
+	return statuses
+}
+
+// GetRelated returns the related domains from all of the drivers
+func (c *multiCertDriver) GetRelated() ([]string, error) {
+	relatedMap := make(map[string]bool)
+	related := make([]string, 0)
+	for _, result := range c.results {
+		domains, err := result.GetRelated()
+		if err != nil {
+			continue
+		}
+		for _, domain := range domains {
+			if !relatedMap[domain] {
+				relatedMap[domain] = true
+				related = append(related, domain)
+			}
+		}
+	}
+	return related, nil
+}
+
+// QueryCert queries the certificate from the driver that found it
+func (c *multiCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
+	index, found := c.certResults[fp]
+	if !found {
+		return nil, fmt.Errorf("certificate with Fingerprint %s not found", fp.HexString())
+	}
+	return c.results[index].QueryCert(fp)
+}
+
+// GetSNI returns the SNI reported by the first driver that performed a TLS handshake with each host
+func (c *multiCertDriver) GetSNI() map[string]driver.SNI {
+	snis := make(map[string]driver.SNI)
+	for _, result := range c.results {
+		sniResult, ok := result.(driver.SNIResult)
+		if !ok {
+			continue
+		}
+		for host, sni := range sniResult.GetSNI() {
+			if _, found := snis[host]; !found {
+				snis[host] = sni
+			}
+		}
+	}
+	return snis
+}
@@ -0,0 +1,160 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/fingerprint"
+	"github.com/lanrat/certgraph/status"
+)
+
+// fakeDriver returns the same fingerprints for every domain, or err
+type fakeDriver struct {
+	name         string
+	fingerprints []fingerprint.Fingerprint
+	sni          *driver.SNI
+	err          error
+}
+
+type fakeResult struct {
+	domain string
+	d      *fakeDriver
+}
+
+// sniResult is a fakeResult that performed a TLS handshake
+type sniResult struct {
+	fakeResult
+}
+
+func (d *fakeDriver) GetName() string {
+	return d.name
+}
+
+func (d *fakeDriver) QueryDomain(ctx context.Context, domain string) (driver.Result, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.sni != nil {
+		return &sniResult{fakeResult{domain, d}}, nil
+	}
+	return &fakeResult{domain, d}, nil
+}
+
+func (r *fakeResult) GetStatus() status.Map {
+	return status.NewMap(r.domain, status.NewMeta(status.GOOD, r.d.name))
+}
+
+func (r *fakeResult) GetRelated() ([]string, error) {
+	return []string{r.d.name + ".related"}, nil
+}
+
+func (r *fakeResult) GetFingerprints() (driver.FingerprintMap, error) {
+	fingerprints := make(driver.FingerprintMap)
+	for _, fp := range r.d.fingerprints {
+		fingerprints.Add(r.domain, fp)
+	}
+	return fingerprints, nil
+}
+
+func (r *fakeResult) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
+	return &driver.CertResult{Fingerprint: fp, Domains: []string{r.d.name}}, nil
+}
+
+func (r *sniResult) GetSNI() map[string]driver.SNI {
+	return map[string]driver.SNI{r.domain: *r.d.sni}
+}
+
+func fp(b byte) fingerprint.Fingerprint {
+	var f fingerprint.Fingerprint
+	f[0] = b
+	return f
+}
+
+func TestMultiDriver(t *testing.T) {
+	a := &fakeDriver{name: "a", fingerprints: []fingerprint.Fingerprint{fp(1), fp(2)}}
+	b := &fakeDriver{name: "b", fingerprints: []fingerprint.Fingerprint{fp(2), fp(3)}, sni: &driver.SNI{Requested: "domain.test", Presented: "other.test", Mismatch: true}}
+	failed := &fakeDriver{name: "failed", err: errors.New("refused")}
+
+	d, err := Driver([]driver.Driver{failed, a, driver.RateLimit(b, 1000, nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.GetName() != "failed,a,b" {
+		t.Errorf("GetName() = %q", d.GetName())
+	}
+	result, err := d.QueryDomain(context.Background(), "domain.test")
+	if err != nil {
+		t.Fatalf("QueryDomain returned %v, want it to succeed as only one driver failed", err)
+	}
+
+	fingerprints, err := result.GetFingerprints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fingerprint.Fingerprint{fp(1), fp(2), fp(3)}
+	if !reflect.DeepEqual(fingerprints["domain.test"], want) {
+		t.Errorf("fingerprints = %v, want %v", fingerprints["domain.test"], want)
+	}
+
+	sources := map[fingerprint.Fingerprint][]string{
+		fp(1): {"a"},
+		fp(2): {"a", "b"},
+		fp(3): {"b"},
+	}
+	for f, want := range sources {
+		got := result.(driver.SourceResult).Sources(f)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Sources(%v) = %v, want %v", f.HexString(), got, want)
+		}
+	}
+
+	// certificates are queried from the first driver that found them
+	certDrivers := map[fingerprint.Fingerprint]string{fp(1): "a", fp(2): "a", fp(3): "b"}
+	for f, want := range certDrivers {
+		cert, err := result.QueryCert(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.Domains[0] != want {
+			t.Errorf("QueryCert(%v) was queried from %s, want %s", f.HexString(), cert.Domains[0], want)
+		}
+	}
+	if _, err := result.QueryCert(fp(4)); err == nil {
+		t.Error("QueryCert of an unknown certificate did not fail")
+	}
+
+	if s := result.GetStatus()["domain.test"]; s.Meta != "a" {
+		t.Errorf("status is from %s, want the first driver to succeed", s.Meta)
+	}
+	related, _ := result.GetRelated()
+	if !reflect.DeepEqual(related, []string{"a.related", "b.related"}) {
+		t.Errorf("GetRelated() = %v", related)
+	}
+
+	// the SNI of the rate limited driver is not hidden by the rate limiter
+	sni, found := result.(driver.SNIResult).GetSNI()["domain.test"]
+	if !found || !sni.Mismatch || sni.Presented != "other.test" {
+		t.Errorf("GetSNI() = %v, want the SNI of b", sni)
+	}
+}
+
+func TestMultiDriverErrors(t *testing.T) {
+	if _, err := Driver(nil); err == nil {
+		t.Error("Driver() with no drivers did not fail")
+	}
+
+	d, err := Driver([]driver.Driver{
+		&fakeDriver{name: "a", err: errors.New("refused")},
+		&fakeDriver{name: "b", err: errors.New("timeout")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.QueryDomain(context.Background(), "domain.test")
+	if err == nil || err.Error() != "a: refused" {
+		t.Errorf("QueryDomain returned %v, want the error of the first driver", err)
+	}
+}
@@ -0,0 +1,120 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options holds the driver specific key=value options passed to a driver's constructor
+// it implements flag.Value so it can be set with a repeated flag
+type Options struct {
+	values map[string]string
+	used   map[string]bool
+	prefix string
+}
+
+// NewOptions returns a new empty set of Options
+func NewOptions() *Options {
+	return &Options{
+		values: make(map[string]string),
+		used:   make(map[string]bool),
+	}
+}
+
+// String implements the flag.Value interface
+func (o *Options) String() string {
+	if o == nil {
+		return ""
+	}
+	keys := o.keys()
+	options := make([]string, 0, len(keys))
+	for _, key := range keys {
+		options = append(options, key+"="+o.values[key])
+	}
+	return strings.Join(options, ",")
+}
+
+// Set implements the flag.Value interface, parsing a single key=value option
+func (o *Options) Set(option string) error {
+	i := strings.Index(option, "=")
+	if i < 1 {
+		return fmt.Errorf("driver option %q is not in the form key=value", option)
+	}
+	o.values[strings.ToLower(option[:i])] = option[i+1:]
+	return nil
+}
+
+// Sub returns a view of the options for the named driver
+// options set as name.key take precedence over options set as key
+func (o *Options) Sub(name string) *Options {
+	return &Options{
+		values: o.values,
+		used:   o.used,
+		prefix: o.prefix + strings.ToLower(name) + ".",
+	}
+}
+
+// Get returns the value of the option key, or def if it was not set
+func (o *Options) Get(key, def string) string {
+	if len(o.prefix) > 0 {
+		if value, ok := o.values[o.prefix+key]; ok {
+			o.used[o.prefix+key] = true
+			return value
+		}
+	}
+	o.used[key] = true
+	value, ok := o.values[key]
+	if !ok {
+		return def
+	}
+	return value
+}
+
+// Int returns the value of the option key as an int, or def if it was not set
+func (o *Options) Int(key string, def int) (int, error) {
+	value := o.Get(key, "")
+	if len(value) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def, fmt.Errorf("driver option %s: %q is not a number", key, value)
+	}
+	return n, nil
+}
+
+// Float returns the value of the option key as a float64, or def if it was not set
+func (o *Options) Float(key string, def float64) (float64, error) {
+	value := o.Get(key, "")
+	if len(value) == 0 {
+		return def, nil
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return def, fmt.Errorf("driver option %s: %q is not a number", key, value)
+	}
+	return n, nil
+}
+
+// Unused returns the sorted keys of the options that were set but never read by the driver
+func (o *Options) Unused() []string {
+	unused := make([]string, 0)
+	for _, key := range o.keys() {
+		if !o.used[key] {
+			unused = append(unused, key)
+		}
+	}
+	return unused
+}
+
+// keys returns the sorted keys of the options that were set
+func (o *Options) keys() []string {
+	keys := make([]string, 0, len(o.values))
+	for key := range o.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
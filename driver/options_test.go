@@ -0,0 +1,45 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	opts := NewOptions()
+	for _, option := range []string{"pages=3", "Censys.Pages=5", "rate=0.5", "bad=x", "url=http://x/?a=b"} {
+		if err := opts.Set(option); err != nil {
+			t.Fatalf("Set(%q) returned %v", option, err)
+		}
+	}
+	if err := opts.Set("=value"); err == nil {
+		t.Error("Set of an option without a key did not fail")
+	}
+	if err := opts.Set("novalue"); err == nil {
+		t.Error("Set of an option without a value did not fail")
+	}
+	if got := opts.String(); got != "bad=x,censys.pages=5,pages=3,rate=0.5,url=http://x/?a=b" {
+		t.Errorf("String() = %s", got)
+	}
+
+	// driver specific options take precedence
+	if pages, err := opts.Sub("censys").Int("pages", 1); pages != 5 || err != nil {
+		t.Errorf("censys pages = %d, %v, want 5", pages, err)
+	}
+	if pages, err := opts.Sub("crtsh").Int("pages", 1); pages != 3 || err != nil {
+		t.Errorf("crtsh pages = %d, %v, want the shared 3", pages, err)
+	}
+	if rate, err := opts.Float("rate", 1); rate != 0.5 || err != nil {
+		t.Errorf("rate = %f, %v, want 0.5", rate, err)
+	}
+	if _, err := opts.Int("bad", 1); err == nil {
+		t.Error("Int of an option that is not a number did not fail")
+	}
+	if got := opts.Get("missing", "default"); got != "default" {
+		t.Errorf("Get of an option that was not set = %s, want the default", got)
+	}
+
+	if unused := opts.Unused(); !reflect.DeepEqual(unused, []string{"url"}) {
+		t.Errorf("Unused() = %v, want [url]", unused)
+	}
+}
@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+// rateLimiter spaces out requests so that no more than a fixed number are made per second
+type rateLimiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	next     time.Time
+	throttle func(wait time.Duration)
+}
+
+// wait blocks until the next request may be made, or ctx is cancelled
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.lock.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.lock.Unlock()
+
+	if wait > 0 {
+		if l.throttle != nil {
+			l.throttle(wait)
+		}
+		return sleep(ctx, wait)
+	}
+	return nil
+}
+
+// rateDriver is a Driver that limits the rate of requests made to the Driver it wraps
+type rateDriver struct {
+	Driver
+	limiter *rateLimiter
+}
+
+// rateResult is a Result that limits the rate of certificate requests made to the Result it wraps
+// the optional interfaces of the Result it wraps are forwarded, returning nothing if the Result does not implement them
+type rateResult struct {
+	Result
+	limiter *rateLimiter
+}
+
+// RateLimit returns the driver limited to perSecond domain and certificate queries per second
+// throttle, if not nil, is called with how long each throttled query will wait
+func RateLimit(d Driver, perSecond float64, throttle func(wait time.Duration)) Driver {
+	return &rateDriver{
+		Driver: d,
+		limiter: &rateLimiter{
+			interval: time.Duration(float64(time.Second) / perSecond),
+			throttle: throttle,
+		},
+	}
+}
+
+// Unwrap returns the driver being rate limited
+func (d *rateDriver) Unwrap() Driver {
+	return d.Driver
+}
+
+// QueryDomain waits for the rate limit before querying the domain
+func (d *rateDriver) QueryDomain(ctx context.Context, domain string) (Result, error) {
+	if err := d.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	result, err := d.Driver.QueryDomain(ctx, domain)
+	if result != nil {
+		result = &rateResult{Result: result, limiter: d.limiter}
+	}
+	return result, err
+}
+
+// QueryCert waits for the rate limit before querying the certificate
+func (r *rateResult) QueryCert(fp fingerprint.Fingerprint) (*CertResult, error) {
+	r.limiter.wait(context.Background())
+	return r.Result.QueryCert(fp)
+}
+
+// GetSNI returns the SNI of the Result being rate limited, if it performed TLS handshakes
+func (r *rateResult) GetSNI() map[string]SNI {
+	if sniResult, ok := r.Result.(SNIResult); ok {
+		return sniResult.GetSNI()
+	}
+	return nil
+}
+
+// Sources returns the drivers that found the certificate in the Result being rate limited, if it merged the results of other drivers
+func (r *rateResult) Sources(fp fingerprint.Fingerprint) []string {
+	if sourceResult, ok := r.Result.(SourceResult); ok {
+		return sourceResult.Sources(fp)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeDriver returns the result for every domain
+type fakeDriver struct {
+	result Result
+}
+
+func (d *fakeDriver) GetName() string {
+	return "fake"
+}
+
+func (d *fakeDriver) QueryDomain(ctx context.Context, domain string) (Result, error) {
+	return d.result, nil
+}
+
+// fakeSNIResult is a fakeResult that performed a TLS handshake
+type fakeSNIResult struct {
+	*fakeResult
+	sni map[string]SNI
+}
+
+func (r *fakeSNIResult) GetSNI() map[string]SNI {
+	return r.sni
+}
+
+func TestRateLimit(t *testing.T) {
+	var throttled []time.Duration
+	d := RateLimit(&fakeDriver{result: newFakeResult("a.test")}, 100, func(wait time.Duration) {
+		throttled = append(throttled, wait)
+	})
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		_, err := d.QueryDomain(context.Background(), "a.test")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first query is not throttled, the next 4 wait 10ms each
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("5 queries at 100 per second took %v, want at least 40ms", elapsed)
+	}
+	if len(throttled) != 4 {
+		t.Errorf("throttled %d queries, want 4", len(throttled))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d = RateLimit(&fakeDriver{result: newFakeResult("a.test")}, 0.01, nil)
+	d.QueryDomain(ctx, "a.test")
+	if _, err := d.QueryDomain(ctx, "a.test"); err != context.Canceled {
+		t.Errorf("throttled QueryDomain with a cancelled context returned %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRateResultForwarding(t *testing.T) {
+	sni := map[string]SNI{"a.test": {Requested: "a.test", Presented: "b.test", Mismatch: true}}
+	tests := []struct {
+		name   string
+		result Result
+		want   map[string]SNI
+	}{
+		{"without sni", newFakeResult("a.test"), nil},
+		{"with sni", &fakeSNIResult{newFakeResult("a.test"), sni}, sni},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := RateLimit(&fakeDriver{result: test.result}, 1000, nil)
+			result, err := d.QueryDomain(context.Background(), "a.test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sniResult, ok := result.(SNIResult)
+			if !ok {
+				t.Fatal("the rate limited result does not implement SNIResult")
+			}
+			got := sniResult.GetSNI()
+			if len(got) != len(test.want) || got["a.test"] != test.want["a.test"] {
+				t.Errorf("GetSNI() = %v, want %v", got, test.want)
+			}
+			if sources := result.(SourceResult).Sources(fakeFingerprint(1)); sources != nil {
+				t.Errorf("Sources() = %v, want nil for a result that does not merge other drivers", sources)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// retryBackoff is how long to wait before the first retry of a query, doubling for each retry after it
+// it is a variable so tests don't have to wait for it
+var retryBackoff = 1 * time.Second
+
+// RetryBudget limits the number of retries made across every driver sharing it
+type RetryBudget struct {
+	limit     int64
+	used      int64
+	skipped   int64
+	once      sync.Once
+	exhausted func()
+}
+
+// NewRetryBudget returns a RetryBudget allowing up to limit retries, 0 has no limit
+// exhausted, if not nil, is called once when a retry is first skipped because the budget has been used up
+func NewRetryBudget(limit int64, exhausted func()) *RetryBudget {
+	return &RetryBudget{limit: limit, exhausted: exhausted}
+}
+
+// take takes a retry from the budget, returning false if the budget has been used up
+func (b *RetryBudget) take() bool {
+	for {
+		used := atomic.LoadInt64(&b.used)
+		if b.limit > 0 && used >= b.limit {
+			atomic.AddInt64(&b.skipped, 1)
+			if b.exhausted != nil {
+				b.once.Do(b.exhausted)
+			}
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.used, used, used+1) {
+			return true
+		}
+	}
+}
+
+// String returns a one line summary of the retries made and skipped
+func (b *RetryBudget) String() string {
+	budget := "no limit"
+	if b.limit > 0 {
+		budget = fmt.Sprintf("a budget of %d", b.limit)
+	}
+	return fmt.Sprintf("%d retries used of %s, %d retries skipped", atomic.LoadInt64(&b.used), budget, atomic.LoadInt64(&b.skipped))
+}
+
+// ToMap returns a map of the retries made and skipped for JSON serialization
+func (b *RetryBudget) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"budget":  b.limit,
+		"used":    atomic.LoadInt64(&b.used),
+		"skipped": atomic.LoadInt64(&b.skipped),
+	}
+}
+
+// retryDriver is a Driver that retries the domain queries of the Driver it wraps that timed out or were rate limited
+type retryDriver struct {
+	Driver
+	retries uint
+	budget  *RetryBudget
+	retry   func(domain string, wait time.Duration, err error)
+}
+
+// Retry returns the driver with domain queries that time out or are rate limited retried up to retries times,
+// with an exponential backoff, as long as budget allows it
+// retry, if not nil, is called before each retry with how long it will wait and the error being retried
+func Retry(d Driver, retries uint, budget *RetryBudget, retry func(domain string, wait time.Duration, err error)) Driver {
+	return &retryDriver{Driver: d, retries: retries, budget: budget, retry: retry}
+}
+
+// Unwrap returns the driver being retried
+func (d *retryDriver) Unwrap() Driver {
+	return d.Driver
+}
+
+// QueryDomain queries the domain, retrying timeouts and rate limits
+func (d *retryDriver) QueryDomain(ctx context.Context, domain string) (Result, error) {
+	wait := retryBackoff
+	for attempt := uint(0); ; attempt++ {
+		result, err := d.Driver.QueryDomain(ctx, domain)
+		if err == nil || attempt >= d.retries || !retryable(err) || !d.budget.take() {
+			return result, err
+		}
+		if d.retry != nil {
+			d.retry(domain, wait, err)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return result, err
+		}
+		wait *= 2
+	}
+}
+
+// retryable returns true if the query that returned err may succeed if retried
+func retryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || isTimeout(err)
+}
+
+// sleep waits for d, returning early with the error of ctx if it is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,145 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingDriver returns err for the first failures queries, then the result
+type failingDriver struct {
+	fakeDriver
+	err      error
+	failures int32
+	queries  int32
+}
+
+func (d *failingDriver) QueryDomain(ctx context.Context, domain string) (Result, error) {
+	if atomic.AddInt32(&d.queries, 1) <= d.failures {
+		return nil, d.err
+	}
+	return d.fakeDriver.QueryDomain(ctx, domain)
+}
+
+func TestRetryBudget(t *testing.T) {
+	const takers = 50
+	var exhausted int32
+	budget := NewRetryBudget(10, func() {
+		atomic.AddInt32(&exhausted, 1)
+	})
+	var taken int32
+	var wg sync.WaitGroup
+	for i := 0; i < takers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if budget.take() {
+				atomic.AddInt32(&taken, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 10 {
+		t.Errorf("%d retries taken from a budget of 10", taken)
+	}
+	if exhausted != 1 {
+		t.Errorf("exhausted called %d times, want once", exhausted)
+	}
+	if s := budget.String(); s != "10 retries used of a budget of 10, 40 retries skipped" {
+		t.Errorf("String() = %s", s)
+	}
+
+	unlimited := NewRetryBudget(0, nil)
+	for i := 0; i < takers; i++ {
+		if !unlimited.take() {
+			t.Fatalf("retry %d was skipped with no limit", i)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	defer func(backoff time.Duration) {
+		retryBackoff = backoff
+	}(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	timeout := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+	tests := []struct {
+		name        string
+		err         error
+		failures    int32
+		retries     uint
+		budget      int64
+		wantErr     bool
+		wantQueries int32
+	}{
+		{"success", nil, 0, 3, 0, false, 1},
+		{"rate limited", fmt.Errorf("crtsh: %w", ErrRateLimited), 2, 3, 0, false, 3},
+		{"timeout", timeout, 2, 3, 0, false, 3},
+		{"out of retries", ErrRateLimited, 5, 2, 0, true, 3},
+		{"out of budget", ErrRateLimited, 5, 3, 1, true, 2},
+		{"not retryable", errors.New("bad response"), 2, 3, 0, true, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &failingDriver{fakeDriver: fakeDriver{result: newFakeResult("a.test")}, err: test.err, failures: test.failures}
+			var retried int32
+			r := Retry(d, test.retries, NewRetryBudget(test.budget, nil), func(domain string, wait time.Duration, err error) {
+				atomic.AddInt32(&retried, 1)
+			})
+			_, err := r.QueryDomain(context.Background(), "a.test")
+			if (err != nil) != test.wantErr {
+				t.Errorf("QueryDomain returned %v, want error %v", err, test.wantErr)
+			}
+			if d.queries != test.wantQueries || retried != test.wantQueries-1 {
+				t.Errorf("queried %d times and retried %d times, want %d queries", d.queries, retried, test.wantQueries)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetShared(t *testing.T) {
+	defer func(backoff time.Duration) {
+		retryBackoff = backoff
+	}(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	// every query is rate limited, the drivers share a budget of 8 retries between them
+	const queries = 20
+	budget := NewRetryBudget(8, nil)
+	drivers := []*failingDriver{
+		{fakeDriver: fakeDriver{result: newFakeResult("a.test")}, err: ErrRateLimited, failures: queries * 10},
+		{fakeDriver: fakeDriver{result: newFakeResult("a.test")}, err: ErrRateLimited, failures: queries * 10},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < queries; i++ {
+		d := Retry(drivers[i%len(drivers)], 5, budget, nil)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.QueryDomain(context.Background(), "a.test"); !errors.Is(err, ErrRateLimited) {
+				t.Errorf("QueryDomain returned %v, want %v", err, ErrRateLimited)
+			}
+		}()
+	}
+	wg.Wait()
+	if total := drivers[0].queries + drivers[1].queries; total != queries+8 {
+		t.Errorf("made %d queries, want the %d queries and the 8 retries of the budget", total, queries)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	d := &failingDriver{fakeDriver: fakeDriver{result: newFakeResult("a.test")}, err: ErrRateLimited, failures: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := Retry(d, 3, NewRetryBudget(0, nil), func(domain string, wait time.Duration, err error) {
+		cancel()
+	})
+	if _, err := r.QueryDomain(ctx, "a.test"); err != context.Canceled {
+		t.Errorf("QueryDomain cancelled while waiting to retry returned %v, want %v", err, context.Canceled)
+	}
+}
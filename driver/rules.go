@@ -0,0 +1,128 @@
+package driver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rules route each domain to the driver that should query it
+// exact rules take precedence, then the longest matching suffix rule, then the first matching regex rule
+type Rules struct {
+	exact    map[string]string
+	suffixes []rule
+	regexps  []rule
+	drivers  []string
+}
+
+// rule maps a suffix or regex pattern to a driver
+type rule struct {
+	suffix string
+	regex  *regexp.Regexp
+	driver string
+}
+
+// LoadRules loads the routing rules from the file at path
+func LoadRules(path string) (*Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseRules parses routing rules, one "pattern driver" rule per line
+// patterns in the form *.example.com match the subdomains of example.com,
+// patterns in the form /regex/ match the domains matching the regular expression,
+// and all other patterns match the domain exactly
+// blank lines and lines starting with # are ignored
+func ParseRules(r io.Reader) (*Rules, error) {
+	rules := &Rules{exact: make(map[string]string)}
+	seenDrivers := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: rule %q is not in the form pattern driver", line, text)
+		}
+		pattern, driver := fields[0], fields[1]
+		for _, name := range strings.Split(driver, ",") {
+			if !isDriver(name) {
+				return nil, fmt.Errorf("line %d: unknown driver %s", line, name)
+			}
+		}
+
+		switch {
+		case len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"):
+			regex, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			rules.regexps = append(rules.regexps, rule{regex: regex, driver: driver})
+		case strings.HasPrefix(pattern, "*."):
+			rules.suffixes = append(rules.suffixes, rule{suffix: strings.ToLower(pattern[1:]), driver: driver})
+		default:
+			rules.exact[strings.ToLower(pattern)] = driver
+		}
+		if !seenDrivers[driver] {
+			seenDrivers[driver] = true
+			rules.drivers = append(rules.drivers, driver)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// the longest suffix is the most specific
+	sort.SliceStable(rules.suffixes, func(i, j int) bool {
+		return len(rules.suffixes[i].suffix) > len(rules.suffixes[j].suffix)
+	})
+	return rules, nil
+}
+
+// isDriver returns true if name is a registered driver
+func isDriver(name string) bool {
+	for _, driver := range Drivers {
+		if driver == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the driver the domain is routed to, and false if no rule matches the domain
+func (r *Rules) Match(domain string) (string, bool) {
+	domain = strings.ToLower(domain)
+	if driver, ok := r.exact[domain]; ok {
+		return driver, true
+	}
+	for _, rule := range r.suffixes {
+		if strings.HasSuffix(domain, rule.suffix) {
+			return rule.driver, true
+		}
+	}
+	for _, rule := range r.regexps {
+		if rule.regex.MatchString(domain) {
+			return rule.driver, true
+		}
+	}
+	return "", false
+}
+
+// Drivers returns the drivers used by the rules in the order they first appear
+func (r *Rules) Drivers() []string {
+	return r.drivers
+}
@@ -0,0 +1,87 @@
+package driver
+
+import (
+	"strings"
+	"testing"
+)
+
+func init() {
+	AddDriver("exact")
+	AddDriver("suffix")
+	AddDriver("longer")
+	AddDriver("regex")
+	AddDriver("other")
+}
+
+func TestRulesMatch(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# exact > longest suffix > regex
+/^api\./ regex
+/.*/ other
+*.example.com suffix
+*.dev.example.com longer
+www.dev.example.com exact
+API.Example.ORG exact
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		domain string
+		want   string
+		ok     bool
+	}{
+		{"www.dev.example.com", "exact", true},
+		{"WWW.DEV.EXAMPLE.COM", "exact", true},
+		{"api.example.org", "exact", true},
+		{"mail.dev.example.com", "longer", true},
+		{"api.dev.example.com", "longer", true},
+		{"dev.example.com", "suffix", true},
+		{"api.example.com", "suffix", true},
+		// *.example.com only matches subdomains, leaving the catch all regex
+		{"example.com", "other", true},
+		{"api.test", "regex", true},
+		{"www.test", "other", true},
+	}
+	for _, test := range tests {
+		got, ok := rules.Match(test.domain)
+		if got != test.want || ok != test.ok {
+			t.Errorf("Match(%s) = %s, %v, want %s, %v", test.domain, got, ok, test.want, test.ok)
+		}
+	}
+
+	want := []string{"regex", "other", "suffix", "longer", "exact"}
+	if drivers := rules.Drivers(); strings.Join(drivers, " ") != strings.Join(want, " ") {
+		t.Errorf("Drivers() = %v, want %v", drivers, want)
+	}
+}
+
+func TestRulesNoMatch(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader("*.example.com suffix\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if driver, ok := rules.Match("example.net"); ok {
+		t.Errorf("Match(example.net) = %s, want no match", driver)
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"missing driver", "example.com\n", "line 1"},
+		{"extra field", "# comment\nexample.com exact other\n", "line 2"},
+		{"unknown driver", "example.com unknown\n", "unknown driver unknown"},
+		{"unknown driver in list", "example.com exact,unknown\n", "unknown driver unknown"},
+		{"bad regex", "/(/ regex\n", "line 1"},
+	}
+	for _, test := range tests {
+		_, err := ParseRules(strings.NewReader(test.rules))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParseRules(%s) returned %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+}
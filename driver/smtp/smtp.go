@@ -5,10 +5,12 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"net/smtp"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,12 +21,32 @@ import (
 
 const driverName = "smtp"
 
+// how long to wait for the server to respond to QUIT once the certificates have been retrieved
+const quitTimeout = 1 * time.Second
+
+// errNoStartTLS is returned for servers that do not support STARTTLS
+var errNoStartTLS = errors.New("smtp server does not support STARTTLS")
+
+// handshakeError is returned when the TLS handshake after STARTTLS fails
+type handshakeError struct {
+	err error
+}
+
+func (e *handshakeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *handshakeError) Unwrap() error {
+	return e.err
+}
+
 func init() {
 	driver.AddDriver(driverName)
 }
 
 type smtpDriver struct {
 	port      string
+	ehlo      string
 	save      bool
 	savePath  string
 	tlsConfig *tls.Config
@@ -37,6 +59,7 @@ type smtpCertDriver struct {
 	status       status.Map
 	mx           []string
 	certs        map[fingerprint.Fingerprint]*driver.CertResult
+	sni          map[string]driver.SNI
 }
 
 func (c *smtpCertDriver) GetFingerprints() (driver.FingerprintMap, error) {
@@ -51,6 +74,11 @@ func (c *smtpCertDriver) GetRelated() ([]string, error) {
 	return c.mx, nil
 }
 
+// GetSNI returns the SNI of the STARTTLS handshake with the host
+func (c *smtpCertDriver) GetSNI() map[string]driver.SNI {
+	return c.sni
+}
+
 func (c *smtpCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResult, error) {
 	cert, found := c.certs[fp]
 	if found {
@@ -60,9 +88,15 @@ func (c *smtpCertDriver) QueryCert(fp fingerprint.Fingerprint) (*driver.CertResu
 }
 
 // Driver creates a new SSL driver for SMTP Connections
-func Driver(timeout time.Duration, savePath string) (driver.Driver, error) {
+// driver option port sets the port to connect to, defaults to 25
+// driver option ehlo sets the hostname to send in the EHLO command, defaults to localhost
+func Driver(timeout time.Duration, savePath string, opts *driver.Options) (driver.Driver, error) {
 	d := new(smtpDriver)
-	d.port = "25"
+	d.port = opts.Get("port", "25")
+	if _, err := strconv.ParseUint(d.port, 10, 16); err != nil {
+		return nil, fmt.Errorf("invalid smtp port: %q", d.port)
+	}
+	d.ehlo = opts.Get("ehlo", "")
 	if len(savePath) > 0 {
 		d.save = true
 		d.savePath = savePath
@@ -79,44 +113,80 @@ func (d *smtpDriver) GetName() string {
 	return driverName
 }
 
-func (d *smtpDriver) smtpGetCerts(host string) ([]*x509.Certificate, error) {
+// smtpGetCerts connects to the host's SMTP server and returns the certificates presented after STARTTLS with tlsConfig
+// every phase of the connection has its own deadline so a stalled server can't hang the driver
+// cancelling ctx closes the connection
+func (d *smtpDriver) smtpGetCerts(ctx context.Context, host string, tlsConfig *tls.Config) ([]*x509.Certificate, error) {
 	var certs []*x509.Certificate
 	addr := net.JoinHostPort(host, d.port)
-	dialer := &net.Dialer{Timeout: d.timeout}
 
-	conn, err := dialer.Dial("tcp", addr)
+	release := driver.AcquireHost(host)
+	defer release()
+	conn, err := driver.DialContext(ctx, "tcp", addr, d.timeout)
 	if err != nil {
 		return certs, err
 	}
 	defer conn.Close()
-	smtp, err := smtp.NewClient(conn, host)
+	defer driver.CloseOnCancel(ctx, conn)()
+
+	// banner, multi-line greetings are handled by the client
+	// servers that require a pause before the client speaks are given until the deadline to send it
+	conn.SetDeadline(time.Now().Add(d.timeout))
+	client, err := smtp.NewClient(conn, host)
 	if err != nil {
 		return certs, err
 	}
-	err = smtp.StartTLS(d.tlsConfig)
-	if err != nil {
-		return certs, err
+
+	// EHLO, sent by Extension if not sent by Hello
+	conn.SetDeadline(time.Now().Add(d.timeout))
+	if len(d.ehlo) > 0 {
+		err = client.Hello(d.ehlo)
+		if err != nil {
+			return certs, err
+		}
 	}
-	connState, ok := smtp.TLSConnectionState()
+	ok, _ := client.Extension("STARTTLS")
 	if !ok {
-		return certs, err
+		return certs, errNoStartTLS
+	}
+
+	// STARTTLS and TLS handshake
+	conn.SetDeadline(time.Now().Add(d.timeout))
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ServerName = host
+	err = client.StartTLS(tlsConfig)
+	if err != nil {
+		return certs, &handshakeError{err}
 	}
-	return connState.PeerCertificates, err
+	connState, ok := client.TLSConnectionState()
+	if !ok || len(connState.PeerCertificates) == 0 {
+		return certs, errors.New("smtp server did not present a certificate")
+	}
+	certs = connState.PeerCertificates
+
+	// we have the certificates, so don't wait long for the server to say goodbye
+	conn.SetDeadline(time.Now().Add(quitTimeout))
+	client.Quit()
+	return certs, nil
 }
 
 // QueryDomain gets the certificates found for a given domain
-func (d *smtpDriver) QueryDomain(host string) (driver.Result, error) {
+func (d *smtpDriver) QueryDomain(ctx context.Context, host string) (driver.Result, error) {
 	results := &smtpCertDriver{
 		host:         host,
 		status:       make(status.Map),
 		fingerprints: make(driver.FingerprintMap),
 		certs:        make(map[fingerprint.Fingerprint]*driver.CertResult),
+		sni:          make(map[string]driver.SNI),
 	}
 
 	// get related in different query
-	results.mx, _ = d.getMX(host)
+	results.mx, _ = d.getMX(ctx, host)
 
-	certs, err := d.smtpGetCerts(host)
+	certs, err := d.smtpGetCerts(ctx, host, d.tlsConfig)
+	if err != nil && ctx.Err() != nil {
+		return results, ctx.Err()
+	}
 	smtpStatus := status.CheckNetErr(err)
 	metaStatus := ""
 	if len(results.mx) > 0 {
@@ -132,6 +202,7 @@ func (d *smtpDriver) QueryDomain(host string) (driver.Result, error) {
 	certResult := driver.NewCertResult(certs[0])
 	results.certs[certResult.Fingerprint] = certResult
 	results.fingerprints.Add(host, certResult.Fingerprint)
+	results.sni[host] = driver.NewSNI(host, certs[0])
 
 	// save
 	if d.save && len(certs) > 0 {
@@ -141,10 +212,21 @@ func (d *smtpDriver) QueryDomain(host string) (driver.Result, error) {
 	return results, err
 }
 
+// AcceptsTLSBelow returns true if the host's SMTP server completes a STARTTLS handshake with a version below minVersion
+// only a handshake the server refused is false, connection failures during the handshake are errors
+func (d *smtpDriver) AcceptsTLSBelow(ctx context.Context, host string, minVersion uint16) (bool, error) {
+	_, err := d.smtpGetCerts(ctx, host, driver.BelowTLSConfig(d.tlsConfig, minVersion))
+	var handshakeErr *handshakeError
+	if errors.As(err, &handshakeErr) && driver.HandshakeRejected(handshakeErr.err) && ctx.Err() == nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // getMX returns the MX records for the provided domain
-func (d *smtpDriver) getMX(domain string) ([]string, error) {
+func (d *smtpDriver) getMX(ctx context.Context, domain string) ([]string, error) {
 	domains := make([]string, 0, 5)
-	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
 	defer cancel()
 	mx, err := net.DefaultResolver.LookupMX(ctx, domain)
 	if err != nil {
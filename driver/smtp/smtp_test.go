@@ -0,0 +1,250 @@
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/driver/internal/testutil"
+	"github.com/lanrat/certgraph/status"
+)
+
+// mockServer is an SMTP server that offers STARTTLS
+type mockServer struct {
+	// banner is sent when a client connects, nil sends nothing
+	banner []string
+	// bannerDelay is how long to wait before sending the banner
+	bannerDelay time.Duration
+	// noStartTLS doesn't offer STARTTLS
+	noStartTLS bool
+	tlsConfig  *tls.Config
+	// ehlo receives the hostname of each EHLO
+	ehlo chan string
+}
+
+// start starts the server on a local port, returning the port and a function to stop it
+func (s *mockServer) start(t *testing.T) (string, func()) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, done)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port, func() {
+		close(done)
+		listener.Close()
+	}
+}
+
+func (s *mockServer) serve(conn net.Conn, done chan struct{}) {
+	defer conn.Close()
+	select {
+	case <-time.After(s.bannerDelay):
+	case <-done:
+		return
+	}
+	if s.banner == nil {
+		<-done
+		return
+	}
+	for _, line := range s.banner {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.Fields(line)
+		if len(command) == 0 {
+			continue
+		}
+		switch strings.ToUpper(command[0]) {
+		case "EHLO":
+			if s.ehlo != nil && len(command) > 1 {
+				s.ehlo <- command[1]
+			}
+			if s.noStartTLS {
+				conn.Write([]byte("250-mock\r\n250 PIPELINING\r\n"))
+			} else {
+				conn.Write([]byte("250-mock\r\n250 STARTTLS\r\n"))
+			}
+		case "STARTTLS":
+			conn.Write([]byte("220 ready\r\n"))
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			r = bufio.NewReader(tlsConn)
+		case "QUIT":
+			conn.Write([]byte("221 bye\r\n"))
+			return
+		default:
+			conn.Write([]byte("502 unknown\r\n"))
+		}
+	}
+}
+
+// newTestDriver returns an smtp driver connecting to the port
+func newTestDriver(t *testing.T, timeout time.Duration, port string, options ...string) *smtpDriver {
+	t.Helper()
+	opts := driver.NewOptions()
+	opts.Set("smtp.port=" + port)
+	for _, option := range options {
+		opts.Set("smtp." + option)
+	}
+	d, err := Driver(timeout, "", opts.Sub(driverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.(*smtpDriver)
+}
+
+func TestQueryDomain(t *testing.T) {
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{testutil.Certificate(t, "mail.test")}}
+	tests := []struct {
+		name       string
+		server     *mockServer
+		wantStatus status.DomainStatus
+	}{
+		{"starttls", &mockServer{banner: []string{"220 mock ESMTP"}}, status.GOOD},
+		{"multiline banner", &mockServer{banner: []string{"220-mock ESMTP", "220-please wait", "220 ready"}}, status.GOOD},
+		{"slow banner", &mockServer{banner: []string{"220 mock ESMTP"}, bannerDelay: 200 * time.Millisecond}, status.GOOD},
+		{"stalled banner", &mockServer{}, status.TIMEOUT},
+		{"no starttls", &mockServer{banner: []string{"220 mock ESMTP"}, noStartTLS: true}, status.ERROR},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.server.tlsConfig = tlsConfig
+			port, stop := test.server.start(t)
+			defer stop()
+			d := newTestDriver(t, time.Second, port)
+
+			start := time.Now()
+			result, err := d.QueryDomain(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("query took %v with a timeout of 1s", elapsed)
+			}
+			if s := result.GetStatus()["127.0.0.1"]; s.Status != test.wantStatus {
+				t.Errorf("status %s, want %s", s.String(), test.wantStatus)
+			}
+			fingerprints, _ := result.GetFingerprints()
+			if test.wantStatus != status.GOOD {
+				if len(fingerprints) != 0 {
+					t.Errorf("found the certificates %v of a failed connection", fingerprints)
+				}
+				return
+			}
+			if len(fingerprints["127.0.0.1"]) != 1 {
+				t.Fatalf("found %v, want the server's certificate", fingerprints)
+			}
+			cert, err := result.QueryCert(fingerprints["127.0.0.1"][0])
+			if err != nil || len(cert.Domains) != 1 || cert.Domains[0] != "mail.test" {
+				t.Errorf("QueryCert returned %v, %v", cert, err)
+			}
+			sni := result.(driver.SNIResult).GetSNI()["127.0.0.1"]
+			if sni.Presented != "mail.test" || !sni.Mismatch {
+				t.Errorf("GetSNI returned %+v, want the mismatched mail.test certificate", sni)
+			}
+		})
+	}
+}
+
+func TestQueryDomainCancelled(t *testing.T) {
+	port, stop := (&mockServer{}).start(t)
+	defer stop()
+	d := newTestDriver(t, 10*time.Second, port)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := d.QueryDomain(ctx, "127.0.0.1"); err != context.DeadlineExceeded {
+		t.Errorf("QueryDomain of a stalled server returned %v once cancelled, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("cancelled query took %v", elapsed)
+	}
+}
+
+func TestEHLO(t *testing.T) {
+	tests := []struct {
+		options []string
+		want    string
+	}{
+		{nil, "localhost"},
+		{[]string{"ehlo=scanner.example.com"}, "scanner.example.com"},
+	}
+	for _, test := range tests {
+		server := &mockServer{
+			banner:    []string{"220 mock ESMTP"},
+			tlsConfig: &tls.Config{Certificates: []tls.Certificate{testutil.Certificate(t, "mail.test")}},
+			ehlo:      make(chan string, 2),
+		}
+		port, stop := server.start(t)
+		d := newTestDriver(t, time.Second, port, test.options...)
+		_, err := d.QueryDomain(context.Background(), "127.0.0.1")
+		stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ehlo := <-server.ehlo; ehlo != test.want {
+			t.Errorf("sent EHLO %s, want %s", ehlo, test.want)
+		}
+	}
+}
+
+func TestAcceptsTLSBelow(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverMin  uint16
+		minVersion uint16
+		want       bool
+	}{
+		{"accepts old tls", tls.VersionTLS10, tls.VersionTLS13, true},
+		{"rejects old tls", tls.VersionTLS12, tls.VersionTLS12, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &mockServer{
+				banner:    []string{"220 mock ESMTP"},
+				tlsConfig: &tls.Config{Certificates: []tls.Certificate{testutil.Certificate(t, "mail.test")}, MinVersion: test.serverMin},
+			}
+			port, stop := server.start(t)
+			defer stop()
+			accepts, err := newTestDriver(t, time.Second, port).AcceptsTLSBelow(context.Background(), "127.0.0.1", test.minVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accepts != test.want {
+				t.Errorf("AcceptsTLSBelow = %v, want %v", accepts, test.want)
+			}
+		})
+	}
+}
+
+func TestDriverOptions(t *testing.T) {
+	opts := driver.NewOptions()
+	opts.Set("smtp.port=smtp")
+	if _, err := Driver(time.Second, "", opts.Sub(driverName)); err == nil {
+		t.Error("Driver with an invalid port did not fail")
+	}
+}
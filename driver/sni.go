@@ -0,0 +1,42 @@
+package driver
+
+import (
+	"crypto/x509"
+	"strings"
+)
+
+// SNI is the server name sent in a TLS handshake and the primary name of the certificate the server presented
+type SNI struct {
+	Requested string
+	Presented string
+	// Mismatch is true if the certificate presented is not valid for the requested name,
+	// usually because the server fell back to its default certificate
+	Mismatch bool
+}
+
+// SNIResult is implemented by the results of drivers that perform TLS handshakes
+type SNIResult interface {
+	// GetSNI returns the SNI of the handshake with each host connected to, keyed by host
+	GetSNI() map[string]SNI
+}
+
+// NewSNI returns the SNI of a handshake that requested the server name and was presented cert
+func NewSNI(requested string, cert *x509.Certificate) SNI {
+	presented := PrimaryName(cert)
+	return SNI{
+		Requested: requested,
+		Presented: presented,
+		Mismatch:  cert.VerifyHostname(requested) != nil && !strings.EqualFold(presented, requested),
+	}
+}
+
+// PrimaryName returns the subject common name of the certificate, or its first DNS name if it has no common name
+func PrimaryName(cert *x509.Certificate) string {
+	if len(cert.Subject.CommonName) > 0 {
+		return strings.ToLower(cert.Subject.CommonName)
+	}
+	if len(cert.DNSNames) > 0 {
+		return strings.ToLower(cert.DNSNames[0])
+	}
+	return ""
+}
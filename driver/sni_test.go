@@ -0,0 +1,31 @@
+package driver
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestNewSNI(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		cert      *x509.Certificate
+		presented string
+		mismatch  bool
+	}{
+		{"match", "www.example.com", &x509.Certificate{Subject: pkix.Name{CommonName: "WWW.Example.com"}, DNSNames: []string{"www.example.com"}}, "www.example.com", false},
+		{"wildcard", "www.example.com", &x509.Certificate{DNSNames: []string{"*.Example.com", "example.com"}}, "*.example.com", false},
+		{"default certificate", "www.example.com", &x509.Certificate{Subject: pkix.Name{CommonName: "default.example.net"}, DNSNames: []string{"default.example.net"}}, "default.example.net", true},
+		// only the common name names the host
+		{"common name", "legacy.example.com", &x509.Certificate{Subject: pkix.Name{CommonName: "Legacy.example.com"}}, "legacy.example.com", false},
+		{"no names", "www.example.com", &x509.Certificate{}, "", true},
+	}
+	for _, test := range tests {
+		sni := NewSNI(test.requested, newTestCertificate(t, test.cert))
+		want := SNI{Requested: test.requested, Presented: test.presented, Mismatch: test.mismatch}
+		if sni != want {
+			t.Errorf("%s: NewSNI = %+v, want %+v", test.name, sni, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package driver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// TLSProber is implemented by drivers that can check whether a domain accepts connections below a TLS version
+type TLSProber interface {
+	// AcceptsTLSBelow returns true if the domain completed a TLS handshake with a version below minVersion
+	// a handshake the domain refused is not an error, failing to connect to the domain is
+	// cancelling ctx aborts the check
+	AcceptsTLSBelow(ctx context.Context, domain string, minVersion uint16) (bool, error)
+}
+
+// unwrapper is implemented by drivers that wrap another driver
+type unwrapper interface {
+	Unwrap() Driver
+}
+
+// AsTLSProber returns the TLSProber for the driver, looking through any drivers wrapping it
+func AsTLSProber(d Driver) (TLSProber, bool) {
+	for d != nil {
+		if prober, ok := d.(TLSProber); ok {
+			return prober, true
+		}
+		u, ok := d.(unwrapper)
+		if !ok {
+			break
+		}
+		d = u.Unwrap()
+	}
+	return nil, false
+}
+
+// tlsVersions are the TLS versions that can be set as a policy minimum
+// TLS 1.0 is not included as there is no lower version left to probe for
+var tlsVersions = map[string]uint16{
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion returns the TLS version for a policy minimum such as 1.2
+func ParseTLSVersion(version string) (uint16, error) {
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS policy version %q, must be one of 1.1, 1.2, or 1.3", version)
+	}
+	return v, nil
+}
+
+// BelowTLSConfig returns a copy of config that only allows TLS versions below minVersion
+func BelowTLSConfig(config *tls.Config, minVersion uint16) *tls.Config {
+	config = config.Clone()
+	config.MinVersion = tls.VersionTLS10
+	config.MaxVersion = minVersion - 1
+	return config
+}
+
+// HandshakeRejected returns true if err is from a TLS handshake that was refused, either by an alert from the peer
+// or because the peer selected a version or parameters that were not offered
+// errors from the connection failing during the handshake, such as timeouts, resets, and EOFs, were not a refusal
+func HandshakeRejected(err error) bool {
+	if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "remote error"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return false
+	}
+	return strings.HasPrefix(err.Error(), "tls: ")
+}
@@ -0,0 +1,100 @@
+package driver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+// proberDriver is a driver that can probe TLS versions
+type proberDriver struct {
+	Driver
+}
+
+func (d proberDriver) AcceptsTLSBelow(ctx context.Context, domain string, minVersion uint16) (bool, error) {
+	return true, nil
+}
+
+// wrappingDriver wraps another driver
+type wrappingDriver struct {
+	Driver
+}
+
+func (d wrappingDriver) Unwrap() Driver {
+	return d.Driver
+}
+
+// plainDriver is a driver that does nothing
+type plainDriver struct{}
+
+func (plainDriver) QueryDomain(ctx context.Context, domain string) (Result, error) {
+	return nil, nil
+}
+
+func (plainDriver) GetName() string {
+	return "plain"
+}
+
+func TestAsTLSProber(t *testing.T) {
+	tests := []struct {
+		name string
+		d    Driver
+		want bool
+	}{
+		{"prober", proberDriver{plainDriver{}}, true},
+		{"wrapped prober", wrappingDriver{wrappingDriver{proberDriver{plainDriver{}}}}, true},
+		{"plain", plainDriver{}, false},
+		{"wrapped plain", wrappingDriver{plainDriver{}}, false},
+		{"nil", nil, false},
+	}
+	for _, test := range tests {
+		if _, ok := AsTLSProber(test.d); ok != test.want {
+			t.Errorf("AsTLSProber(%s) = %v, want %v", test.name, ok, test.want)
+		}
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	for version, want := range map[string]uint16{"1.1": tls.VersionTLS11, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13} {
+		got, err := ParseTLSVersion(version)
+		if err != nil || got != want {
+			t.Errorf("ParseTLSVersion(%s) = %x, %v, want %x", version, got, err, want)
+		}
+	}
+	for _, version := range []string{"1.0", "1.4", "tls1.2", ""} {
+		if _, err := ParseTLSVersion(version); err == nil {
+			t.Errorf("ParseTLSVersion(%q) did not fail", version)
+		}
+	}
+
+	config := BelowTLSConfig(&tls.Config{ServerName: "example.com", MinVersion: tls.VersionTLS12}, tls.VersionTLS12)
+	if config.MinVersion != tls.VersionTLS10 || config.MaxVersion != tls.VersionTLS11 || config.ServerName != "example.com" {
+		t.Errorf("BelowTLSConfig(1.2) allows %x to %x for %s, want TLS 1.0 to 1.1 for example.com", config.MinVersion, config.MaxVersion, config.ServerName)
+	}
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"alert", &net.OpError{Op: "remote error", Err: errors.New("tls: protocol version not supported")}, true},
+		{"wrapped alert", fmt.Errorf("starttls: %w", &net.OpError{Op: "remote error", Err: errors.New("tls: handshake failure")}), true},
+		{"unsupported version", errors.New("tls: server selected unsupported protocol version 303"), true},
+		{"timeout", &net.OpError{Op: "read", Err: timeoutError("i/o timeout")}, false},
+		{"reset", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, false},
+		{"eof", io.EOF, false},
+		{"wrapped eof", fmt.Errorf("handshake: %w", io.ErrUnexpectedEOF), false},
+		{"nil", nil, false},
+	}
+	for _, test := range tests {
+		if got := HandshakeRejected(test.err); got != test.want {
+			t.Errorf("HandshakeRejected(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
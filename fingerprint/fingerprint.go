@@ -4,6 +4,7 @@ package fingerprint
 import (
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 )
 
@@ -40,3 +41,16 @@ func FromB64(hash string) Fingerprint {
 func (fp *Fingerprint) B64Encode() string {
 	return base64.StdEncoding.EncodeToString(fp[:])
 }
+
+// FromHex returns a Fingerprint from a hex encoded hash string
+func FromHex(hash string) (Fingerprint, error) {
+	var fp Fingerprint
+	data, err := hex.DecodeString(hash)
+	if err != nil {
+		return fp, err
+	}
+	if len(data) != len(fp) {
+		return fp, fmt.Errorf("invalid fingerprint length %d", len(data))
+	}
+	return FromHashBytes(data), nil
+}
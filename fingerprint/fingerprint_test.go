@@ -0,0 +1,55 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestFromHex(t *testing.T) {
+	data := []byte("certificate")
+	want := FromBytes(data)
+	tests := []struct {
+		hash    string
+		want    Fingerprint
+		wantErr bool
+	}{
+		{want.HexString(), want, false},
+		{strings.ToLower(want.HexString()), want, false},
+		{"", Fingerprint{}, true},
+		{"abcd", Fingerprint{}, true},
+		{strings.Repeat("a", 66), Fingerprint{}, true},
+		{strings.Repeat("x", 64), Fingerprint{}, true},
+	}
+	for _, test := range tests {
+		fp, err := FromHex(test.hash)
+		if (err != nil) != test.wantErr {
+			t.Errorf("FromHex(%q) returned the error %v, want error %v", test.hash, err, test.wantErr)
+		}
+		if err == nil && fp != test.want {
+			t.Errorf("FromHex(%q) = %s, want %s", test.hash, fp.HexString(), test.want.HexString())
+		}
+	}
+}
+
+func TestFingerprintEncodings(t *testing.T) {
+	fp := FromBytes([]byte("certificate"))
+	if fp != sha256.Sum256([]byte("certificate")) {
+		t.Error("FromBytes is not the sha256 of the data")
+	}
+	if got := FromB64(fp.B64Encode()); got != fp {
+		t.Errorf("FromB64(B64Encode()) = %s, want %s", got.HexString(), fp.HexString())
+	}
+	if hex := fp.HexString(); len(hex) != 64 || strings.ToUpper(hex) != hex {
+		t.Errorf("HexString() = %s, want 64 upper case hex digits", hex)
+	}
+	// short hashes are padded with zeros, long ones truncated
+	if got := FromHashBytes([]byte{1, 2}); got[0] != 1 || got[1] != 2 || got[2] != 0 {
+		t.Errorf("FromHashBytes of 2 bytes = %s", got.HexString())
+	}
+	long := make([]byte, 40)
+	long[31], long[32] = 7, 8
+	if got := FromHashBytes(long); got[31] != 7 {
+		t.Errorf("FromHashBytes of 40 bytes = %s", got.HexString())
+	}
+}
@@ -3,6 +3,8 @@ module github.com/lanrat/certgraph
 require (
 	github.com/lib/pq v1.8.0
 	github.com/weppos/publicsuffix-go v0.13.0
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/net v0.0.0-20200707034311-ab3426394381 // indirect
 )
 
@@ -0,0 +1,97 @@
+package graph
+
+import (
+	"fmt"
+	"time"
+)
+
+// day is the unit the certificate age buckets are measured in
+const day = 24 * time.Hour
+
+// ageBounds are the lower bounds of the certificate age buckets, the last bucket has no upper bound
+var ageBounds = []time.Duration{0, 7 * day, 30 * day, 90 * day, 180 * day, 365 * day, 730 * day}
+
+// AgeBucket is the number of certificates with an age or remaining lifetime of at least Min and less than Max
+// the last bucket has no Max, and the expired bucket of remaining lifetimes has a negative Max
+type AgeBucket struct {
+	Label string
+	Min   time.Duration
+	Max   time.Duration
+	Count int
+}
+
+// CertAges is the distribution of the ages, time since NotBefore, and remaining lifetimes, time until NotAfter,
+// of the certificates in the graph, each sorted chronologically
+type CertAges struct {
+	Age       []AgeBucket
+	Remaining []AgeBucket
+	// number of certificates without known validity dates
+	Unknown int
+}
+
+// newAgeBuckets returns the empty buckets for ageBounds
+func newAgeBuckets() []AgeBucket {
+	buckets := make([]AgeBucket, 0, len(ageBounds))
+	for i, min := range ageBounds {
+		bucket := AgeBucket{Min: min}
+		if i+1 < len(ageBounds) {
+			bucket.Max = ageBounds[i+1]
+			bucket.Label = fmt.Sprintf("%d-%dd", min/day, bucket.Max/day)
+		} else {
+			bucket.Label = fmt.Sprintf("%dd+", min/day)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+// addAge counts the duration in the last bucket it is at least the Min of
+func addAge(buckets []AgeBucket, d time.Duration) {
+	for i := len(buckets) - 1; i >= 0; i-- {
+		if d >= buckets[i].Min {
+			buckets[i].Count++
+			return
+		}
+	}
+}
+
+// CertAges returns the distribution of the ages and remaining lifetimes of the certificates in the graph at t
+// certificates not yet valid at t are counted in the first age bucket
+func (graph *CertGraph) CertAges(t time.Time) CertAges {
+	ages := CertAges{
+		Age:       newAgeBuckets(),
+		Remaining: append([]AgeBucket{{Label: "expired", Min: -1 << 63, Max: 0}}, newAgeBuckets()...),
+	}
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
+		if certNode.NotBefore.IsZero() || certNode.NotAfter.IsZero() {
+			ages.Unknown++
+			return true
+		}
+		age := t.Sub(certNode.NotBefore)
+		if age < 0 {
+			age = 0
+		}
+		addAge(ages.Age, age)
+		addAge(ages.Remaining, certNode.NotAfter.Sub(t))
+		return true
+	})
+	return ages
+}
+
+// ToMap returns a map of the certificate age distribution for JSON serialization
+func (ages CertAges) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"age":       bucketsToMaps(ages.Age),
+		"remaining": bucketsToMaps(ages.Remaining),
+		"unknown":   ages.Unknown,
+	}
+}
+
+// bucketsToMaps returns the label and count of each bucket for JSON serialization
+func bucketsToMaps(buckets []AgeBucket) []map[string]interface{} {
+	maps := make([]map[string]interface{}, 0, len(buckets))
+	for _, bucket := range buckets {
+		maps = append(maps, map[string]interface{}{"bucket": bucket.Label, "certs": bucket.Count})
+	}
+	return maps
+}
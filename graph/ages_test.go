@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCertAges(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	graph := NewCertGraph()
+	// age, remaining lifetime
+	certs := []struct {
+		age       time.Duration
+		remaining time.Duration
+	}{
+		{day, 89 * day},
+		{6 * day, 84 * day},
+		{100 * day, 265 * day},
+		{800 * day, -5 * day},
+		// not valid yet
+		{-day, 91 * day},
+	}
+	for i, c := range certs {
+		certNode := testCert(byte(i+1), "a.test")
+		certNode.NotBefore = now.Add(-c.age)
+		certNode.NotAfter = now.Add(c.remaining)
+		graph.AddCert(certNode)
+	}
+	unknown := testCert(9, "a.test")
+	unknown.NotAfter = time.Time{}
+	graph.AddCert(unknown)
+
+	ages := graph.CertAges(now)
+	if ages.Unknown != 1 {
+		t.Errorf("%d certificates have unknown ages, want 1", ages.Unknown)
+	}
+	counts := func(buckets []AgeBucket) map[string]int {
+		m := make(map[string]int)
+		for _, bucket := range buckets {
+			m[bucket.Label] = bucket.Count
+		}
+		return m
+	}
+	wantAge := map[string]int{"0-7d": 3, "7-30d": 0, "30-90d": 0, "90-180d": 1, "180-365d": 0, "365-730d": 0, "730d+": 1}
+	wantRemaining := map[string]int{"expired": 1, "0-7d": 0, "7-30d": 0, "30-90d": 2, "90-180d": 1, "180-365d": 1, "365-730d": 0, "730d+": 0}
+	for label, want := range wantAge {
+		if got := counts(ages.Age)[label]; got != want {
+			t.Errorf("age bucket %s has %d certificates, want %d", label, got, want)
+		}
+	}
+	for label, want := range wantRemaining {
+		if got := counts(ages.Remaining)[label]; got != want {
+			t.Errorf("remaining bucket %s has %d certificates, want %d", label, got, want)
+		}
+	}
+	if len(ages.Age) != len(wantAge) || len(ages.Remaining) != len(wantRemaining) || ages.Remaining[0].Label != "expired" {
+		t.Errorf("CertAges returned the buckets %v and %v", ages.Age, ages.Remaining)
+	}
+}
@@ -0,0 +1,246 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync"
+
+	"github.com/lanrat/certgraph/fingerprint"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltDomainBucket = []byte("domains")
+	boltCertBucket   = []byte("certs")
+)
+
+// number of nodes read per transaction when iterating over the store
+const boltRangeBatch = 1000
+
+// BoltStore is a Store that holds the graph in a BoltDB file on disk
+// for graphs that are too large to hold in memory
+type BoltStore struct {
+	db      *bolt.DB
+	errLock sync.Mutex
+	err     error
+}
+
+// NewBoltStore returns a new Store that holds the graph in the BoltDB file at path
+// the file is created if it does not exist, and any graph already in it is removed
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the store is scratch space for a single crawl, so durability is not needed
+	db.NoSync = true
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltDomainBucket, boltCertBucket} {
+			if tx.Bucket(bucket) != nil {
+				err := tx.DeleteBucket(bucket)
+				if err != nil {
+					return err
+				}
+			}
+			_, err := tx.CreateBucket(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := new(BoltStore)
+	s.db = db
+	return s, nil
+}
+
+// Close closes the underlying BoltDB file
+// returns the first error encountered by the store, if any
+func (s *BoltStore) Close() error {
+	err := s.db.Close()
+	s.errLock.Lock()
+	defer s.errLock.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
+
+// setErr saves the first error encountered to be returned by Close
+func (s *BoltStore) setErr(err error) {
+	if err == nil {
+		return
+	}
+	s.errLock.Lock()
+	defer s.errLock.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// put gob encodes value and saves it under key in bucket
+func (s *BoltStore) put(bucket, key []byte, value interface{}) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(value)
+	if err != nil {
+		s.setErr(err)
+		return
+	}
+	s.setErr(s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, buf.Bytes())
+	}))
+}
+
+// get decodes the value saved under key in bucket into value
+func (s *BoltStore) get(bucket, key []byte, value interface{}) bool {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data = tx.Bucket(bucket).Get(key)
+		if data != nil {
+			// data is only valid for the life of the transaction
+			data = append([]byte(nil), data...)
+		}
+		return nil
+	})
+	if err != nil {
+		s.setErr(err)
+		return false
+	}
+	if data == nil {
+		return false
+	}
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+	if err != nil {
+		s.setErr(err)
+		return false
+	}
+	return true
+}
+
+// rangeBucket calls f with every value in bucket
+// values are read in batches so that f is not called while a transaction is open
+func (s *BoltStore) rangeBucket(bucket []byte, f func(data []byte) bool) {
+	var lastKey []byte
+	for {
+		batch := make([][]byte, 0, boltRangeBatch)
+		err := s.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(bucket).Cursor()
+			var k, v []byte
+			if lastKey == nil {
+				k, v = c.First()
+			} else {
+				k, v = c.Seek(lastKey)
+				if k != nil && bytes.Equal(k, lastKey) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil && len(batch) < boltRangeBatch; k, v = c.Next() {
+				batch = append(batch, append([]byte(nil), v...))
+				lastKey = append([]byte(nil), k...)
+			}
+			return nil
+		})
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+		for _, data := range batch {
+			if !f(data) {
+				return
+			}
+		}
+		if len(batch) < boltRangeBatch {
+			return
+		}
+	}
+}
+
+// AddDomain saves the DomainNode to disk
+func (s *BoltStore) AddDomain(domainNode *DomainNode) {
+	s.put(boltDomainBucket, []byte(domainNode.Domain), domainNode)
+}
+
+// GetDomain returns a copy of the DomainNode read from disk
+func (s *BoltStore) GetDomain(domain string) (*DomainNode, bool) {
+	domainNode := new(DomainNode)
+	if !s.get(boltDomainBucket, []byte(domain), domainNode) {
+		return nil, false
+	}
+	return domainNode, true
+}
+
+// AddCert saves the CertNode to disk
+func (s *BoltStore) AddCert(certNode *CertNode) {
+	s.put(boltCertBucket, certNode.Fingerprint[:], certNode)
+}
+
+// GetCert returns a copy of the CertNode read from disk
+func (s *BoltStore) GetCert(fp fingerprint.Fingerprint) (*CertNode, bool) {
+	certNode := new(CertNode)
+	if !s.get(boltCertBucket, fp[:], certNode) {
+		return nil, false
+	}
+	return certNode, true
+}
+
+// UpdateCert reads, updates, and saves the CertNode in a single transaction
+func (s *BoltStore) UpdateCert(fp fingerprint.Fingerprint, f func(certNode *CertNode)) bool {
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltCertBucket)
+		data := bucket.Get(fp[:])
+		if data == nil {
+			return nil
+		}
+		certNode := new(CertNode)
+		err := gob.NewDecoder(bytes.NewReader(data)).Decode(certNode)
+		if err != nil {
+			return err
+		}
+		f(certNode)
+		var buf bytes.Buffer
+		err = gob.NewEncoder(&buf).Encode(certNode)
+		if err != nil {
+			return err
+		}
+		found = true
+		return bucket.Put(fp[:], buf.Bytes())
+	})
+	if err != nil {
+		s.setErr(err)
+		return false
+	}
+	return found
+}
+
+// RangeDomains calls f with a copy of every DomainNode on disk
+func (s *BoltStore) RangeDomains(f func(domainNode *DomainNode) bool) {
+	s.rangeBucket(boltDomainBucket, func(data []byte) bool {
+		domainNode := new(DomainNode)
+		err := gob.NewDecoder(bytes.NewReader(data)).Decode(domainNode)
+		if err != nil {
+			s.setErr(err)
+			return false
+		}
+		return f(domainNode)
+	})
+}
+
+// RangeCerts calls f with a copy of every CertNode on disk
+func (s *BoltStore) RangeCerts(f func(certNode *CertNode) bool) {
+	s.rangeBucket(boltCertBucket, func(data []byte) bool {
+		certNode := new(CertNode)
+		err := gob.NewDecoder(bytes.NewReader(data)).Decode(certNode)
+		if err != nil {
+			s.setErr(err)
+			return false
+		}
+		return f(certNode)
+	})
+}
@@ -1,30 +1,83 @@
 package graph
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
+	"math/big"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/lanrat/certgraph/dns"
 	"github.com/lanrat/certgraph/fingerprint"
+	"github.com/lanrat/certgraph/revocation"
 )
 
 // CertNode graph node to store certificate information
 type CertNode struct {
-	Fingerprint fingerprint.Fingerprint
-	Domains     []string
-	foundMap    map[string]bool
+	Fingerprint           fingerprint.Fingerprint
+	Domains               []string
+	MalformedDomains      []string
+	SerialNumber          *big.Int
+	NotBefore             time.Time
+	NotAfter              time.Time
+	OCSPServer            []string
+	IssuingCertificateURL []string
+	CRLDistributionPoints []string
+	PolicyOIDs            []string
+	Issuer                string
+	KeyFingerprint        fingerprint.Fingerprint
+	Organization          []string
+	OrganizationalUnit    []string
+	Renewals              []Renewal
+	CRLStatus             revocation.Status
+	foundMap              map[string]bool
+}
+
+// certNodeFields has the same fields as CertNode without its methods so it can be gob encoded by CertNode.GobEncode
+type certNodeFields CertNode
+
+// certNodeGob is the gob serialization of a CertNode, including its unexported fields
+type certNodeGob struct {
+	Node  *certNodeFields
+	Found []string
+}
+
+// GobEncode implements the gob.GobEncoder interface
+func (c *CertNode) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(certNodeGob{
+		Node:  (*certNodeFields)(c),
+		Found: c.Found(),
+	})
+	return buf.Bytes(), err
+}
+
+// GobDecode implements the gob.GobDecoder interface
+func (c *CertNode) GobDecode(data []byte) error {
+	node := certNodeGob{Node: (*certNodeFields)(c)}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&node)
+	if err != nil {
+		return err
+	}
+	for _, found := range node.Found {
+		c.AddFound(found)
+	}
+	return nil
 }
 
 func (c *CertNode) String() string {
-	return fmt.Sprintf("%s\t%s\t%v", c.Fingerprint.HexString(), c.Found(), c.Domains)
+	return fmt.Sprintf("%s\t%s\t%s\t%v", c.Fingerprint.HexString(), c.Found(), c.ValidationLevel(), c.Domains)
 }
 
-// Found returns a list of drivers that found this cert
+// Found returns a sorted list of drivers that found this cert
 func (c *CertNode) Found() []string {
 	found := make([]string, 0, len(c.foundMap))
 	for i := range c.foundMap {
 		found = append(found, i)
 	}
+	sort.Strings(found)
 	return found
 }
 
@@ -59,6 +112,27 @@ func (c *CertNode) CDNCert() bool {
 
 // ApexCount the number of tld+1 domains in the certificate
 func (c *CertNode) ApexCount() int {
+	return len(c.apexDomains())
+}
+
+// ApexFraction returns the fraction of the tld+1 domains in the certificate that are in apexes
+// certificates without any valid tld+1 domains return 0
+func (c *CertNode) ApexFraction(apexes map[string]bool) float64 {
+	apexDomains := c.apexDomains()
+	if len(apexDomains) == 0 {
+		return 0
+	}
+	found := 0
+	for apexDomain := range apexDomains {
+		if apexes[apexDomain] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(apexDomains))
+}
+
+// apexDomains returns the set of tld+1 domains in the certificate
+func (c *CertNode) apexDomains() map[string]bool {
 	apexDomains := make(map[string]bool)
 	for _, domain := range c.Domains {
 		apexDomain, err := dns.ApexDomain(domain)
@@ -67,7 +141,12 @@ func (c *CertNode) ApexCount() int {
 		}
 		apexDomains[apexDomain] = true
 	}
-	return len(apexDomains)
+	return apexDomains
+}
+
+// Revocation returns the combined verdict of all revocation checks performed on the certificate
+func (c *CertNode) Revocation() revocation.Status {
+	return c.CRLStatus
 }
 
 // ToMap returns a map of the CertNode's fields (weak serialization)
@@ -76,5 +155,40 @@ func (c *CertNode) ToMap() map[string]string {
 	m["type"] = "certificate"
 	m["id"] = c.Fingerprint.HexString()
 	m["found"] = strings.Join(c.Found(), " ")
+	if len(c.MalformedDomains) > 0 {
+		m["malformed"] = strings.Join(c.MalformedDomains, " ")
+	}
+	m["ocsp"] = strings.Join(c.OCSPServer, " ")
+	m["caIssuers"] = strings.Join(c.IssuingCertificateURL, " ")
+	m["crl"] = strings.Join(c.CRLDistributionPoints, " ")
+	if c.SerialNumber != nil {
+		m["serial"] = fmt.Sprintf("%X", c.SerialNumber)
+	}
+	m["policies"] = strings.Join(c.PolicyOIDs, " ")
+	if !c.NotBefore.IsZero() {
+		m["notBefore"] = c.NotBefore.UTC().Format(time.RFC3339)
+	}
+	if !c.NotAfter.IsZero() {
+		m["notAfter"] = c.NotAfter.UTC().Format(time.RFC3339)
+	}
+	if len(c.Issuer) > 0 {
+		m["issuer"] = c.Issuer
+	}
+	m["validation"] = c.ValidationLevel()
+	if len(c.Organization) > 0 {
+		m["organization"] = strings.Join(c.Organization, ", ")
+	}
+	if len(c.OrganizationalUnit) > 0 {
+		m["organizationalUnit"] = strings.Join(c.OrganizationalUnit, ", ")
+	}
+	if len(c.Renewals) > 0 {
+		renewals := make([]string, 0, len(c.Renewals))
+		for _, renewal := range c.Renewals {
+			renewals = append(renewals, renewal.String())
+		}
+		m["renewals"] = strings.Join(renewals, " ")
+	}
+	m["crlStatus"] = c.CRLStatus.String()
+	m["revocation"] = c.Revocation().String()
 	return m
 }
@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"testing"
+)
+
+func TestCertNodeToMap(t *testing.T) {
+	certNode := testCert(1, "a.test")
+	certNode.OCSPServer = []string{"http://ocsp.test"}
+	certNode.IssuingCertificateURL = []string{"http://ca.test/ca.crt", "http://ca2.test/ca.crt"}
+	certNode.CRLDistributionPoints = []string{"http://crl.test/ca.crl"}
+	fp := testFingerprint(1)
+	tests := []struct {
+		certNode *CertNode
+		key      string
+		want     string
+	}{
+		{certNode, "id", fp.HexString()},
+		{certNode, "found", "test"},
+		{certNode, "ocsp", "http://ocsp.test"},
+		{certNode, "caIssuers", "http://ca.test/ca.crt http://ca2.test/ca.crt"},
+		{certNode, "crl", "http://crl.test/ca.crl"},
+		{certNode, "notBefore", "2020-01-01T00:00:00Z"},
+		{certNode, "issuer", "CN=Test CA"},
+		// certificates without the extensions have them empty
+		{testCert(2, "a.test"), "ocsp", ""},
+		{testCert(2, "a.test"), "caIssuers", ""},
+		{testCert(2, "a.test"), "crl", ""},
+	}
+	for _, test := range tests {
+		m := test.certNode.ToMap()
+		if got, ok := m[test.key]; !ok || got != test.want {
+			t.Errorf("ToMap()[%s] = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
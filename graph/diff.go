@@ -0,0 +1,101 @@
+package graph
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Snapshot is a minimal view of a previously generated graph used to find what has changed since
+type Snapshot struct {
+	// Domains maps the domains in the graph to their status
+	Domains map[string]string
+	// Certs is the set of certificate fingerprints in the graph as hex strings
+	Certs map[string]bool
+}
+
+// StatusChange records a domain whose status is different from a previous graph
+type StatusChange struct {
+	Domain string `json:"domain"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// LoadSnapshot reads a Snapshot from the JSON output of GenerateMap
+func LoadSnapshot(r io.Reader) (*Snapshot, error) {
+	var prior struct {
+		Nodes []map[string]string `json:"nodes"`
+	}
+	err := json.NewDecoder(r).Decode(&prior)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		Domains: make(map[string]string),
+		Certs:   make(map[string]bool),
+	}
+	for _, node := range prior.Nodes {
+		switch node["type"] {
+		case "domain":
+			// unreached domains were only referenced, they were not in the prior graph
+			if node["unreached"] == "true" {
+				continue
+			}
+			snapshot.Domains[node["id"]] = node["status"]
+		case "certificate":
+			snapshot.Certs[node["id"]] = true
+		}
+	}
+	return snapshot, nil
+}
+
+// Snapshot returns a Snapshot of the graph
+func (graph *CertGraph) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Domains: make(map[string]string),
+		Certs:   make(map[string]bool),
+	}
+	graph.store.RangeDomains(func(domainNode *DomainNode) bool {
+		snapshot.Domains[domainNode.Domain] = domainNode.Status.String()
+		return true
+	})
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
+		snapshot.Certs[certNode.Fingerprint.HexString()] = true
+		return true
+	})
+	return snapshot
+}
+
+// Delta returns a new CertGraph containing only the domains and certificates that are not in the prior Snapshot
+// domains by name and certificates by fingerprint, along with any domains in both whose status has changed
+func (graph *CertGraph) Delta(prior *Snapshot) (*CertGraph, []StatusChange) {
+	delta := NewCertGraph()
+	changes := make([]StatusChange, 0)
+
+	graph.store.RangeDomains(func(domainNode *DomainNode) bool {
+		priorStatus, found := prior.Domains[domainNode.Domain]
+		if !found {
+			delta.AddDomain(domainNode)
+		} else if priorStatus != domainNode.Status.String() {
+			changes = append(changes, StatusChange{
+				Domain: domainNode.Domain,
+				Before: priorStatus,
+				After:  domainNode.Status.String(),
+			})
+		}
+		return true
+	})
+
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
+		if !prior.Certs[certNode.Fingerprint.HexString()] {
+			delta.AddCert(certNode)
+		}
+		return true
+	})
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Domain < changes[j].Domain
+	})
+	return delta, changes
+}
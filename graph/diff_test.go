@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lanrat/certgraph/status"
+)
+
+func TestDelta(t *testing.T) {
+	prior := NewCertGraph()
+	buildTestGraph(prior)
+	data, err := json.Marshal(prior.GenerateMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := LoadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unreached c.test was not in the prior graph
+	if !reflect.DeepEqual(snapshot, prior.Snapshot()) {
+		t.Errorf("LoadSnapshot = %v, want the graph's Snapshot %v", snapshot, prior.Snapshot())
+	}
+
+	graph := NewCertGraph()
+	buildTestGraph(graph)
+	cert3 := testCert(3, "b.test", "c.test")
+	graph.AddCert(cert3)
+	c := testDomain("c.test", 2, cert3)
+	graph.AddDomain(c)
+	b, _ := graph.GetDomain("b.test")
+	b.Status = status.New(status.TIMEOUT)
+	graph.UpdateDomain(b)
+
+	delta, changes := graph.Delta(snapshot)
+	if delta.NumDomains() != 1 || delta.NumCerts() != 1 {
+		t.Errorf("delta has %d domains and %d certs, want only c.test and cert 3", delta.NumDomains(), delta.NumCerts())
+	}
+	if _, ok := delta.GetDomain("c.test"); !ok {
+		t.Error("the new c.test is not in the delta")
+	}
+	if _, ok := delta.GetCert(cert3.Fingerprint); !ok {
+		t.Error("the new cert 3 is not in the delta")
+	}
+	want := []StatusChange{{Domain: "b.test", Before: "Good", After: "Timeout"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Delta changes = %v, want %v", changes, want)
+	}
+
+	if _, err := LoadSnapshot(strings.NewReader("not json")); err == nil {
+		t.Error("LoadSnapshot of invalid json did not fail")
+	}
+}
@@ -19,9 +19,29 @@ type DomainNode struct {
 	RelatedDomains status.Map
 	Status         status.Status
 	Root           bool
+	Parent         string
 	HasDNS         bool
+	IPs            []string
+	WildcardDNS    bool
+	Discovered     time.Time
+	// TLSPolicy is TLSPolicyPass or TLSPolicyFail if the domain was checked against -tls-policy-min
+	TLSPolicy string
+	// SNI is the server name sent in the TLS handshake with the domain and SNIPresented the primary name of the
+	// certificate presented, SNIMismatch is true if the certificate was not valid for the SNI, such as a default certificate
+	SNI          string
+	SNIPresented string
+	SNIMismatch  bool
+	// Registrar and Registrant are the registrar and registrant organization of the domain's apex found with -rdap
+	Registrar  string
+	Registrant string
 }
 
+// TLS policy results
+const (
+	TLSPolicyPass = "pass" // the domain refused connections below the minimum TLS version
+	TLSPolicyFail = "fail" // the domain accepted a connection below the minimum TLS version
+)
+
 // NewDomainNode constructor for DomainNode, converts domain to nonWildcard
 func NewDomainNode(domain string, depth uint) *DomainNode {
 	domainNode := new(DomainNode)
@@ -29,6 +49,7 @@ func NewDomainNode(domain string, depth uint) *DomainNode {
 	domainNode.Depth = depth
 	domainNode.Certs = make(map[fingerprint.Fingerprint][]string)
 	domainNode.RelatedDomains = make(status.Map)
+	domainNode.Discovered = time.Now()
 	return domainNode
 }
 
@@ -84,6 +105,15 @@ func (d *DomainNode) String() string {
 			certString = fmt.Sprintf("%s %s", certString, fingerprint.HexString())
 		}
 	}
+	if len(d.TLSPolicy) > 0 {
+		certString = fmt.Sprintf("%s\tTLS policy %s", certString, d.TLSPolicy)
+	}
+	if d.SNIMismatch {
+		certString = fmt.Sprintf("%s\tSNI mismatch %s", certString, d.SNIPresented)
+	}
+	if len(d.Registrar) > 0 {
+		certString = fmt.Sprintf("%s\tRegistrar %s\tRegistrant %s", certString, d.Registrar, d.Registrant)
+	}
 	return fmt.Sprintf("%s\t%d\t%s\t%s", d.Domain, d.Depth, d.Status.String(), certString)
 }
 
@@ -104,8 +134,23 @@ func (d *DomainNode) ToMap() map[string]string {
 	m["id"] = d.Domain
 	m["status"] = d.Status.String()
 	m["root"] = strconv.FormatBool(d.Root)
+	m["parent"] = d.Parent
 	m["depth"] = strconv.FormatUint(uint64(d.Depth), 10)
 	m["related"] = relatedString
 	m["hasDNS"] = strconv.FormatBool(d.HasDNS)
+	m["ips"] = strings.Join(d.IPs, " ")
+	m["wildcardDNS"] = strconv.FormatBool(d.WildcardDNS)
+	if len(d.TLSPolicy) > 0 {
+		m["tlsPolicy"] = d.TLSPolicy
+	}
+	if len(d.SNI) > 0 {
+		m["sni"] = d.SNI
+		m["sniPresented"] = d.SNIPresented
+		m["sniMismatch"] = strconv.FormatBool(d.SNIMismatch)
+	}
+	if len(d.Registrar) > 0 {
+		m["registrar"] = d.Registrar
+		m["registrant"] = d.Registrant
+	}
 	return m
 }
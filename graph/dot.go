@@ -0,0 +1,63 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// number of fingerprint hex characters to label certificates with in DOT graphs
+const dotFingerprintLabel = 12
+
+// dotEscaper escapes the characters that can't appear in a quoted DOT ID
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+// dotQuote returns the quoted DOT ID of s
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// GenerateDOT writes a GraphViz DOT graph of the certificate graph to w
+// domains are ellipses and certificates are boxes, root domains are filled and expired certificates are red
+// directed graphs only include the domains, with edges from the domain that discovered each domain to it
+func (graph *CertGraph) GenerateDOT(w io.Writer, directed bool) error {
+	g := graph.export(0, time.Now(), directed)
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintln(b, "digraph certgraph {")
+	fmt.Fprintln(b, "\tnode [shape=ellipse];")
+	for _, node := range g.Nodes {
+		attributes := make([]string, 0, 3)
+		if node.Cert {
+			label := node.ID
+			if len(label) > dotFingerprintLabel {
+				label = label[:dotFingerprintLabel]
+			}
+			attributes = append(attributes, "shape=box", "label="+dotQuote(label))
+		}
+		if node.Root {
+			attributes = append(attributes, "style=filled", `fillcolor="#8ecae6"`)
+		}
+		if node.Expired {
+			attributes = append(attributes, "color=red")
+		}
+		if len(attributes) == 0 {
+			fmt.Fprintf(b, "\t%s;\n", dotQuote(node.ID))
+		} else {
+			fmt.Fprintf(b, "\t%s [%s];\n", dotQuote(node.ID), strings.Join(attributes, ", "))
+		}
+	}
+
+	// solid edges for certificates presented by a domain, dashed for SANs only
+	for _, edge := range g.Edges {
+		if edge.Type == "sans" {
+			fmt.Fprintf(b, "\t%s -> %s [style=dashed];\n", dotQuote(edge.Source), dotQuote(edge.Target))
+		} else {
+			fmt.Fprintf(b, "\t%s -> %s;\n", dotQuote(edge.Source), dotQuote(edge.Target))
+		}
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
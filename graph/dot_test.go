@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDOT(t *testing.T) {
+	graph := NewCertGraph()
+	buildExportGraph(graph)
+	cert1, cert2, cert3 := testFingerprint(1), testFingerprint(2), testFingerprint(3)
+	fingerprints := strings.NewReplacer("CERT1", cert1.HexString(), "CERT2", cert2.HexString(), "CERT3", cert3.HexString())
+
+	var b bytes.Buffer
+	if err := graph.GenerateDOT(&b, false); err != nil {
+		t.Fatal(err)
+	}
+	want := fingerprints.Replace(`digraph certgraph {
+	node [shape=ellipse];
+	"a.test" [style=filled, fillcolor="#8ecae6"];
+	"CERT1" [shape=box, label="010000000000"];
+	"b.test";
+	"CERT2" [shape=box, label="020000000000"];
+	"CERT3" [shape=box, label="030000000000", color=red];
+	"a.test" -> "CERT1";
+	"b.test" -> "CERT1";
+	"b.test" -> "CERT2";
+	"b.test" -> "CERT3";
+	"CERT3" -> "a.test" [style=dashed];
+}
+`)
+	if b.String() != want {
+		t.Errorf("GenerateDOT wrote:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestDOTQuote(t *testing.T) {
+	tests := map[string]string{
+		"a.test":          `"a.test"`,
+		`a"b`:             `"a\"b"`,
+		`a\b`:             `"a\\b"`,
+		"a\nb":            `"a\nb"`,
+		"\"];x [label=\"": `"\"];x [label=\""`,
+	}
+	for s, want := range tests {
+		if got := dotQuote(s); got != want {
+			t.Errorf("dotQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestGenerateDirected(t *testing.T) {
+	graph := NewCertGraph()
+	buildExportGraph(graph)
+	// discovered by a domain that is not in the graph
+	orphan := testDomain("d.test", 2)
+	orphan.Parent = "x.test"
+	graph.AddDomain(orphan)
+
+	var b bytes.Buffer
+	if err := graph.GenerateDOT(&b, true); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph certgraph {
+	node [shape=ellipse];
+	"a.test" [style=filled, fillcolor="#8ecae6"];
+	"b.test";
+	"d.test";
+	"a.test" -> "b.test";
+}
+`
+	if b.String() != want {
+		t.Errorf("directed GenerateDOT wrote:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	omitted, err := graph.GenerateMermaid(&b, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if omitted != 1 || !strings.Contains(b.String(), "\td0 --> d1\n") || strings.Contains(b.String(), "d.test") {
+		t.Errorf("directed GenerateMermaid of 2 nodes omitted %d nodes and wrote:\n%s", omitted, b.String())
+	}
+}
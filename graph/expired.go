@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"sort"
+	"time"
+)
+
+// ExpiredDomain holds a domain and the expired certificate it presented
+type ExpiredDomain struct {
+	Domain string
+	Cert   *CertNode
+}
+
+// ExpiredDomains returns every domain in the graph with a certificate that expired before t
+// sorted by how long ago the certificate expired, longest first
+// certificates without a known expiration are ignored
+func (graph *CertGraph) ExpiredDomains(t time.Time) []ExpiredDomain {
+	expired := make([]ExpiredDomain, 0)
+	graph.store.RangeDomains(func(domainNode *DomainNode) bool {
+		for fp := range domainNode.Certs {
+			certNode, ok := graph.GetCert(fp)
+			if ok && !certNode.NotAfter.IsZero() && certNode.NotAfter.Before(t) {
+				expired = append(expired, ExpiredDomain{Domain: domainNode.Domain, Cert: certNode})
+			}
+		}
+		return true
+	})
+
+	sort.Slice(expired, func(i, j int) bool {
+		if expired[i].Cert.NotAfter.Equal(expired[j].Cert.NotAfter) {
+			return expired[i].Domain < expired[j].Domain
+		}
+		return expired[i].Cert.NotAfter.Before(expired[j].Cert.NotAfter)
+	})
+	return expired
+}
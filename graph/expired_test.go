@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiredDomains(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	graph := NewCertGraph()
+	buildTestGraph(graph)
+	expired := []*CertNode{testCert(3, "a.test"), testCert(4, "b.test"), testCert(5, "b.test")}
+	expired[0].NotAfter = now.Add(-day)
+	expired[1].NotAfter = now.Add(-30 * day)
+	expired[2].NotAfter = time.Time{}
+	for _, certNode := range expired {
+		graph.AddCert(certNode)
+	}
+	for domain, certNodes := range map[string][]*CertNode{"a.test": expired[:1], "b.test": expired[1:]} {
+		domainNode, _ := graph.GetDomain(domain)
+		for _, certNode := range certNodes {
+			domainNode.AddCertFingerprint(certNode.Fingerprint, "test")
+		}
+		graph.UpdateDomain(domainNode)
+	}
+
+	// the certificate without a known expiration is ignored
+	domains := graph.ExpiredDomains(now)
+	if len(domains) != 2 {
+		t.Fatalf("ExpiredDomains returned %d domains, want 2: %v", len(domains), domains)
+	}
+	if domains[0].Domain != "b.test" || domains[0].Cert != expired[1] || domains[1].Domain != "a.test" || domains[1].Cert != expired[0] {
+		t.Errorf("ExpiredDomains = %v, want b.test then a.test", domains)
+	}
+	if domains := graph.ExpiredDomains(now.Add(-2 * day)); len(domains) != 1 {
+		t.Errorf("ExpiredDomains before cert 3 expired returned %d domains, want 1", len(domains))
+	}
+}
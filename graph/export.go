@@ -0,0 +1,129 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+// exportNode is a domain or certificate node in an exported graph
+type exportNode struct {
+	ID      string
+	Cert    bool
+	Root    bool
+	Expired bool
+}
+
+// exportEdge is a link between two nodes in an exported graph
+// Type is the drivers the certificate was found with for domain to certificate edges,
+// "sans" for certificate to domain edges where the domain did not present the certificate,
+// or "discovered" for directed edges from the domain that discovered a domain to it
+type exportEdge struct {
+	Source string
+	Target string
+	Type   string
+}
+
+// exportGraph is a deduplicated and deterministically ordered view of the graph
+// used by the text graph formats
+type exportGraph struct {
+	Nodes   []exportNode
+	Edges   []exportEdge
+	Omitted int
+}
+
+// export returns the graph's nodes and edges for the text graph formats
+// if the graph has more than maxNodes nodes only the maxNodes nodes closest to the root domains are included, 0 has no limit
+// certificates that expired before t are marked as expired
+// directed graphs only include the domains, linked in the direction they were discovered in
+func (graph *CertGraph) export(maxNodes int, t time.Time, directed bool) *exportGraph {
+	g := new(exportGraph)
+	included := make(map[string]bool)
+	full := func() bool {
+		return maxNodes > 0 && len(g.Nodes) >= maxNodes
+	}
+
+	// include the domains in BFS order, each followed by its certificates
+	domainNodes := graph.Domains()
+	sort.SliceStable(domainNodes, func(i, j int) bool {
+		return domainNodes[i].Depth < domainNodes[j].Depth
+	})
+	certNodes := make([]*CertNode, 0)
+	for _, domainNode := range domainNodes {
+		if full() {
+			break
+		}
+		g.Nodes = append(g.Nodes, exportNode{ID: domainNode.Domain, Root: domainNode.Root})
+		included[domainNode.Domain] = true
+		if directed {
+			continue
+		}
+		for _, fp := range sortedFingerprints(domainNode) {
+			id := fp.HexString()
+			if included[id] {
+				continue
+			}
+			certNode, ok := graph.GetCert(fp)
+			if !ok || full() {
+				continue
+			}
+			expired := !certNode.NotAfter.IsZero() && certNode.NotAfter.Before(t)
+			g.Nodes = append(g.Nodes, exportNode{ID: id, Cert: true, Expired: expired})
+			included[id] = true
+			certNodes = append(certNodes, certNode)
+		}
+	}
+
+	if directed {
+		g.Omitted = len(domainNodes) - len(g.Nodes)
+		for _, domainNode := range domainNodes {
+			if included[domainNode.Domain] && included[domainNode.Parent] {
+				g.Edges = append(g.Edges, exportEdge{Source: domainNode.Parent, Target: domainNode.Domain, Type: "discovered"})
+			}
+		}
+		return g
+	}
+	g.Omitted = len(domainNodes) + graph.NumCerts() - len(g.Nodes)
+
+	// domains to the certificates they presented
+	linked := make(map[string]bool)
+	for _, domainNode := range domainNodes {
+		if !included[domainNode.Domain] {
+			continue
+		}
+		for _, fp := range sortedFingerprints(domainNode) {
+			id := fp.HexString()
+			if !included[id] {
+				continue
+			}
+			g.Edges = append(g.Edges, exportEdge{Source: domainNode.Domain, Target: id, Type: strings.Join(domainNode.Certs[fp], " ")})
+			linked[domainNode.Domain+" "+id] = true
+		}
+	}
+
+	// certificates to the remaining domains in their SANs
+	for _, certNode := range certNodes {
+		id := certNode.Fingerprint.HexString()
+		for _, domain := range certNode.Domains {
+			domain = nonWildcard(domain)
+			key := domain + " " + id
+			if !included[domain] || linked[key] {
+				continue
+			}
+			g.Edges = append(g.Edges, exportEdge{Source: id, Target: domain, Type: "sans"})
+			linked[key] = true
+		}
+	}
+	return g
+}
+
+// sortedFingerprints returns the domain's certificate fingerprints sorted by their hex string
+func sortedFingerprints(domainNode *DomainNode) []fingerprint.Fingerprint {
+	fingerprints := domainNode.GetCertificates()
+	sort.Slice(fingerprints, func(i, j int) bool {
+		return fingerprints[i].HexString() < fingerprints[j].HexString()
+	})
+	return fingerprints
+}
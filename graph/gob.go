@@ -0,0 +1,118 @@
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// gobMagic starts every gob graph so they can be told apart from other graph formats
+const gobMagic = "certgraph gob\n"
+
+// GobVersion is the version of the gob graph format, graphs written with another version are rejected
+const GobVersion = 1
+
+// gobHeader is the first value of a gob graph
+type gobHeader struct {
+	Version int
+	// Metadata is the JSON encoded scan metadata
+	Metadata []byte
+}
+
+// gobRecord is a single node of a gob graph, only one of Domain and Cert is set
+// certificates are encoded as a certNodeGob instead of with CertNode.GobEncode so that
+// the type information is only sent once for the whole graph rather than once per certificate
+type gobRecord struct {
+	Domain *DomainNode
+	Cert   *certNodeGob
+}
+
+// IsGob returns true if the data read by r starts with a gob graph, without consuming it
+func IsGob(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(gobMagic))
+	return bytes.Equal(magic, []byte(gobMagic))
+}
+
+// WriteGob writes the graph and its metadata to w in the compact gob graph format, which can be read with ReadGob
+func (graph *CertGraph) WriteGob(w io.Writer, metadata map[string]interface{}) error {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	b := bufio.NewWriter(w)
+	_, err = b.WriteString(gobMagic)
+	if err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(b)
+	err = enc.Encode(gobHeader{Version: GobVersion, Metadata: metadataJSON})
+	if err != nil {
+		return err
+	}
+
+	graph.store.RangeDomains(func(domainNode *DomainNode) bool {
+		err = enc.Encode(gobRecord{Domain: domainNode})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
+		err = enc.Encode(gobRecord{Cert: &certNodeGob{Node: (*certNodeFields)(certNode), Found: certNode.Found()}})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return b.Flush()
+}
+
+// ReadGob adds the nodes of the gob graph read from r to the graph and returns the graph's metadata
+func (graph *CertGraph) ReadGob(r io.Reader) (map[string]interface{}, error) {
+	br := bufio.NewReader(r)
+	if !IsGob(br) {
+		return nil, fmt.Errorf("not a certgraph gob graph")
+	}
+	_, err := br.Discard(len(gobMagic))
+	if err != nil {
+		return nil, err
+	}
+	dec := gob.NewDecoder(br)
+	var header gobHeader
+	err = dec.Decode(&header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Version != GobVersion {
+		return nil, fmt.Errorf("unsupported gob graph version %d, expected version %d", header.Version, GobVersion)
+	}
+	var metadata map[string]interface{}
+	err = json.Unmarshal(header.Metadata, &metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var record gobRecord
+		err = dec.Decode(&record)
+		if err == io.EOF {
+			return metadata, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.Domain != nil {
+			graph.AddDomain(record.Domain)
+		}
+		if record.Cert != nil && record.Cert.Node != nil {
+			certNode := (*CertNode)(record.Cert.Node)
+			for _, found := range record.Cert.Found {
+				certNode.AddFound(found)
+			}
+			graph.AddCert(certNode)
+		}
+	}
+}
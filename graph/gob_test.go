@@ -0,0 +1,159 @@
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+func TestGobRoundTrip(t *testing.T) {
+	graph := NewCertGraph()
+	buildTestGraph(graph)
+	graph.UpdateCert(testFingerprint(2), func(certNode *CertNode) {
+		certNode.AddFound("other")
+		certNode.PolicyOIDs = []string{"2.23.140.1.2.1"}
+		certNode.Renewals = []Renewal{{Fingerprint: testFingerprint(3)}}
+	})
+
+	var buf bytes.Buffer
+	err := graph.WriteGob(&buf, map[string]interface{}{"version": "test", "domains": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsGob(bufio.NewReader(bytes.NewReader(buf.Bytes()))) {
+		t.Error("IsGob returned false for a gob graph")
+	}
+
+	loaded := NewCertGraph()
+	metadata, err := loaded.ReadGob(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the metadata round trips through JSON, so numbers are float64
+	if !reflect.DeepEqual(metadata, map[string]interface{}{"version": "test", "domains": float64(2)}) {
+		t.Errorf("ReadGob returned the metadata %v", metadata)
+	}
+	if got, want := canonicalMap(t, loaded), canonicalMap(t, graph); got != want {
+		t.Errorf("the loaded graph differs from the graph written:\nloaded:  %s\nwritten: %s", got, want)
+	}
+	certNode, ok := loaded.GetCert(testFingerprint(2))
+	if !ok {
+		t.Fatal("cert 2 was not loaded")
+	}
+	if !reflect.DeepEqual(certNode.Found(), []string{"other", "test"}) || len(certNode.PolicyOIDs) != 1 || len(certNode.Renewals) != 1 {
+		t.Errorf("cert 2 was loaded as %v with the policies %v and renewals %v", certNode, certNode.PolicyOIDs, certNode.Renewals)
+	}
+	domainNode, ok := loaded.GetDomain("b.test")
+	if !ok || domainNode.Depth != 1 || len(domainNode.Certs) != 2 {
+		t.Errorf("b.test was loaded as %v", domainNode)
+	}
+}
+
+func TestReadGobErrors(t *testing.T) {
+	var wrongVersion bytes.Buffer
+	wrongVersion.WriteString(gobMagic)
+	err := gob.NewEncoder(&wrongVersion).Encode(gobHeader{Version: GobVersion + 1, Metadata: []byte("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"json", `{"nodes": []}`, "not a certgraph gob graph"},
+		{"empty", "", "not a certgraph gob graph"},
+		{"truncated", gobMagic, "EOF"},
+		{"version", wrongVersion.String(), "unsupported gob graph version"},
+	}
+	for _, test := range tests {
+		_, err := NewCertGraph().ReadGob(strings.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ReadGob(%s) returned %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+}
+
+// largeTestGraph returns a graph of the domains n.test, each with its own certificate that also has the SANs of the next 2 domains
+func largeTestGraph(domains int) *CertGraph {
+	graph := NewCertGraph()
+	for i := 0; i < domains; i++ {
+		var fp fingerprint.Fingerprint
+		binary.BigEndian.PutUint32(fp[:], uint32(i))
+		certNode := testCert(0, fmt.Sprintf("%d.test", i), fmt.Sprintf("%d.test", i+1), fmt.Sprintf("%d.test", i+2))
+		certNode.Fingerprint = fp
+		graph.AddCert(certNode)
+		graph.AddDomain(testDomain(fmt.Sprintf("%d.test", i), uint(i/100), certNode))
+	}
+	return graph
+}
+
+// benchmarkDomains is the number of domains in the graphs the formats are benchmarked with
+const benchmarkDomains = 10000
+
+func BenchmarkWriteGob(b *testing.B) {
+	graph := largeTestGraph(benchmarkDomains)
+	var buf bytes.Buffer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := graph.WriteGob(&buf, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(buf.Len()), "bytes")
+}
+
+func BenchmarkReadGob(b *testing.B) {
+	var buf bytes.Buffer
+	if err := largeTestGraph(benchmarkDomains).WriteGob(&buf, nil); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewCertGraph().ReadGob(bytes.NewReader(buf.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(buf.Len()), "bytes")
+}
+
+func BenchmarkWriteJSON(b *testing.B) {
+	graph := largeTestGraph(benchmarkDomains)
+	var buf bytes.Buffer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := json.NewEncoder(&buf).Encode(graph.GenerateMap()); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(buf.Len()), "bytes")
+}
+
+// BenchmarkReadJSON only decodes the nodes and links, the JSON output can't be loaded back into a graph
+func BenchmarkReadJSON(b *testing.B) {
+	data, err := json.Marshal(largeTestGraph(benchmarkDomains).GenerateMap())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var decoded struct {
+			Nodes []map[string]string `json:"nodes"`
+			Links []map[string]string `json:"links"`
+		}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "bytes")
+}
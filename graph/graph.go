@@ -2,23 +2,30 @@
 package graph
 
 import (
+	"sort"
 	"strings"
-	"sync"
+	"sync/atomic"
 
 	"github.com/lanrat/certgraph/fingerprint"
 )
 
 // CertGraph main graph storage engine
 type CertGraph struct {
-	domains    sync.Map
-	certs      sync.Map
-	numDomains int
+	// numDomains is first so it is 64-bit aligned for atomic access, it is read while the graph is being crawled
+	numDomains int64
+	store      Store
 	depth      uint
 }
 
-// NewCertGraph instantiates a new empty CertGraph
+// NewCertGraph instantiates a new empty CertGraph held in memory
 func NewCertGraph() *CertGraph {
+	return NewCertGraphWithStore(NewMemoryStore())
+}
+
+// NewCertGraphWithStore instantiates a new empty CertGraph using the provided Store
+func NewCertGraphWithStore(store Store) *CertGraph {
 	graph := new(CertGraph)
+	graph.store = store
 	return graph
 }
 
@@ -26,12 +33,18 @@ func NewCertGraph() *CertGraph {
 func (graph *CertGraph) AddCert(certNode *CertNode) {
 	// save the cert to the graph
 	// if it already exists we overwrite, it is simpler than checking first.
-	graph.certs.Store(certNode.Fingerprint, certNode)
+	graph.store.AddCert(certNode)
+}
+
+// UpdateCert calls f to update the CertNode already in the graph with the Fingerprint
+// returns false if the certificate is not in the graph
+func (graph *CertGraph) UpdateCert(fp fingerprint.Fingerprint, f func(certNode *CertNode)) bool {
+	return graph.store.UpdateCert(fp, f)
 }
 
 // AddDomain add a DomainNode to the graph
 func (graph *CertGraph) AddDomain(domainNode *DomainNode) {
-	graph.numDomains++
+	atomic.AddInt64(&graph.numDomains, 1)
 	// save the new maximum depth if greather then current
 	if domainNode.Depth > graph.depth {
 		graph.depth = domainNode.Depth
@@ -39,12 +52,27 @@ func (graph *CertGraph) AddDomain(domainNode *DomainNode) {
 	// save the domain to the graph
 	// if it already exists we overwrite, it is simpler than checking first.
 	// graph.numDomains should still be accurate because we only call this after checking that we have not visited the node before.
-	graph.domains.Store(domainNode.Domain, domainNode)
+	graph.store.AddDomain(domainNode)
+}
+
+// UpdateDomain saves changes made to a DomainNode that is already in the graph
+func (graph *CertGraph) UpdateDomain(domainNode *DomainNode) {
+	graph.store.AddDomain(domainNode)
 }
 
 //NumDomains returns the number of domains in the graph
 func (graph *CertGraph) NumDomains() int {
-	return graph.numDomains
+	return int(atomic.LoadInt64(&graph.numDomains))
+}
+
+// NumCerts returns the number of certificates in the graph
+func (graph *CertGraph) NumCerts() int {
+	numCerts := 0
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
+		numCerts++
+		return true
+	})
+	return numCerts
 }
 
 //DomainDepth returns the maximum depth of the graph from the initial root domains
@@ -54,31 +82,39 @@ func (graph *CertGraph) DomainDepth() uint {
 
 // GetCert returns (CertNode, found) for the certificate with the provided Fingerprint in the graph if found
 func (graph *CertGraph) GetCert(fp fingerprint.Fingerprint) (*CertNode, bool) {
-	node, ok := graph.certs.Load(fp)
-	if ok {
-		return node.(*CertNode), true
-	}
-	return nil, false
+	return graph.store.GetCert(fp)
 }
 
 // GetDomain returns (DomainNode, found) for the domain in the graph if found
 func (graph *CertGraph) GetDomain(domain string) (*DomainNode, bool) {
-	node, ok := graph.domains.Load(domain)
-	if ok {
-		return node.(*DomainNode), true
-	}
-	return nil, false
+	return graph.store.GetDomain(domain)
+}
+
+// Domains returns all of the DomainNodes in the graph sorted by domain
+func (graph *CertGraph) Domains() []*DomainNode {
+	domainNodes := make([]*DomainNode, 0, graph.NumDomains())
+	graph.store.RangeDomains(func(domainNode *DomainNode) bool {
+		domainNodes = append(domainNodes, domainNode)
+		return true
+	})
+	sort.Slice(domainNodes, func(i, j int) bool {
+		return domainNodes[i].Domain < domainNodes[j].Domain
+	})
+	return domainNodes
 }
 
+// CertFilter returns true if the domains in the certificate should be crawled
+type CertFilter func(certNode *CertNode) bool
+
 // GetDomainNeighbors given a domain, return the list of all other domains that share a certificate with the provided domain that are in the graph
 // cdn will include CDN certs as well
-func (graph *CertGraph) GetDomainNeighbors(domain string, cdn bool, maxSANsSize int) []string {
+// certificates rejected by filter are not followed, a nil filter follows all certificates
+func (graph *CertGraph) GetDomainNeighbors(domain string, cdn bool, maxSANsSize int, filter CertFilter) []string {
 	neighbors := make(map[string]bool)
 
 	domain = nonWildcard(domain)
-	node, ok := graph.domains.Load(domain)
+	domainNode, ok := graph.GetDomain(domain)
 	if ok {
-		domainNode := node.(*DomainNode)
 		// related cert neighbors
 		for relatedDomain := range domainNode.RelatedDomains {
 			neighbors[relatedDomain] = true
@@ -86,13 +122,14 @@ func (graph *CertGraph) GetDomainNeighbors(domain string, cdn bool, maxSANsSize
 
 		// Cert neighbors
 		for _, fp := range domainNode.GetCertificates() {
-			node, ok := graph.certs.Load(fp)
+			certNode, ok := graph.GetCert(fp)
 			if ok {
-				certNode := node.(*CertNode)
 				if !cdn && certNode.CDNCert() {
 					//v(domain, "-> CDN CERT")
 				} else if maxSANsSize > 0 && certNode.ApexCount() > maxSANsSize {
 					//v(domain, "-> Large CERT")
+				} else if filter != nil && !filter(certNode) {
+					// filtered CERT
 				} else {
 					for _, neighbor := range certNode.Domains {
 						neighbors[neighbor] = true
@@ -120,29 +157,34 @@ func (graph *CertGraph) GetDomainNeighbors(domain string, cdn bool, maxSANsSize
 // used for JSON serialization
 func (graph *CertGraph) GenerateMap() map[string]interface{} {
 	m := make(map[string]interface{})
-	nodes := make([]map[string]string, 0, 2*graph.numDomains)
-	links := make([]map[string]string, 0, 2*graph.numDomains)
+	nodes := make([]map[string]string, 0, 2*graph.NumDomains())
+	links := make([]map[string]string, 0, 2*graph.NumDomains())
 
 	// add all domain nodes
-	graph.domains.Range(func(key, value interface{}) bool {
-		domainNode := value.(*DomainNode)
+	graph.store.RangeDomains(func(domainNode *DomainNode) bool {
 		nodes = append(nodes, domainNode.ToMap())
 		for fingerprint, found := range domainNode.Certs {
+			_, ok := graph.GetCert(fingerprint)
+			if !ok {
+				continue
+			}
 			links = append(links, map[string]string{"source": domainNode.Domain, "target": fingerprint.HexString(), "type": strings.Join(found, " ")})
 		}
 		return true
 	})
 
 	// add all cert nodes
-	graph.certs.Range(func(key, value interface{}) bool {
-		certNode := value.(*CertNode)
+	// SANs that were never added to the graph, because they were capped by a crawl limit or filtered out, are added as unreached domains
+	unreached := make(map[string]bool)
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
 		nodes = append(nodes, certNode.ToMap())
 		for _, domain := range certNode.Domains {
 			domain = nonWildcard(domain)
-			_, ok := graph.GetDomain(domain)
-			if ok {
-				links = append(links, map[string]string{"source": certNode.Fingerprint.HexString(), "target": domain, "type": "sans"})
+			if _, ok := graph.GetDomain(domain); !ok && !unreached[domain] {
+				unreached[domain] = true
+				nodes = append(nodes, unreachedDomainMap(domain))
 			}
+			links = append(links, map[string]string{"source": certNode.Fingerprint.HexString(), "target": domain, "type": "sans"})
 		}
 		return true
 	})
@@ -150,6 +192,17 @@ func (graph *CertGraph) GenerateMap() map[string]interface{} {
 	m["nodes"] = nodes
 	m["links"] = links
 	m["depth"] = graph.depth
-	m["numDomains"] = graph.numDomains
+	m["numDomains"] = graph.NumDomains()
 	return m
 }
+
+// unreachedDomainMap returns the map of a domain referenced by a certificate that is not in the graph
+func unreachedDomainMap(domain string) map[string]string {
+	return map[string]string{
+		"type":      "domain",
+		"id":        domain,
+		"status":    "Unreached",
+		"root":      "false",
+		"unreached": "true",
+	}
+}
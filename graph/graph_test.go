@@ -0,0 +1,177 @@
+package graph
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/fingerprint"
+	"github.com/lanrat/certgraph/status"
+)
+
+// testFingerprint returns a fingerprint starting with b
+func testFingerprint(b byte) fingerprint.Fingerprint {
+	var fp fingerprint.Fingerprint
+	fp[0] = b
+	return fp
+}
+
+// testCert returns a CertNode for the domains found by the test driver
+func testCert(b byte, domains ...string) *CertNode {
+	certNode := &CertNode{
+		Fingerprint: testFingerprint(b),
+		Domains:     domains,
+		NotBefore:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:    time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Issuer:      "CN=Test CA",
+	}
+	certNode.AddFound("test")
+	return certNode
+}
+
+// testDomain returns a DomainNode at the depth with the certificates
+func testDomain(domain string, depth uint, certs ...*CertNode) *DomainNode {
+	domainNode := NewDomainNode(domain, depth)
+	domainNode.Root = depth == 0
+	domainNode.Status = status.New(status.GOOD)
+	domainNode.Discovered = time.Time{}
+	for _, certNode := range certs {
+		domainNode.AddCertFingerprint(certNode.Fingerprint, "test")
+	}
+	return domainNode
+}
+
+// buildTestGraph adds the test graph to the graph:
+// a.test and b.test share cert 1, b.test also has cert 2 which has the unreached c.test SAN
+func buildTestGraph(graph *CertGraph) {
+	cert1 := testCert(1, "a.test", "b.test")
+	cert2 := testCert(2, "b.test", "c.test")
+	graph.AddCert(cert1)
+	graph.AddCert(cert2)
+	graph.AddDomain(testDomain("a.test", 0, cert1))
+	graph.AddDomain(testDomain("b.test", 1, cert1, cert2))
+}
+
+// canonicalMap returns the json of the GenerateMap output with its nodes and links sorted
+func canonicalMap(t *testing.T, graph *CertGraph) string {
+	t.Helper()
+	m := graph.GenerateMap()
+	for _, key := range []string{"nodes", "links"} {
+		entries := m[key].([]map[string]string)
+		sort.Slice(entries, func(i, j int) bool {
+			a, _ := json.Marshal(entries[i])
+			b, _ := json.Marshal(entries[j])
+			return string(a) < string(b)
+		})
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGenerateMap(t *testing.T) {
+	graph := NewCertGraph()
+	buildTestGraph(graph)
+	m := graph.GenerateMap()
+
+	nodes := make(map[string]map[string]string)
+	for _, node := range m["nodes"].([]map[string]string) {
+		nodes[node["id"]] = node
+	}
+	fp1, fp2 := testFingerprint(1), testFingerprint(2)
+	tests := []struct {
+		id        string
+		nodeType  string
+		status    string
+		unreached bool
+	}{
+		{"a.test", "domain", "Good", false},
+		{"b.test", "domain", "Good", false},
+		{"c.test", "domain", "Unreached", true},
+		{fp1.HexString(), "certificate", "", false},
+		{fp2.HexString(), "certificate", "", false},
+	}
+	if len(nodes) != len(tests) {
+		t.Errorf("GenerateMap has %d nodes, want %d", len(nodes), len(tests))
+	}
+	for _, test := range tests {
+		node, ok := nodes[test.id]
+		if !ok {
+			t.Errorf("node %s is missing", test.id)
+			continue
+		}
+		if node["type"] != test.nodeType {
+			t.Errorf("node %s has type %s, want %s", test.id, node["type"], test.nodeType)
+		}
+		if test.nodeType == "domain" && node["status"] != test.status {
+			t.Errorf("node %s has status %s, want %s", test.id, node["status"], test.status)
+		}
+		if (node["unreached"] == "true") != test.unreached {
+			t.Errorf("node %s unreached = %q, want %v", test.id, node["unreached"], test.unreached)
+		}
+	}
+
+	links := make(map[string]bool)
+	for _, link := range m["links"].([]map[string]string) {
+		links[link["source"]+" "+link["target"]+" "+link["type"]] = true
+	}
+	cert1, cert2 := fp1.HexString(), fp2.HexString()
+	wantLinks := []string{
+		"a.test " + cert1 + " test",
+		"b.test " + cert1 + " test",
+		"b.test " + cert2 + " test",
+		cert1 + " a.test sans",
+		cert1 + " b.test sans",
+		cert2 + " b.test sans",
+		cert2 + " c.test sans",
+	}
+	if len(links) != len(wantLinks) {
+		t.Errorf("GenerateMap has %d links, want %d", len(links), len(wantLinks))
+	}
+	for _, link := range wantLinks {
+		if !links[link] {
+			t.Errorf("link %q is missing", link)
+		}
+	}
+}
+
+func TestGetDomainNeighbors(t *testing.T) {
+	graph := NewCertGraph()
+	buildTestGraph(graph)
+	cdnCert := testCert(3, "b.test", "x.cloudflaressl.com")
+	graph.AddCert(cdnCert)
+	b, _ := graph.GetDomain("b.test")
+	b.AddCertFingerprint(cdnCert.Fingerprint, "test")
+	graph.UpdateDomain(b)
+
+	tests := []struct {
+		name        string
+		domain      string
+		cdn         bool
+		maxSANsSize int
+		filter      CertFilter
+		want        []string
+	}{
+		{"neighbors", "b.test", false, 0, nil, []string{"a.test", "c.test"}},
+		{"cdn", "b.test", true, 0, nil, []string{"a.test", "c.test", "x.cloudflaressl.com"}},
+		{"sans cap", "b.test", true, 1, nil, []string{}},
+		{"filter", "b.test", false, 0, func(certNode *CertNode) bool { return certNode.Fingerprint == testFingerprint(1) }, []string{"a.test"}},
+		{"unknown domain", "d.test", false, 0, nil, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := graph.GetDomainNeighbors(test.domain, test.cdn, test.maxSANsSize, test.filter)
+			sort.Strings(got)
+			if len(got) == 0 && len(test.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("GetDomainNeighbors(%s) = %v, want %v", test.domain, got, test.want)
+			}
+		})
+	}
+}
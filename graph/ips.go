@@ -0,0 +1,58 @@
+package graph
+
+import (
+	"bytes"
+	"net"
+	"sort"
+)
+
+// DomainIP holds an IP address and the domains in the graph that resolved to it
+type DomainIP struct {
+	IP      string
+	Domains []string
+}
+
+// IPs returns the distinct IP addresses the domains in the graph resolved to, along with the domains for each
+// the results are sorted numerically with IPv4 addresses first
+func (graph *CertGraph) IPs() []DomainIP {
+	ipDomains := make(map[string][]string)
+	graph.store.RangeDomains(func(domainNode *DomainNode) bool {
+		for _, ip := range domainNode.IPs {
+			ipDomains[ip] = append(ipDomains[ip], domainNode.Domain)
+		}
+		return true
+	})
+
+	ips := make([]DomainIP, 0, len(ipDomains))
+	for ip, domains := range ipDomains {
+		sort.Strings(domains)
+		ips = append(ips, DomainIP{IP: ip, Domains: domains})
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return compareIPs(ips[i].IP, ips[j].IP) < 0
+	})
+	return ips
+}
+
+// compareIPs compares two IP addresses numerically, IPv4 addresses are before IPv6 addresses
+// addresses that can't be parsed are compared as strings after all others
+func compareIPs(a, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		if ipA != nil {
+			return -1
+		}
+		if ipB != nil {
+			return 1
+		}
+		return bytes.Compare([]byte(a), []byte(b))
+	}
+	v4A, v4B := ipA.To4(), ipB.To4()
+	if (v4A == nil) != (v4B == nil) {
+		if v4A != nil {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(ipA.To16(), ipB.To16())
+}
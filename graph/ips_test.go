@@ -0,0 +1,33 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIPs(t *testing.T) {
+	graph := NewCertGraph()
+	ips := map[string][]string{
+		"a.test": {"192.0.2.10", "2001:db8::1"},
+		"b.test": {"192.0.2.9", "192.0.2.10"},
+		"c.test": {"bad", "10.0.0.1"},
+		"d.test": nil,
+	}
+	for domain, addrs := range ips {
+		domainNode := testDomain(domain, 1)
+		domainNode.IPs = addrs
+		graph.AddDomain(domainNode)
+	}
+
+	// sorted numerically rather than as strings, with IPv4 first and unparsable addresses last
+	want := []DomainIP{
+		{"10.0.0.1", []string{"c.test"}},
+		{"192.0.2.9", []string{"b.test"}},
+		{"192.0.2.10", []string{"a.test", "b.test"}},
+		{"2001:db8::1", []string{"a.test"}},
+		{"bad", []string{"c.test"}},
+	}
+	if got := graph.IPs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IPs() = %v, want %v", got, want)
+	}
+}
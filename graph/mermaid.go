@@ -0,0 +1,74 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// number of fingerprint hex characters to label certificates with in mermaid diagrams
+const mermaidFingerprintLabel = 12
+
+// mermaidEscaper escapes the characters that can't appear in a quoted mermaid label
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "#", "#35;")
+
+// GenerateMermaid writes a Mermaid graph definition of the certificate graph to w
+// graphs with more than maxNodes nodes are truncated to the nodes closest to the root domains, 0 has no limit
+// directed diagrams only include the domains, with edges from the domain that discovered each domain to it
+// returns the number of nodes omitted from the diagram
+func (graph *CertGraph) GenerateMermaid(w io.Writer, maxNodes int, directed bool) (int, error) {
+	g := graph.export(maxNodes, time.Now(), directed)
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintln(b, "graph LR")
+	fmt.Fprintln(b, "\tclassDef root stroke-width:3px,font-weight:bold")
+	fmt.Fprintln(b, "\tclassDef expired fill:#f88,stroke:#c00")
+
+	// mermaid ids can't contain dots, so nodes are given short ids
+	ids := make(map[string]string, len(g.Nodes))
+	roots := make([]string, 0)
+	expired := make([]string, 0)
+	domains, certs := 0, 0
+	for _, node := range g.Nodes {
+		var id string
+		if node.Cert {
+			id = fmt.Sprintf("c%d", certs)
+			certs++
+			label := node.ID
+			if len(label) > mermaidFingerprintLabel {
+				label = label[:mermaidFingerprintLabel]
+			}
+			fmt.Fprintf(b, "\t%s{{\"%s\"}}\n", id, mermaidEscaper.Replace(label))
+		} else {
+			id = fmt.Sprintf("d%d", domains)
+			domains++
+			fmt.Fprintf(b, "\t%s[\"%s\"]\n", id, mermaidEscaper.Replace(node.ID))
+		}
+		ids[node.ID] = id
+		if node.Root {
+			roots = append(roots, id)
+		}
+		if node.Expired {
+			expired = append(expired, id)
+		}
+	}
+
+	// solid edges for certificates presented by a domain, dotted for SANs only
+	for _, edge := range g.Edges {
+		arrow := "-->"
+		if edge.Type == "sans" {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(b, "\t%s %s %s\n", ids[edge.Source], arrow, ids[edge.Target])
+	}
+
+	if len(roots) > 0 {
+		fmt.Fprintf(b, "\tclass %s root\n", strings.Join(roots, ","))
+	}
+	if len(expired) > 0 {
+		fmt.Fprintf(b, "\tclass %s expired\n", strings.Join(expired, ","))
+	}
+	return g.Omitted, b.Flush()
+}
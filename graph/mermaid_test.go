@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildExportGraph adds the test graph to the graph along with the expired cert 3
+// presented by b.test, which also has the *.a.test SAN
+func buildExportGraph(graph *CertGraph) {
+	buildTestGraph(graph)
+	cert3 := testCert(3, "b.test", "*.a.test")
+	cert3.NotAfter = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	graph.AddCert(cert3)
+	b, _ := graph.GetDomain("b.test")
+	b.Parent = "a.test"
+	b.AddCertFingerprint(cert3.Fingerprint, "test")
+	graph.UpdateDomain(b)
+}
+
+func TestGenerateMermaid(t *testing.T) {
+	graph := NewCertGraph()
+	buildExportGraph(graph)
+
+	tests := []struct {
+		name     string
+		maxNodes int
+		omitted  int
+		want     string
+	}{
+		{"full", 0, 0, `graph LR
+	classDef root stroke-width:3px,font-weight:bold
+	classDef expired fill:#f88,stroke:#c00
+	d0["a.test"]
+	c0{{"010000000000"}}
+	d1["b.test"]
+	c1{{"020000000000"}}
+	c2{{"030000000000"}}
+	d0 --> c0
+	d1 --> c0
+	d1 --> c1
+	d1 --> c2
+	c2 -.-> d0
+	class d0 root
+	class c2 expired
+`},
+		// the nodes closest to the root are kept
+		{"truncated", 3, 2, `graph LR
+	classDef root stroke-width:3px,font-weight:bold
+	classDef expired fill:#f88,stroke:#c00
+	d0["a.test"]
+	c0{{"010000000000"}}
+	d1["b.test"]
+	d0 --> c0
+	d1 --> c0
+	class d0 root
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			omitted, err := graph.GenerateMermaid(&b, test.maxNodes, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if omitted != test.omitted {
+				t.Errorf("omitted %d nodes, want %d", omitted, test.omitted)
+			}
+			if b.String() != test.want {
+				t.Errorf("GenerateMermaid wrote:\n%s\nwant:\n%s", b.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateMermaidEscaping(t *testing.T) {
+	graph := NewCertGraph()
+	graph.AddDomain(testDomain(`a"<b>#.test`, 0))
+	var b bytes.Buffer
+	if _, err := graph.GenerateMermaid(&b, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `d0["a#quot;#lt;b#gt;#35;.test"]`) {
+		t.Errorf("GenerateMermaid did not escape the domain label:\n%s", b.String())
+	}
+}
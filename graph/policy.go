@@ -0,0 +1,69 @@
+package graph
+
+// validation levels of certificates, from their certificate policies
+const (
+	ValidationEV = "EV"
+	ValidationOV = "OV"
+	ValidationIV = "IV"
+	ValidationDV = "DV"
+	// certificates without a recognized policy are usually domain validated
+	ValidationUnknown = "Unknown/DV"
+)
+
+// policyValidation maps certificate policy OIDs to the validation level they assert
+// the CA/Browser Forum and ETSI OIDs, followed by the EV OIDs of CAs that predate them
+var policyValidation = map[string]string{
+	"2.23.140.1.1":                 ValidationEV,
+	"2.23.140.1.2.1":               ValidationDV,
+	"2.23.140.1.2.2":               ValidationOV,
+	"2.23.140.1.2.3":               ValidationIV,
+	"0.4.0.2042.1.4":               ValidationEV, // ETSI EVCP
+	"0.4.0.194112.1.4":             ValidationEV, // ETSI QEVCP-w
+	"0.4.0.2042.1.6":               ValidationDV, // ETSI DVCP
+	"0.4.0.2042.1.7":               ValidationOV, // ETSI OVCP
+	"1.3.6.1.4.1.44947.1.1.1":      ValidationDV, // Let's Encrypt
+	"1.2.392.200091.100.721.1":     ValidationEV, // SECOM
+	"1.2.616.1.113527.2.5.1.1":     ValidationEV, // Certum
+	"1.3.159.1.17.1":               ValidationEV, // Actalis
+	"1.3.6.1.4.1.14370.1.6":        ValidationEV, // GeoTrust
+	"1.3.6.1.4.1.14777.6.1.1":      ValidationEV, // Izenpe
+	"1.3.6.1.4.1.23223.1.1.1":      ValidationEV, // StartCom
+	"1.3.6.1.4.1.34697.2.1":        ValidationEV, // AffirmTrust
+	"1.3.6.1.4.1.4146.1.1":         ValidationEV, // GlobalSign
+	"1.3.6.1.4.1.4788.2.202.1":     ValidationEV, // D-Trust
+	"1.3.6.1.4.1.6449.1.2.1.5.1":   ValidationEV, // Sectigo / Comodo
+	"1.3.6.1.4.1.782.1.2.1.8.1":    ValidationEV, // Network Solutions
+	"1.3.6.1.4.1.8024.0.2.100.1.2": ValidationEV, // QuoVadis
+	"2.16.578.1.26.1.3.3":          ValidationEV, // Buypass
+	"2.16.756.1.89.1.2.1.1":        ValidationEV, // SwissSign
+	"2.16.840.1.113733.1.7.23.6":   ValidationEV, // Symantec / VeriSign
+	"2.16.840.1.113733.1.7.48.1":   ValidationEV, // Thawte
+	"2.16.840.1.113839.0.6.3":      ValidationEV, // IdenTrust
+	"2.16.840.1.114028.10.1.2":     ValidationEV, // Entrust
+	"2.16.840.1.114171.500.9":      ValidationEV, // Wells Fargo
+	"2.16.840.1.114404.1.1.2.4.1":  ValidationEV, // Trustwave
+	"2.16.840.1.114412.2.1":        ValidationEV, // DigiCert
+	"2.16.840.1.114413.1.7.23.3":   ValidationEV, // GoDaddy
+	"2.16.840.1.114414.1.7.23.3":   ValidationEV, // Starfield
+}
+
+// validationRank orders the validation levels from strongest to weakest
+var validationRank = map[string]int{
+	ValidationEV: 4,
+	ValidationOV: 3,
+	ValidationIV: 2,
+	ValidationDV: 1,
+}
+
+// ValidationLevel returns the strongest validation level asserted by the certificate's policies
+// certificates without a recognized policy are ValidationUnknown
+func (c *CertNode) ValidationLevel() string {
+	level := ValidationUnknown
+	for _, oid := range c.PolicyOIDs {
+		policyLevel, ok := policyValidation[oid]
+		if ok && validationRank[policyLevel] > validationRank[level] {
+			level = policyLevel
+		}
+	}
+	return level
+}
@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"testing"
+)
+
+func TestValidationLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []string
+		want     string
+	}{
+		{"no policies", nil, ValidationUnknown},
+		{"unrecognized", []string{"1.2.3.4"}, ValidationUnknown},
+		{"cab dv", []string{"2.23.140.1.2.1"}, ValidationDV},
+		{"cab ov", []string{"2.23.140.1.2.2"}, ValidationOV},
+		{"cab iv", []string{"2.23.140.1.2.3"}, ValidationIV},
+		{"cab ev", []string{"2.23.140.1.1"}, ValidationEV},
+		{"ca ev", []string{"2.16.840.1.114412.2.1"}, ValidationEV},
+		{"etsi ov", []string{"0.4.0.2042.1.7"}, ValidationOV},
+		{"lets encrypt", []string{"1.3.6.1.4.1.44947.1.1.1"}, ValidationDV},
+		// the strongest policy wins regardless of order
+		{"dv and ev", []string{"2.23.140.1.2.1", "1.2.3.4", "2.23.140.1.1"}, ValidationEV},
+		{"ov and dv", []string{"2.23.140.1.2.2", "2.23.140.1.2.1"}, ValidationOV},
+	}
+	for _, test := range tests {
+		certNode := testCert(1, "a.test")
+		certNode.PolicyOIDs = test.policies
+		if got := certNode.ValidationLevel(); got != test.want {
+			t.Errorf("%s: ValidationLevel() = %s, want %s", test.name, got, test.want)
+		}
+		if got := certNode.ToMap()["validation"]; got != test.want {
+			t.Errorf("%s: ToMap()[validation] = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
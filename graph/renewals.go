@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+// Renewal is a previous certificate of a renewed certificate's lineage
+type Renewal struct {
+	Fingerprint fingerprint.Fingerprint
+	NotBefore   time.Time
+	NotAfter    time.Time
+}
+
+// String returns the fingerprint and validity period of the renewal
+func (r Renewal) String() string {
+	return r.Fingerprint.HexString() + ":" + r.NotBefore.UTC().Format(renewalDateFormat) + "/" + r.NotAfter.UTC().Format(renewalDateFormat)
+}
+
+// renewalDateFormat is the format of the validity period of renewals
+const renewalDateFormat = "2006-01-02"
+
+// renewalKey returns the key of the certificate's lineage, certificates with the same SANs, issuer and public key
+// returns false if the issuer or public key of the certificate is not known
+func renewalKey(certNode *CertNode) (string, bool) {
+	if len(certNode.Issuer) == 0 || certNode.KeyFingerprint == (fingerprint.Fingerprint{}) {
+		return "", false
+	}
+	domains := make([]string, len(certNode.Domains))
+	copy(domains, certNode.Domains)
+	sort.Strings(domains)
+	return strings.Join(domains, " ") + "\n" + certNode.Issuer + "\n" + certNode.KeyFingerprint.HexString(), true
+}
+
+// newerCert returns true if certificate a is a later renewal than b
+func newerCert(a, b *CertNode) bool {
+	if !a.NotAfter.Equal(b.NotAfter) {
+		return a.NotAfter.After(b.NotAfter)
+	}
+	if !a.NotBefore.Equal(b.NotBefore) {
+		return a.NotBefore.After(b.NotBefore)
+	}
+	return a.Fingerprint.HexString() < b.Fingerprint.HexString()
+}
+
+// CollapseRenewals returns a new CertGraph where each lineage of renewed certificates, those with the same SANs,
+// issuer, and public key that only differ by their validity period, is collapsed into the latest certificate
+// which lists the others as its Renewals, along with the number of certificates that were collapsed
+// certificates whose issuer or public key is not known are never collapsed
+func (graph *CertGraph) CollapseRenewals() (*CertGraph, int) {
+	lineages := make(map[string][]*CertNode)
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
+		if key, ok := renewalKey(certNode); ok {
+			lineages[key] = append(lineages[key], certNode)
+		}
+		return true
+	})
+
+	collapsed := NewCertGraph()
+	// the certificate each collapsed certificate was collapsed into
+	latest := make(map[fingerprint.Fingerprint]fingerprint.Fingerprint)
+	for _, lineage := range lineages {
+		if len(lineage) < 2 {
+			continue
+		}
+		sort.Slice(lineage, func(i, j int) bool {
+			return newerCert(lineage[i], lineage[j])
+		})
+		certNode := *lineage[0]
+		certNode.foundMap = nil
+		certNode.Renewals = nil
+		for _, renewal := range lineage {
+			for _, found := range renewal.Found() {
+				certNode.AddFound(found)
+			}
+			if renewal == lineage[0] {
+				continue
+			}
+			certNode.Renewals = append(certNode.Renewals, Renewal{
+				Fingerprint: renewal.Fingerprint,
+				NotBefore:   renewal.NotBefore,
+				NotAfter:    renewal.NotAfter,
+			})
+			latest[renewal.Fingerprint] = certNode.Fingerprint
+		}
+		collapsed.AddCert(&certNode)
+	}
+
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
+		if _, found := latest[certNode.Fingerprint]; found {
+			return true
+		}
+		if _, found := collapsed.GetCert(certNode.Fingerprint); !found {
+			collapsed.AddCert(certNode)
+		}
+		return true
+	})
+
+	// link the domains to the latest certificate of each lineage instead of the certificates collapsed into it
+	graph.store.RangeDomains(func(domainNode *DomainNode) bool {
+		domainCopy := *domainNode
+		domainCopy.Certs = make(map[fingerprint.Fingerprint][]string, len(domainNode.Certs))
+		for fp, found := range domainNode.Certs {
+			if latestFP, ok := latest[fp]; ok {
+				fp = latestFP
+			}
+			domainCopy.Certs[fp] = mergeFound(domainCopy.Certs[fp], found)
+		}
+		collapsed.AddDomain(&domainCopy)
+		return true
+	})
+	return collapsed, len(latest)
+}
+
+// mergeFound returns the drivers in a along with any in b not already in a
+func mergeFound(a, b []string) []string {
+	merged := append([]string(nil), a...)
+	for _, found := range b {
+		exists := false
+		for _, m := range merged {
+			if m == found {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			merged = append(merged, found)
+		}
+	}
+	return merged
+}
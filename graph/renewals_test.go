@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+// renewedCert returns a test certificate for the domains with the key, valid from the start of the year for a year
+func renewedCert(b byte, year int, key byte, domains ...string) *CertNode {
+	certNode := testCert(b, domains...)
+	certNode.NotBefore = time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	certNode.NotAfter = certNode.NotBefore.AddDate(1, 0, 0)
+	certNode.KeyFingerprint = testFingerprint(key)
+	return certNode
+}
+
+func TestCollapseRenewals(t *testing.T) {
+	graph := NewCertGraph()
+	certs := []*CertNode{
+		// a lineage of 3 renewals, the SANs in a different order
+		renewedCert(1, 2018, 100, "a.test", "www.a.test"),
+		renewedCert(2, 2020, 100, "www.a.test", "a.test"),
+		renewedCert(3, 2019, 100, "a.test", "www.a.test"),
+		// a new key is a new lineage
+		renewedCert(4, 2017, 101, "a.test", "www.a.test"),
+		// an unknown key is never collapsed
+		renewedCert(5, 2016, 0, "a.test", "www.a.test"),
+		renewedCert(6, 2015, 0, "a.test", "www.a.test"),
+	}
+	certs[0].AddFound("other")
+	a := testDomain("a.test", 0)
+	for _, certNode := range certs {
+		graph.AddCert(certNode)
+		a.AddCertFingerprint(certNode.Fingerprint, "test")
+	}
+	graph.AddDomain(a)
+
+	collapsed, count := graph.CollapseRenewals()
+	if count != 2 {
+		t.Errorf("collapsed %d certificates, want 2", count)
+	}
+	if collapsed.NumCerts() != 4 {
+		t.Errorf("collapsed graph has %d certificates, want 4", collapsed.NumCerts())
+	}
+	for _, b := range []byte{1, 3} {
+		if _, ok := collapsed.GetCert(testFingerprint(b)); ok {
+			t.Errorf("cert %d was not collapsed", b)
+		}
+	}
+
+	latest, ok := collapsed.GetCert(testFingerprint(2))
+	if !ok {
+		t.Fatal("the latest cert of the lineage is missing")
+	}
+	wantRenewals := []fingerprint.Fingerprint{testFingerprint(3), testFingerprint(1)}
+	if len(latest.Renewals) != len(wantRenewals) {
+		t.Fatalf("latest cert has the renewals %v, want certs 3 and 1", latest.Renewals)
+	}
+	for i, renewal := range latest.Renewals {
+		if renewal.Fingerprint != wantRenewals[i] {
+			t.Errorf("renewal %d is %s, want %s", i, renewal.Fingerprint.HexString(), wantRenewals[i].HexString())
+		}
+	}
+	if found := latest.Found(); len(found) != 2 {
+		t.Errorf("latest cert found by %v, want the drivers of the whole lineage", found)
+	}
+	fp3 := testFingerprint(3)
+	if s := latest.Renewals[0].String(); s != fp3.HexString()+":2019-01-01/2020-01-01" {
+		t.Errorf("renewal String() = %s", s)
+	}
+
+	domainNode, ok := collapsed.GetDomain("a.test")
+	if !ok || len(domainNode.Certs) != 4 {
+		t.Fatalf("a.test links to %v, want the 4 remaining certificates", domainNode)
+	}
+	if _, ok := domainNode.Certs[testFingerprint(1)]; ok {
+		t.Error("a.test still links to a collapsed certificate")
+	}
+
+	// the original graph is not modified
+	if graph.NumCerts() != len(certs) {
+		t.Errorf("the original graph has %d certificates, want %d", graph.NumCerts(), len(certs))
+	}
+	if original, _ := graph.GetCert(testFingerprint(2)); len(original.Renewals) != 0 {
+		t.Errorf("the original cert has the renewals %v", original.Renewals)
+	}
+}
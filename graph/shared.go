@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"sort"
+
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+// SharedCert holds a certificate and the domains in the graph that presented it
+type SharedCert struct {
+	Cert    *CertNode
+	Domains []string
+}
+
+// SharedCerts returns all certificates in the graph that were found on at least minDomains distinct domains
+// the results are sorted by the number of domains descending
+func (graph *CertGraph) SharedCerts(minDomains int) []SharedCert {
+	certDomains := make(map[fingerprint.Fingerprint][]string)
+	graph.store.RangeDomains(func(domainNode *DomainNode) bool {
+		for fp := range domainNode.Certs {
+			certDomains[fp] = append(certDomains[fp], domainNode.Domain)
+		}
+		return true
+	})
+
+	shared := make([]SharedCert, 0)
+	for fp, domains := range certDomains {
+		if len(domains) < minDomains {
+			continue
+		}
+		certNode, ok := graph.GetCert(fp)
+		if !ok {
+			continue
+		}
+		sort.Strings(domains)
+		shared = append(shared, SharedCert{Cert: certNode, Domains: domains})
+	}
+
+	sort.Slice(shared, func(i, j int) bool {
+		if len(shared[i].Domains) == len(shared[j].Domains) {
+			return shared[i].Cert.Fingerprint.HexString() < shared[j].Cert.Fingerprint.HexString()
+		}
+		return len(shared[i].Domains) > len(shared[j].Domains)
+	})
+	return shared
+}
@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSharedCerts(t *testing.T) {
+	graph := NewCertGraph()
+	buildTestGraph(graph)
+	cert3 := testCert(3, "a.test", "b.test", "c.test")
+	graph.AddCert(cert3)
+	for _, domain := range []string{"a.test", "b.test"} {
+		domainNode, _ := graph.GetDomain(domain)
+		domainNode.AddCertFingerprint(cert3.Fingerprint, "test")
+		graph.UpdateDomain(domainNode)
+	}
+	graph.AddDomain(testDomain("c.test", 2, cert3))
+
+	shared := graph.SharedCerts(2)
+	if len(shared) != 2 {
+		t.Fatalf("SharedCerts(2) returned %d certificates, want 2", len(shared))
+	}
+	if shared[0].Cert.Fingerprint != cert3.Fingerprint || !reflect.DeepEqual(shared[0].Domains, []string{"a.test", "b.test", "c.test"}) {
+		t.Errorf("most shared certificate is %x on %v, want cert 3 on a, b, and c", shared[0].Cert.Fingerprint[0], shared[0].Domains)
+	}
+	if shared[1].Cert.Fingerprint != testFingerprint(1) || !reflect.DeepEqual(shared[1].Domains, []string{"a.test", "b.test"}) {
+		t.Errorf("second most shared certificate is %x on %v, want cert 1 on a and b", shared[1].Cert.Fingerprint[0], shared[1].Domains)
+	}
+
+	if shared := graph.SharedCerts(3); len(shared) != 1 {
+		t.Errorf("SharedCerts(3) returned %d certificates, want 1", len(shared))
+	}
+	// cert 2 is only presented by b.test, its c.test SAN doesn't count
+	if shared := graph.SharedCerts(1); len(shared) != 3 || len(shared[2].Domains) != 1 {
+		t.Errorf("SharedCerts(1) returned %v", shared)
+	}
+}
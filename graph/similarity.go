@@ -0,0 +1,75 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SimilarCerts holds a pair of certificates and the Jaccard index of their SAN sets
+type SimilarCerts struct {
+	A          *CertNode
+	B          *CertNode
+	Similarity float64
+}
+
+// CertSimilarity returns every pair of certificates in the graph whose SAN sets have a Jaccard index of at least threshold
+// the results are sorted by similarity descending
+// it is an error for the graph to have more than maxCerts certificates, 0 has no limit
+func (graph *CertGraph) CertSimilarity(threshold float64, maxCerts int) ([]SimilarCerts, error) {
+	certNodes := make([]*CertNode, 0)
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
+		certNodes = append(certNodes, certNode)
+		return true
+	})
+	if maxCerts > 0 && len(certNodes) > maxCerts {
+		return nil, fmt.Errorf("graph has %d certificates, more than the limit of %d", len(certNodes), maxCerts)
+	}
+	sort.Slice(certNodes, func(i, j int) bool {
+		return certNodes[i].Fingerprint.HexString() < certNodes[j].Fingerprint.HexString()
+	})
+
+	// index the certificates by the SANs they contain
+	sanSets := make([]map[string]bool, len(certNodes))
+	index := make(map[string][]int)
+	for i, certNode := range certNodes {
+		sans := make(map[string]bool, len(certNode.Domains))
+		for _, domain := range certNode.Domains {
+			sans[strings.ToLower(domain)] = true
+		}
+		sanSets[i] = sans
+		for san := range sans {
+			index[san] = append(index[san], i)
+		}
+	}
+
+	// only certificates that share a SAN can be similar
+	similar := make([]SimilarCerts, 0)
+	for i := range certNodes {
+		intersections := make(map[int]int)
+		for san := range sanSets[i] {
+			for _, j := range index[san] {
+				if j > i {
+					intersections[j]++
+				}
+			}
+		}
+		for j, intersection := range intersections {
+			similarity := float64(intersection) / float64(len(sanSets[i])+len(sanSets[j])-intersection)
+			if similarity >= threshold {
+				similar = append(similar, SimilarCerts{A: certNodes[i], B: certNodes[j], Similarity: similarity})
+			}
+		}
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Similarity == similar[j].Similarity {
+			if similar[i].A == similar[j].A {
+				return similar[i].B.Fingerprint.HexString() < similar[j].B.Fingerprint.HexString()
+			}
+			return similar[i].A.Fingerprint.HexString() < similar[j].A.Fingerprint.HexString()
+		}
+		return similar[i].Similarity > similar[j].Similarity
+	})
+	return similar, nil
+}
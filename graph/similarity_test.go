@@ -0,0 +1,43 @@
+package graph
+
+import (
+	"testing"
+)
+
+func TestCertSimilarity(t *testing.T) {
+	graph := NewCertGraph()
+	graph.AddCert(testCert(1, "a.test", "b.test", "c.test", "d.test"))
+	graph.AddCert(testCert(2, "A.test", "b.test", "c.test"))
+	graph.AddCert(testCert(3, "a.test", "x.test"))
+	graph.AddCert(testCert(4, "y.test"))
+
+	similar, err := graph.CertSimilarity(0.2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SANs are compared case insensitively, certs that share no SANs are never compared
+	want := []struct {
+		a, b       byte
+		similarity float64
+	}{
+		{1, 2, 0.75},
+		{2, 3, 0.25},
+		{1, 3, 0.2},
+	}
+	if len(similar) != len(want) {
+		t.Fatalf("CertSimilarity returned %d pairs, want %d: %v", len(similar), len(want), similar)
+	}
+	for i, w := range want {
+		pair := similar[i]
+		if pair.A.Fingerprint != testFingerprint(w.a) || pair.B.Fingerprint != testFingerprint(w.b) || pair.Similarity != w.similarity {
+			t.Errorf("pair %d is %x and %x with %f, want certs %d and %d with %f", i, pair.A.Fingerprint[0], pair.B.Fingerprint[0], pair.Similarity, w.a, w.b, w.similarity)
+		}
+	}
+
+	if similar, _ := graph.CertSimilarity(0.5, 0); len(similar) != 1 {
+		t.Errorf("CertSimilarity(0.5) returned %d pairs, want 1", len(similar))
+	}
+	if _, err := graph.CertSimilarity(0.2, 3); err == nil {
+		t.Error("CertSimilarity of more certificates than the limit did not fail")
+	}
+}
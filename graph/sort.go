@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DomainSortKeys are the keys domains can be sorted by with SortDomains
+var DomainSortKeys = []string{"domain", "depth", "certs", "discovered"}
+
+// domainSorts are the comparators for each of the DomainSortKeys
+var domainSorts = map[string]func(a, b *DomainNode) bool{
+	"domain": func(a, b *DomainNode) bool {
+		return a.Domain < b.Domain
+	},
+	"depth": func(a, b *DomainNode) bool {
+		return a.Depth < b.Depth
+	},
+	// domains with the most certificates first
+	"certs": func(a, b *DomainNode) bool {
+		return len(a.Certs) > len(b.Certs)
+	},
+	"discovered": func(a, b *DomainNode) bool {
+		return a.Discovered.Before(b.Discovered)
+	},
+}
+
+// SortDomains sorts the domainNodes by key, domains that are equal by key are sorted by domain
+func SortDomains(domainNodes []*DomainNode, key string) error {
+	less, ok := domainSorts[key]
+	if !ok {
+		return fmt.Errorf("unknown sort key: %s", key)
+	}
+	sort.Slice(domainNodes, func(i, j int) bool {
+		if less(domainNodes[i], domainNodes[j]) {
+			return true
+		}
+		if less(domainNodes[j], domainNodes[i]) {
+			return false
+		}
+		return domainNodes[i].Domain < domainNodes[j].Domain
+	})
+	return nil
+}
@@ -0,0 +1,47 @@
+package graph
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSortDomains(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newDomains := func() []*DomainNode {
+		c := testDomain("c.test", 1, testCert(1), testCert(2))
+		c.Discovered = start
+		b := testDomain("b.test", 2, testCert(1))
+		b.Discovered = start.Add(2 * time.Second)
+		a := testDomain("a.test", 1, testCert(1))
+		a.Discovered = start.Add(time.Second)
+		return []*DomainNode{c, b, a}
+	}
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"domain", []string{"a.test", "b.test", "c.test"}},
+		// ties are sorted by domain
+		{"depth", []string{"a.test", "c.test", "b.test"}},
+		{"certs", []string{"c.test", "a.test", "b.test"}},
+		{"discovered", []string{"c.test", "a.test", "b.test"}},
+	}
+	for _, test := range tests {
+		domainNodes := newDomains()
+		if err := SortDomains(domainNodes, test.key); err != nil {
+			t.Fatal(err)
+		}
+		for i, domainNode := range domainNodes {
+			if domainNode.Domain != test.want[i] {
+				t.Errorf("SortDomains(%s) put %s at %d, want %s", test.key, domainNode.Domain, i, test.want[i])
+			}
+		}
+	}
+	if len(DomainSortKeys) != len(domainSorts) {
+		t.Errorf("DomainSortKeys has %d keys, want the %d sorts", len(DomainSortKeys), len(domainSorts))
+	}
+	if err := SortDomains(newDomains(), "size"); err == nil {
+		t.Error("SortDomains with an unknown key did not fail")
+	}
+}
@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"sync"
+
+	"github.com/lanrat/certgraph/fingerprint"
+)
+
+// Store is the storage backend used by CertGraph to hold its nodes
+// nodes returned by a Store may be copies, so changes to them must be saved back with AddDomain, AddCert, or UpdateCert
+type Store interface {
+	// AddDomain saves the DomainNode, overwriting any existing node for the domain
+	AddDomain(domainNode *DomainNode)
+
+	// GetDomain returns (DomainNode, found) for the domain
+	GetDomain(domain string) (*DomainNode, bool)
+
+	// AddCert saves the CertNode, overwriting any existing node with the same Fingerprint
+	AddCert(certNode *CertNode)
+
+	// GetCert returns (CertNode, found) for the certificate with the provided Fingerprint
+	GetCert(fp fingerprint.Fingerprint) (*CertNode, bool)
+
+	// UpdateCert calls f with the CertNode for the certificate with the provided Fingerprint and saves the changes f makes to it,
+	// without losing the changes of concurrent calls to UpdateCert
+	// returns false without calling f if the certificate is not in the Store
+	UpdateCert(fp fingerprint.Fingerprint, f func(certNode *CertNode)) bool
+
+	// RangeDomains calls f for every DomainNode in the Store, stopping if f returns false
+	RangeDomains(f func(domainNode *DomainNode) bool)
+
+	// RangeCerts calls f for every CertNode in the Store, stopping if f returns false
+	RangeCerts(f func(certNode *CertNode) bool)
+}
+
+// memoryStore is the default Store which holds all nodes in memory
+type memoryStore struct {
+	domains  sync.Map
+	certs    sync.Map
+	certLock sync.Mutex
+}
+
+// NewMemoryStore returns a new Store that holds the graph in memory
+func NewMemoryStore() Store {
+	return new(memoryStore)
+}
+
+func (s *memoryStore) AddDomain(domainNode *DomainNode) {
+	s.domains.Store(domainNode.Domain, domainNode)
+}
+
+func (s *memoryStore) GetDomain(domain string) (*DomainNode, bool) {
+	node, ok := s.domains.Load(domain)
+	if ok {
+		return node.(*DomainNode), true
+	}
+	return nil, false
+}
+
+func (s *memoryStore) AddCert(certNode *CertNode) {
+	s.certs.Store(certNode.Fingerprint, certNode)
+}
+
+func (s *memoryStore) GetCert(fp fingerprint.Fingerprint) (*CertNode, bool) {
+	node, ok := s.certs.Load(fp)
+	if ok {
+		return node.(*CertNode), true
+	}
+	return nil, false
+}
+
+func (s *memoryStore) UpdateCert(fp fingerprint.Fingerprint, f func(certNode *CertNode)) bool {
+	certNode, ok := s.GetCert(fp)
+	if !ok {
+		return false
+	}
+	s.certLock.Lock()
+	defer s.certLock.Unlock()
+	f(certNode)
+	return true
+}
+
+func (s *memoryStore) RangeDomains(f func(domainNode *DomainNode) bool) {
+	s.domains.Range(func(key, value interface{}) bool {
+		return f(value.(*DomainNode))
+	})
+}
+
+func (s *memoryStore) RangeCerts(f func(certNode *CertNode) bool) {
+	s.certs.Range(func(key, value interface{}) bool {
+		return f(value.(*CertNode))
+	})
+}
@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// testStores returns a memory and a Bolt Store, keyed by name, and a function to close them
+func testStores(t *testing.T) (map[string]Store, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	boltStore, err := NewBoltStore(filepath.Join(dir, "graph.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"bolt":   boltStore,
+	}
+	return stores, func() {
+		err := boltStore.Close()
+		if err != nil {
+			t.Error(err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStoreEquivalence(t *testing.T) {
+	maps := make(map[string]string)
+	stores, closeStores := testStores(t)
+	defer closeStores()
+	for name, store := range stores {
+		graph := NewCertGraphWithStore(store)
+		buildTestGraph(graph)
+		graph.UpdateCert(testFingerprint(1), func(certNode *CertNode) {
+			certNode.AddFound("other")
+		})
+		if graph.UpdateCert(testFingerprint(9), func(certNode *CertNode) {
+			t.Errorf("%s: UpdateCert called f for a certificate not in the graph", name)
+		}) {
+			t.Errorf("%s: UpdateCert of a certificate not in the graph returned true", name)
+		}
+
+		if graph.NumDomains() != 2 || graph.NumCerts() != 2 {
+			t.Errorf("%s: graph has %d domains and %d certs, want 2 and 2", name, graph.NumDomains(), graph.NumCerts())
+		}
+		certNode, ok := graph.GetCert(testFingerprint(1))
+		if !ok {
+			t.Fatalf("%s: cert 1 not found", name)
+		}
+		if found := certNode.Found(); !reflect.DeepEqual(found, []string{"other", "test"}) {
+			t.Errorf("%s: cert 1 found by %v, want [other test]", name, found)
+		}
+		domainNode, ok := graph.GetDomain("b.test")
+		if !ok || len(domainNode.Certs) != 2 || domainNode.Depth != 1 {
+			t.Errorf("%s: GetDomain(b.test) = %v, %v", name, domainNode, ok)
+		}
+		if _, ok := graph.GetDomain("c.test"); ok {
+			t.Errorf("%s: the unreached c.test was returned by GetDomain", name)
+		}
+		maps[name] = canonicalMap(t, graph)
+	}
+	if maps["memory"] != maps["bolt"] {
+		t.Errorf("the memory and bolt stores generated different graphs:\nmemory: %s\nbolt:   %s", maps["memory"], maps["bolt"])
+	}
+}
+
+func TestStoreUpdateCertConcurrent(t *testing.T) {
+	const updates = 50
+	stores, closeStores := testStores(t)
+	defer closeStores()
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			store.AddCert(testCert(1, "a.test"))
+			var wg sync.WaitGroup
+			for i := 0; i < updates; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					store.UpdateCert(testFingerprint(1), func(certNode *CertNode) {
+						certNode.AddFound(fmt.Sprintf("driver%d", i))
+					})
+				}(i)
+			}
+			wg.Wait()
+
+			certNode, _ := store.GetCert(testFingerprint(1))
+			// every update and the original test driver
+			if found := certNode.Found(); len(found) != updates+1 {
+				t.Errorf("cert found by %d drivers, want %d: %v", len(found), updates+1, found)
+			}
+		})
+	}
+}
+
+func TestStoreRange(t *testing.T) {
+	stores, closeStores := testStores(t)
+	defer closeStores()
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			// more than a single batch of the bolt store
+			for i := 0; i < boltRangeBatch+10; i++ {
+				store.AddDomain(testDomain(fmt.Sprintf("%d.test", i), 1))
+			}
+			count := 0
+			store.RangeDomains(func(domainNode *DomainNode) bool {
+				count++
+				return true
+			})
+			if count != boltRangeBatch+10 {
+				t.Errorf("RangeDomains returned %d domains, want %d", count, boltRangeBatch+10)
+			}
+
+			count = 0
+			store.RangeDomains(func(domainNode *DomainNode) bool {
+				count++
+				return count < 5
+			})
+			if count != 5 {
+				t.Errorf("RangeDomains continued after f returned false, called %d times", count)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+)
+
+// SubjectGroup holds the certificates in the graph issued to the same subject organization
+type SubjectGroup struct {
+	Organization string
+	Certs        []*CertNode
+}
+
+// GroupBySubject returns the certificates in the graph with a subject organization grouped by it,
+// along with the number of certificates without one, such as DV certificates
+// the groups are sorted by the number of certificates descending, and each group's certificates by fingerprint
+func (graph *CertGraph) GroupBySubject() ([]SubjectGroup, int) {
+	groups := make(map[string][]*CertNode)
+	withoutSubject := 0
+	graph.store.RangeCerts(func(certNode *CertNode) bool {
+		organization := strings.Join(certNode.Organization, ", ")
+		if len(strings.TrimSpace(organization)) == 0 {
+			withoutSubject++
+			return true
+		}
+		groups[organization] = append(groups[organization], certNode)
+		return true
+	})
+
+	subjects := make([]SubjectGroup, 0, len(groups))
+	for organization, certs := range groups {
+		sort.Slice(certs, func(i, j int) bool {
+			return certs[i].Fingerprint.HexString() < certs[j].Fingerprint.HexString()
+		})
+		subjects = append(subjects, SubjectGroup{Organization: organization, Certs: certs})
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		if len(subjects[i].Certs) == len(subjects[j].Certs) {
+			return subjects[i].Organization < subjects[j].Organization
+		}
+		return len(subjects[i].Certs) > len(subjects[j].Certs)
+	})
+	return subjects, withoutSubject
+}
@@ -0,0 +1,56 @@
+package graph
+
+import (
+	"testing"
+)
+
+func TestGroupBySubject(t *testing.T) {
+	graph := NewCertGraph()
+	organizations := []struct {
+		b            byte
+		organization []string
+	}{
+		{1, []string{"Example Inc"}},
+		{2, []string{"Other LLC"}},
+		{3, []string{"Example Inc"}},
+		{4, []string{"Example Inc", "Subsidiary"}},
+		{5, []string{"Another Corp"}},
+		{6, []string{"Other LLC"}},
+		{7, nil},
+		{8, []string{" "}},
+	}
+	// add the certificates in reverse so the groups are sorted rather than in the order they were added
+	for i := len(organizations) - 1; i >= 0; i-- {
+		certNode := testCert(organizations[i].b, "a.test")
+		certNode.Organization = organizations[i].organization
+		graph.AddCert(certNode)
+	}
+
+	groups, withoutSubject := graph.GroupBySubject()
+	if withoutSubject != 2 {
+		t.Errorf("%d certificates without a subject, want 2", withoutSubject)
+	}
+	want := []struct {
+		organization string
+		certs        []byte
+	}{
+		{"Example Inc", []byte{1, 3}},
+		{"Other LLC", []byte{2, 6}},
+		{"Another Corp", []byte{5}},
+		{"Example Inc, Subsidiary", []byte{4}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("GroupBySubject returned %d groups, want %d: %v", len(groups), len(want), groups)
+	}
+	for i, group := range groups {
+		if group.Organization != want[i].organization || len(group.Certs) != len(want[i].certs) {
+			t.Errorf("group %d is %s with %d certificates, want %s with %d", i, group.Organization, len(group.Certs), want[i].organization, len(want[i].certs))
+			continue
+		}
+		for j, certNode := range group.Certs {
+			if certNode.Fingerprint != testFingerprint(want[i].certs[j]) {
+				t.Errorf("certificate %d of %s is %s, want cert %d", j, group.Organization, certNode.Fingerprint.HexString(), want[i].certs[j])
+			}
+		}
+	}
+}
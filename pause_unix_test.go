@@ -0,0 +1,110 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+	"github.com/lanrat/certgraph/graph"
+	"github.com/lanrat/certgraph/status"
+)
+
+// isPaused returns true if the crawl is paused
+func isPaused() bool {
+	crawlPause.lock.Lock()
+	defer crawlPause.lock.Unlock()
+	return crawlPause.resumed != nil
+}
+
+// sendPauseSignal sends pauseSignal to the process
+func sendPauseSignal(t *testing.T) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(pauseSignal)
+	}
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPauseSignal(t *testing.T) {
+	defer crawlPause.resume()
+
+	// querying the seed pauses the crawl, so its neighbors wait until it is resumed
+	paused := make(chan struct{})
+	var queriedWhilePaused, queried int32
+	d := newFakeDriver()
+	d.query = func(ctx context.Context, domain string) error {
+		if domain != "a.test" {
+			atomic.AddInt32(&queried, 1)
+			return nil
+		}
+		sendPauseSignal(t)
+		for start := time.Now(); !isPaused(); time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				return errors.New("crawl was not paused")
+			}
+		}
+		close(paused)
+		return nil
+	}
+	go func() {
+		<-paused
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&queriedWhilePaused, atomic.LoadInt32(&queried))
+		sendPauseSignal(t)
+	}()
+
+	code := runCertgraph(t, map[string]driver.Driver{"fake": d}, "-driver", "fake", "a.test")
+	if code != exitOK {
+		t.Errorf("paused and resumed crawl exited with %d, want %d", code, exitOK)
+	}
+	if n := atomic.LoadInt32(&queriedWhilePaused); n != 0 {
+		t.Errorf("queried %d domains while the crawl was paused, want none", n)
+	}
+	if n := atomic.LoadInt32(&queried); n != 3 || certGraph.NumDomains() != 4 {
+		t.Errorf("queried %d neighbors of %d domains after the crawl was resumed, want all 3 of 4", n, certGraph.NumDomains())
+	}
+}
+
+func TestPauseCancel(t *testing.T) {
+	resetState()
+	d := newFakeDriver()
+	certDriver, queryDriver = d, d
+	crawlPause.toggle()
+	defer crawlPause.resume()
+
+	// a domain waiting for a paused crawl is skipped once the crawl is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	domainNode := graph.NewDomainNode("a.test", 0)
+	done := make(chan struct{})
+	go func() {
+		visit(ctx, domainNode)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("visit returned while the crawl was paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("visit was not released by cancelling the crawl")
+	}
+	if want := status.NewMeta(status.SKIPPED, "interrupted"); domainNode.Status != want {
+		t.Errorf("cancelled domain has status %s, want %s", domainNode.Status.String(), want.String())
+	}
+	if !isPaused() {
+		t.Error("cancelling a paused crawl resumed it")
+	}
+}
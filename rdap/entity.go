@@ -0,0 +1,75 @@
+package rdap
+
+// response is the part of an RDAP domain response with the domain's contacts
+type response struct {
+	Entities []entity `json:"entities"`
+}
+
+// entity is a contact of an RDAP object, which may have contacts of its own
+type entity struct {
+	Roles      []string      `json:"roles"`
+	VCardArray []interface{} `json:"vcardArray"`
+	Entities   []entity      `json:"entities"`
+}
+
+// find returns the first non empty value of the vCard properties, in order, of the first entity with the role
+func (r *response) find(role string, properties ...string) string {
+	return findEntity(r.Entities, role, properties)
+}
+
+// findEntity searches the entities and the entities they contain for the first entity with the role
+func findEntity(entities []entity, role string, properties []string) string {
+	for _, e := range entities {
+		if e.hasRole(role) {
+			for _, property := range properties {
+				if value := e.vcard(property); len(value) > 0 {
+					return value
+				}
+			}
+		}
+		if value := findEntity(e.Entities, role, properties); len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+// hasRole returns true if the entity has the role
+func (e *entity) hasRole(role string) bool {
+	for _, r := range e.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// vcard returns the text value of the vCard property, or an empty string if the entity does not have it
+// vCards are encoded as jCards: ["vcard", [[name, parameters, type, value], ...]]
+func (e *entity) vcard(property string) string {
+	if len(e.VCardArray) < 2 {
+		return ""
+	}
+	properties, ok := e.VCardArray[1].([]interface{})
+	if !ok {
+		return ""
+	}
+	for _, p := range properties {
+		fields, ok := p.([]interface{})
+		if !ok || len(fields) < 4 || fields[0] != property {
+			continue
+		}
+		// org values may be a list of the organization's name and units
+		switch value := fields[3].(type) {
+		case string:
+			return value
+		case []interface{}:
+			if len(value) > 0 {
+				if name, ok := value[0].(string); ok {
+					return name
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,206 @@
+// Package rdap implements looking up the registrar and registrant of domains with RDAP
+// https://about.rdap.org/
+package rdap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+)
+
+// BootstrapURL is the IANA registry of the RDAP servers for each TLD
+var BootstrapURL = "https://data.iana.org/rdap/dns.json"
+
+// Unknown is the registrar or registrant of a domain whose registration could not be found
+const Unknown = "unknown"
+
+// maxRetryAfter is the longest a rate limited lookup waits before it is retried
+const maxRetryAfter = 10 * time.Second
+
+// errNoServer is returned for domains in TLDs without an RDAP server
+var errNoServer = errors.New("no RDAP server for TLD")
+
+// Registration is the registrar and registrant organization of a registered domain
+type Registration struct {
+	Registrar  string
+	Registrant string
+}
+
+// registration holds the lookup of a single registered domain
+type registration struct {
+	once         sync.Once
+	registration Registration
+	err          error
+}
+
+// Client looks up the registration of domains with RDAP
+// lookups are cached per registered domain, as it is shared by all of its subdomains
+type Client struct {
+	client          *http.Client
+	maxResponseSize int64
+
+	bootstrapOnce sync.Once
+	servers       map[string]string
+	bootstrapErr  error
+
+	lock  sync.Mutex
+	cache map[string]*registration
+}
+
+// NewClient returns a new Client
+// responses larger than maxResponseSize bytes are an error, 0 has no limit
+func NewClient(timeout time.Duration, maxResponseSize int64) *Client {
+	c := new(Client)
+	c.client = &http.Client{Timeout: timeout, Transport: driver.HTTPTransport()}
+	c.maxResponseSize = maxResponseSize
+	c.cache = make(map[string]*registration)
+	return c
+}
+
+// Lookup returns the registration of the registered domain
+// the registrar and registrant are Unknown if they can't be found, along with the error if there was one
+func (c *Client) Lookup(domain string) (Registration, error) {
+	domain = strings.ToLower(domain)
+	c.lock.Lock()
+	r, found := c.cache[domain]
+	if !found {
+		r = new(registration)
+		c.cache[domain] = r
+	}
+	c.lock.Unlock()
+
+	r.once.Do(func() {
+		r.registration, r.err = c.lookup(domain)
+	})
+	return r.registration, r.err
+}
+
+// lookup queries the RDAP server of the domain's TLD for its registration
+func (c *Client) lookup(domain string) (Registration, error) {
+	registration := Registration{Registrar: Unknown, Registrant: Unknown}
+	c.bootstrapOnce.Do(func() {
+		c.servers, c.bootstrapErr = c.bootstrap()
+	})
+	if c.bootstrapErr != nil {
+		return registration, c.bootstrapErr
+	}
+	server, ok := c.server(domain)
+	if !ok {
+		return registration, fmt.Errorf("%w: %s", errNoServer, domain)
+	}
+
+	var resp response
+	err := c.getJSON(server+"domain/"+domain, &resp)
+	if err != nil {
+		return registration, err
+	}
+	if registrar := resp.find("registrar", "fn"); len(registrar) > 0 {
+		registration.Registrar = registrar
+	}
+	if registrant := resp.find("registrant", "org", "fn"); len(registrant) > 0 {
+		registration.Registrant = registrant
+	}
+	return registration, nil
+}
+
+// bootstrap returns the base URL of the RDAP server for each TLD
+func (c *Client) bootstrap() (map[string]string, error) {
+	var registry struct {
+		// each service is a list of TLDs followed by a list of their server's URLs
+		Services [][][]string `json:"services"`
+	}
+	err := c.getJSON(BootstrapURL, &registry)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the RDAP bootstrap registry: %w", err)
+	}
+	servers := make(map[string]string)
+	for _, service := range registry.Services {
+		if len(service) < 2 || len(service[1]) == 0 {
+			continue
+		}
+		// prefer https servers
+		url := service[1][0]
+		for _, u := range service[1] {
+			if strings.HasPrefix(u, "https://") {
+				url = u
+				break
+			}
+		}
+		if !strings.HasSuffix(url, "/") {
+			url += "/"
+		}
+		for _, tld := range service[0] {
+			servers[strings.ToLower(tld)] = url
+		}
+	}
+	return servers, nil
+}
+
+// server returns the RDAP server of the longest TLD in the registry the domain is in
+func (c *Client) server(domain string) (string, bool) {
+	for suffix := domain; len(suffix) > 0; {
+		if server, ok := c.servers[suffix]; ok {
+			return server, true
+		}
+		i := strings.Index(suffix, ".")
+		if i < 0 {
+			break
+		}
+		suffix = suffix[i+1:]
+	}
+	return "", false
+}
+
+// getJSON gets the JSON response at url and parses it into target
+// rate limited requests are retried once after the Retry-After delay, up to maxRetryAfter
+func (c *Client) getJSON(url string, target interface{}) error {
+	for retried := false; ; retried = true {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/rdap+json, application/json")
+		r, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if r.StatusCode == http.StatusTooManyRequests {
+			r.Body.Close()
+			if retried {
+				return fmt.Errorf("%w on URL: %s", driver.ErrRateLimited, url)
+			}
+			time.Sleep(retryAfter(r.Header.Get("Retry-After")))
+			continue
+		}
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			return errors.New("Got non OK HTTP status: '" + r.Status + "' on URL: " + url)
+		}
+		respData, err := ioutil.ReadAll(driver.LimitReader(r.Body, c.maxResponseSize))
+		if err != nil {
+			return fmt.Errorf("%w on URL: %s", err, url)
+		}
+		return json.Unmarshal(respData, target)
+	}
+}
+
+// retryAfter returns how long to wait for the Retry-After header value in seconds, one second if it is not set
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 1 {
+		return time.Second
+	}
+	wait := time.Duration(seconds) * time.Second
+	if wait > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return wait
+}
@@ -0,0 +1,196 @@
+package rdap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+)
+
+// domainResponse is an RDAP domain response with a registrar and a registrant nested in a reseller
+const domainResponse = `{
+	"entities": [
+		{
+			"roles": ["registrar"],
+			"vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example Registrar"]]]
+		},
+		{
+			"roles": ["reseller"],
+			"entities": [
+				{
+					"roles": ["registrant"],
+					"vcardArray": ["vcard", [["fn", {}, "text", "Jane Doe"], ["org", {}, "text", ["Example Inc", "Web"]]]]
+				}
+			]
+		}
+	]
+}`
+
+// newRDAPServer returns a mock bootstrap registry and RDAP server for the test and example TLDs
+// RDAP queries are counted in lookups, and the first query of rateLimited is rate limited
+func newRDAPServer(t *testing.T, lookups *int32) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	var rateLimited int32
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dns.json":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"services": [][][]string{
+					{{"test", "co.test"}, {server.URL + "/rdap"}},
+					{{"example"}, {server.URL + "/rdap/"}},
+					{{"secure"}, {"http://rdap.secure.example/", "https://rdap.secure.example"}},
+				},
+			})
+		case "/rdap/domain/example.test", "/rdap/domain/example.co.test":
+			atomic.AddInt32(lookups, 1)
+			w.Write([]byte(domainResponse))
+		case "/rdap/domain/ratelimited.test":
+			atomic.AddInt32(lookups, 1)
+			if atomic.AddInt32(&rateLimited, 1) == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte(`{"entities": []}`))
+		case "/rdap/domain/limited.example":
+			atomic.AddInt32(lookups, 1)
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+// useBootstrap sets the BootstrapURL until the returned function is called
+func useBootstrap(url string) func() {
+	previous := BootstrapURL
+	BootstrapURL = url
+	return func() {
+		BootstrapURL = previous
+	}
+}
+
+func TestLookup(t *testing.T) {
+	var lookups int32
+	server := newRDAPServer(t, &lookups)
+	defer server.Close()
+	defer useBootstrap(server.URL + "/dns.json")()
+	client := NewClient(5*time.Second, 0)
+
+	tests := []struct {
+		domain string
+		want   Registration
+		err    string
+	}{
+		{"example.test", Registration{"Example Registrar", "Example Inc"}, ""},
+		{"Example.co.test", Registration{"Example Registrar", "Example Inc"}, ""},
+		{"ratelimited.test", Registration{Unknown, Unknown}, ""},
+		{"missing.test", Registration{Unknown, Unknown}, "404"},
+		{"example.net", Registration{Unknown, Unknown}, errNoServer.Error()},
+		{"limited.example", Registration{Unknown, Unknown}, driver.ErrRateLimited.Error()},
+	}
+	for _, test := range tests {
+		registration, err := client.Lookup(test.domain)
+		if registration != test.want {
+			t.Errorf("Lookup(%s) = %+v, want %+v", test.domain, registration, test.want)
+		}
+		if (err == nil) != (len(test.err) == 0) || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("Lookup(%s) returned the error %v, want %q", test.domain, err, test.err)
+		}
+	}
+	// example.test, example.co.test, and ratelimited.test and limited.example twice
+	if lookups != 6 {
+		t.Errorf("made %d RDAP queries, want 6", lookups)
+	}
+}
+
+func TestLookupCache(t *testing.T) {
+	var lookups int32
+	server := newRDAPServer(t, &lookups)
+	defer server.Close()
+	defer useBootstrap(server.URL + "/dns.json")()
+	client := NewClient(5*time.Second, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registration, err := client.Lookup("example.test")
+			if err != nil || registration.Registrar != "Example Registrar" {
+				t.Errorf("Lookup returned %+v, %v", registration, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if lookups != 1 {
+		t.Errorf("20 concurrent lookups of the same domain made %d RDAP queries, want 1", lookups)
+	}
+}
+
+func TestLookupBootstrapError(t *testing.T) {
+	defer useBootstrap("http://127.0.0.1:0/dns.json")()
+	client := NewClient(time.Second, 0)
+	for _, domain := range []string{"a.test", "b.test"} {
+		registration, err := client.Lookup(domain)
+		if err == nil || !strings.Contains(err.Error(), "bootstrap") || registration.Registrar != Unknown {
+			t.Errorf("Lookup(%s) without a bootstrap registry returned %+v, %v", domain, registration, err)
+		}
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	var lookups int32
+	server := newRDAPServer(t, &lookups)
+	defer server.Close()
+	defer useBootstrap(server.URL + "/dns.json")()
+	client := NewClient(5*time.Second, 0)
+
+	servers, err := client.bootstrap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.servers = servers
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.test", server.URL + "/rdap/"},
+		{"www.example.co.test", server.URL + "/rdap/"},
+		// https servers are preferred
+		{"example.secure", "https://rdap.secure.example/"},
+		{"example.net", ""},
+	}
+	for _, test := range tests {
+		got, ok := client.server(test.domain)
+		if got != test.want || ok != (len(test.want) > 0) {
+			t.Errorf("server(%s) = %s, %v, want %s", test.domain, got, ok, test.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", time.Second},
+		{"0", time.Second},
+		{"soon", time.Second},
+		{"3", 3 * time.Second},
+		{"3600", maxRetryAfter},
+	}
+	for _, test := range tests {
+		if got := retryAfter(test.header); got != test.want {
+			t.Errorf("retryAfter(%q) = %v, want %v", test.header, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package revocation implements checking of certificate revocation status
+package revocation
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lanrat/certgraph/driver"
+)
+
+// Status is the revocation status of a certificate
+type Status int
+
+// Status states
+const (
+	UNKNOWN = iota
+	GOOD    = iota
+	REVOKED = iota
+)
+
+// String returns the revocation status for printing
+func (status Status) String() string {
+	switch status {
+	case UNKNOWN:
+		return "Unknown"
+	case GOOD:
+		return "Good"
+	case REVOKED:
+		return "Revoked"
+	}
+	return "?"
+}
+
+// crl holds the revoked serial numbers of a downloaded CRL
+type crl struct {
+	once    sync.Once
+	revoked map[string]bool
+	err     error
+}
+
+// CRLChecker checks certificates against the CRLs listed in their distribution points
+// CRLs are cached per URL as they can be large and are shared by many certificates
+// the CRL signatures are not verified
+type CRLChecker struct {
+	client          *http.Client
+	maxResponseSize int64
+	lock            sync.Mutex
+	cache           map[string]*crl
+}
+
+// NewCRLChecker returns a new CRLChecker
+// CRLs larger than maxResponseSize bytes are treated as failed downloads, 0 has no limit
+func NewCRLChecker(timeout time.Duration, maxResponseSize int64) *CRLChecker {
+	c := new(CRLChecker)
+	c.client = &http.Client{Timeout: timeout, Transport: driver.HTTPTransport()}
+	c.maxResponseSize = maxResponseSize
+	c.cache = make(map[string]*crl)
+	return c
+}
+
+// Check returns the revocation status of the certificate with the provided serial number
+// using the CRLs at the provided urls
+// CRLs that fail to download are ignored, if none can be downloaded the status is UNKNOWN
+func (c *CRLChecker) Check(serial *big.Int, urls []string) Status {
+	if serial == nil {
+		return UNKNOWN
+	}
+	status := Status(UNKNOWN)
+	for _, url := range urls {
+		revoked, err := c.get(url)
+		if err != nil {
+			continue
+		}
+		if revoked[serial.String()] {
+			return REVOKED
+		}
+		status = GOOD
+	}
+	return status
+}
+
+// get returns the set of revoked serial numbers in the CRL at url, downloading it only once
+func (c *CRLChecker) get(url string) (map[string]bool, error) {
+	c.lock.Lock()
+	list, found := c.cache[url]
+	if !found {
+		list = new(crl)
+		c.cache[url] = list
+	}
+	c.lock.Unlock()
+
+	list.once.Do(func() {
+		list.revoked, list.err = c.download(url)
+	})
+	return list.revoked, list.err
+}
+
+// download fetches and parses the CRL at url
+func (c *CRLChecker) download(url string) (map[string]bool, error) {
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Got non OK HTTP status: '" + resp.Status + "' on URL: " + url)
+	}
+	data, err := ioutil.ReadAll(driver.LimitReader(resp.Body, c.maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	certList, err := x509.ParseCRL(data)
+	if err != nil {
+		return nil, err
+	}
+	revoked := make(map[string]bool, len(certList.TBSCertList.RevokedCertificates))
+	for _, cert := range certList.TBSCertList.RevokedCertificates {
+		revoked[cert.SerialNumber.String()] = true
+	}
+	return revoked, nil
+}
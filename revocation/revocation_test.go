@@ -0,0 +1,118 @@
+package revocation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCRL returns a CRL revoking the serial numbers
+func testCRL(t *testing.T, serials ...int64) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked := make([]pkix.RevokedCertificate, 0, len(serials))
+	for _, serial := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+	crl, err := ca.CreateCRL(rand.Reader, key, revoked, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+func TestCheck(t *testing.T) {
+	crls := map[string][]byte{
+		"/a.crl":   testCRL(t, 10, 11),
+		"/b.crl":   testCRL(t, 20),
+		"/bad.crl": []byte("not a crl"),
+	}
+	var downloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		crl, ok := crls[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(crl)
+	}))
+	defer server.Close()
+	a, b, bad, missing := server.URL+"/a.crl", server.URL+"/b.crl", server.URL+"/bad.crl", server.URL+"/missing.crl"
+
+	checker := NewCRLChecker(time.Second, 0)
+	tests := []struct {
+		name   string
+		serial *big.Int
+		urls   []string
+		want   Status
+	}{
+		{"revoked", big.NewInt(10), []string{a}, REVOKED},
+		{"good", big.NewInt(12), []string{a}, GOOD},
+		{"revoked by the second crl", big.NewInt(20), []string{a, b}, REVOKED},
+		{"failed crls are ignored", big.NewInt(11), []string{missing, bad, a}, REVOKED},
+		{"good with failed crls", big.NewInt(12), []string{bad, a}, GOOD},
+		{"no crls", big.NewInt(10), nil, UNKNOWN},
+		{"only failed crls", big.NewInt(10), []string{missing, bad}, UNKNOWN},
+		{"no serial", nil, []string{a}, UNKNOWN},
+	}
+	for _, test := range tests {
+		if got := checker.Check(test.serial, test.urls); got != test.want {
+			t.Errorf("%s: Check = %s, want %s", test.name, got, test.want)
+		}
+	}
+	// each CRL is downloaded once, including those that failed
+	if downloads != 4 {
+		t.Errorf("downloaded %d CRLs, want 4", downloads)
+	}
+
+	limited := NewCRLChecker(time.Second, 10)
+	if got := limited.Check(big.NewInt(10), []string{a}); got != UNKNOWN {
+		t.Errorf("Check of a CRL larger than the maximum response size = %s, want %s", got, Status(UNKNOWN))
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   string
+	}{
+		{UNKNOWN, "Unknown"},
+		{GOOD, "Good"},
+		{REVOKED, "Revoked"},
+		{Status(10), "?"},
+	}
+	for _, test := range tests {
+		if got := test.status.String(); got != test.want {
+			t.Errorf("Status(%d).String() = %s, want %s", test.status, got, test.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package status
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"syscall"
@@ -63,6 +64,7 @@ const (
 	ERROR    = iota
 	REDIRECT = iota
 	CT       = iota
+	SKIPPED  = iota
 )
 
 // String returns the domain status for printing
@@ -84,6 +86,8 @@ func (status DomainStatus) String() string {
 		return "Redirect"
 	case CT:
 		return "CT"
+	case SKIPPED:
+		return "Skipped"
 	}
 	return "?"
 }
@@ -110,3 +114,15 @@ func CheckNetErr(err error) DomainStatus {
 	}
 	return ERROR
 }
+
+// Transient returns true if err, or any error it wraps, is one of the expected network errors of a crawl
+// such as a domain that does not resolve, a refused connection, or a timeout
+func Transient(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch CheckNetErr(err) {
+		case NOHOST, REFUSED, TIMEOUT:
+			return true
+		}
+	}
+	return false
+}
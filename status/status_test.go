@@ -0,0 +1,63 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestCheckNetErr(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want DomainStatus
+	}{
+		{"nil", nil, GOOD},
+		{"timeout", timeoutError{}, TIMEOUT},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, TIMEOUT},
+		{"dial", &net.OpError{Op: "dial", Err: errors.New("no such host")}, NOHOST},
+		{"read", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, REFUSED},
+		{"refused", syscall.ECONNREFUSED, REFUSED},
+		{"write", &net.OpError{Op: "write", Err: syscall.EPIPE}, ERROR},
+		{"other", errors.New("certificate not found"), ERROR},
+	}
+	for _, test := range tests {
+		if got := CheckNetErr(test.err); got != test.want {
+			t.Errorf("CheckNetErr(%s) = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTransient(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Err: errors.New("no such host")}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"timeout", timeoutError{}, true},
+		{"dial", dial, true},
+		{"refused", syscall.ECONNREFUSED, true},
+		{"wrapped", fmt.Errorf("crtsh: %w", dial), true},
+		{"wrapped twice", fmt.Errorf("retry: %w", fmt.Errorf("crtsh: %w", timeoutError{})), true},
+		{"not wrapped", fmt.Errorf("crtsh: %v", dial), false},
+		{"cancelled", context.Canceled, false},
+		{"other", errors.New("unexpected response"), false},
+	}
+	for _, test := range tests {
+		if got := Transient(test.err); got != test.want {
+			t.Errorf("Transient(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package trace records the events of a crawl in order so it can be replayed or debugged
+//
+// Events are written as JSON lines, one object per event, with the following fields:
+//
+//	time    RFC3339 timestamp of the event
+//	type    the event type, one of the Event constants
+//	domain  the domain the event is for
+//	depth   the BFS depth of the domain
+//	cert    hex fingerprint of the certificate the event is for, if any
+//	from    the domain that the domain was found from, for neighbor events
+//	reason  why the event happened, for seed, dropped, cert, and filtered events, and apex neighbor events
+//	status  the status of the domain, for visited events
+//	version the schema version, only for the start event
+//
+// Fields that don't apply to an event are omitted, except depth.
+// New fields and event types may be added, existing ones will not change without a new Version.
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Version is the version of the event schema
+const Version = 1
+
+// Event types
+const (
+	// Start is the first event of every trace
+	Start = "start"
+	// Seed is a root domain queued to be crawled
+	Seed = "seed"
+	// Neighbor is a domain queued to be crawled because it was found from another domain
+	Neighbor = "neighbor"
+	// Dropped is a queued domain that will not be crawled
+	Dropped = "dropped"
+	// Enqueued is a domain added to the graph to be visited
+	Enqueued = "enqueued"
+	// Visited is a domain that has been visited
+	Visited = "visited"
+	// Cert is a certificate found for a domain
+	Cert = "cert"
+	// Filtered is a certificate whose domains will not be crawled
+	Filtered = "filtered"
+	// Done is the last event of every trace
+	Done = "done"
+)
+
+// Event is a single event in the trace
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Domain  string    `json:"domain,omitempty"`
+	Depth   uint      `json:"depth"`
+	Cert    string    `json:"cert,omitempty"`
+	From    string    `json:"from,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Status  string    `json:"status,omitempty"`
+	Version int       `json:"version,omitempty"`
+}
+
+// Tracer writes events to a file
+// a nil Tracer discards all events
+type Tracer struct {
+	lock    sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	err     error
+}
+
+// Create returns a new Tracer writing to the file at path, the file is overwritten
+func Create(path string) (*Tracer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tracer{file: file, writer: bufio.NewWriter(file)}
+	t.encoder = json.NewEncoder(t.writer)
+	t.Record(Event{Type: Start, Version: Version})
+	return t, nil
+}
+
+// Record writes the event to the trace, setting its time if it was not set
+func (t *Tracer) Record(event Event) {
+	if t == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.err != nil {
+		return
+	}
+	t.err = t.encoder.Encode(event)
+}
+
+// Close records the done event and closes the trace file
+// returns the first error encountered writing the trace
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.Record(Event{Type: Done})
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.err == nil {
+		t.err = t.writer.Flush()
+	}
+	err := t.file.Close()
+	if t.err == nil {
+		t.err = err
+	}
+	return t.err
+}
@@ -0,0 +1,123 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readEvents returns the events of the trace file at path, failing if any line is not a JSON event
+func readEvents(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event map[string]interface{}
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			t.Fatalf("line %d is not a JSON event: %v", len(events)+1, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestTracer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl")
+
+	tracer, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tracer.Record(Event{Type: Seed, Domain: "a.test", Reason: "root"})
+	tracer.Record(Event{Type: Neighbor, Domain: "b.test", Depth: 1, From: "a.test", Time: when})
+	tracer.Record(Event{Type: Visited, Domain: "b.test", Depth: 1, Status: "Good"})
+	err = tracer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := readEvents(t, path)
+	tests := []map[string]interface{}{
+		{"type": Start, "depth": float64(0), "version": float64(Version)},
+		{"type": Seed, "domain": "a.test", "depth": float64(0), "reason": "root"},
+		{"type": Neighbor, "domain": "b.test", "depth": float64(1), "from": "a.test", "time": "2020-01-02T03:04:05Z"},
+		{"type": Visited, "domain": "b.test", "depth": float64(1), "status": "Good"},
+		{"type": Done, "depth": float64(0)},
+	}
+	if len(events) != len(tests) {
+		t.Fatalf("trace has %d events, want %d", len(events), len(tests))
+	}
+	for i, want := range tests {
+		if _, ok := events[i]["time"]; !ok {
+			t.Errorf("event %d has no time", i)
+		}
+		if _, ok := want["time"]; !ok {
+			delete(events[i], "time")
+		}
+		if fmt.Sprint(events[i]) != fmt.Sprint(want) {
+			t.Errorf("event %d is %v, want %v", i, events[i], want)
+		}
+	}
+}
+
+func TestTracerConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl")
+
+	tracer, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const records = 100
+	var wg sync.WaitGroup
+	for i := 0; i < records; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tracer.Record(Event{Type: Enqueued, Domain: strings.Repeat("a", i+1) + ".test"})
+		}(i)
+	}
+	wg.Wait()
+	err = tracer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every line is a whole event
+	if events := readEvents(t, path); len(events) != records+2 {
+		t.Errorf("trace has %d events, want %d", len(events), records+2)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	tracer.Record(Event{Type: Seed, Domain: "a.test"})
+	if err := tracer.Close(); err != nil {
+		t.Errorf("Close of a nil Tracer returned %v", err)
+	}
+}
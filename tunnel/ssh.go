@@ -0,0 +1,86 @@
+// Package tunnel connects to hosts through an SSH jump host, for domains that are only reachable through a bastion
+package tunnel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSH connects to the jump host given as user@host[:port] and returns the client, whose Dial connects through it
+// authenticates with the private key in keyPath, or the keys in the SSH agent if keyPath is empty
+// the jump host's key is verified against the knownHosts file
+func SSH(jump, keyPath, knownHosts string, timeout time.Duration) (*ssh.Client, error) {
+	i := strings.LastIndex(jump, "@")
+	if i < 1 || i == len(jump)-1 {
+		return nil, fmt.Errorf("ssh jump host %q is not in the form user@host", jump)
+	}
+	user, addr := jump[:i], jump[i+1:]
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	auth, err := authMethod(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := knownhosts.New(expandHome(knownHosts))
+	if err != nil {
+		return nil, fmt.Errorf("ssh known hosts: %w", err)
+	}
+
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ssh jump host %s: %w", addr, err)
+	}
+	return client, nil
+}
+
+// authMethod returns the ssh authentication for the private key in keyPath, or the SSH agent if keyPath is empty
+func authMethod(keyPath string) (ssh.AuthMethod, error) {
+	if len(keyPath) == 0 {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if len(sock) == 0 {
+			return nil, fmt.Errorf("ssh jump host requires a private key or a running SSH agent")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, fmt.Errorf("ssh agent: %w", err)
+		}
+		return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+	}
+	key, err := ioutil.ReadFile(expandHome(keyPath))
+	if err != nil {
+		return nil, fmt.Errorf("ssh key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("ssh key %s: %w", keyPath, err)
+	}
+	return ssh.PublicKeys(signer), nil
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
@@ -0,0 +1,247 @@
+package tunnel
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newKey returns a new private key and its signer
+func newKey(t *testing.T) (*ecdsa.PrivateKey, ssh.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, signer
+}
+
+// jumpServer is an SSH server that forwards the direct-tcpip channels of clients authenticated with clientKey
+type jumpServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+}
+
+func newJumpServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) *jumpServer {
+	t.Helper()
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "jump" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &jumpServer{listener: listener, config: config}
+	go s.serve()
+	return s
+}
+
+func (s *jumpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			for newChannel := range channels {
+				go forward(newChannel)
+			}
+		}()
+	}
+}
+
+// forward connects a direct-tcpip channel to the address it requested
+func forward(newChannel ssh.NewChannel) {
+	var target struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if newChannel.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+		newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(channel, conn)
+		channel.Close()
+	}()
+	io.Copy(conn, channel)
+	conn.Close()
+}
+
+// writeFiles writes the client's private key and a known_hosts file with the host's key for addr to dir
+func writeFiles(t *testing.T, dir string, clientKey *ecdsa.PrivateKey, addr string, hostKey ssh.PublicKey) (string, string) {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_ecdsa")
+	err = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	knownHosts := filepath.Join(dir, "known_hosts")
+	err = ioutil.WriteFile(knownHosts, []byte(knownhosts.Line([]string{addr}, hostKey)+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyPath, knownHosts
+}
+
+func TestSSH(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	_, hostKey := newKey(t)
+	clientKey, clientSigner := newKey(t)
+	server := newJumpServer(t, hostKey, clientSigner.PublicKey())
+	defer server.listener.Close()
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := server.listener.Addr().String()
+	keyPath, knownHosts := writeFiles(t, dir, clientKey, addr, hostKey.PublicKey())
+
+	client, err := SSH("jump@"+addr, keyPath, knownHosts, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := client.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 5)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "hello" {
+		t.Errorf("read %q, %v through the tunnel, want the echo of hello", reply, err)
+	}
+
+	// a jump host whose key is not the known one is refused
+	_, otherKey := newKey(t)
+	_, otherKnownHosts := writeFiles(t, dir, clientKey, addr, otherKey.PublicKey())
+	if _, err := SSH("jump@"+addr, keyPath, otherKnownHosts, time.Second); err == nil {
+		t.Error("SSH to a jump host with an unknown key did not fail")
+	}
+}
+
+func TestSSHErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clientKey, _ := newKey(t)
+	_, hostKey := newKey(t)
+	keyPath, knownHosts := writeFiles(t, dir, clientKey, "127.0.0.1", hostKey.PublicKey())
+	invalidKey := filepath.Join(dir, "invalid")
+	if err := ioutil.WriteFile(invalidKey, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if sock, ok := os.LookupEnv("SSH_AUTH_SOCK"); ok {
+		os.Unsetenv("SSH_AUTH_SOCK")
+		defer os.Setenv("SSH_AUTH_SOCK", sock)
+	}
+
+	tests := []struct {
+		name       string
+		jump       string
+		keyPath    string
+		knownHosts string
+		want       string
+	}{
+		{"no user", "127.0.0.1", keyPath, knownHosts, "user@host"},
+		{"no host", "jump@", keyPath, knownHosts, "user@host"},
+		{"no agent", "jump@127.0.0.1", "", knownHosts, "agent"},
+		{"missing key", "jump@127.0.0.1", filepath.Join(dir, "missing"), knownHosts, "ssh key"},
+		{"invalid key", "jump@127.0.0.1", invalidKey, knownHosts, "ssh key " + invalidKey},
+		{"missing known hosts", "jump@127.0.0.1", keyPath, filepath.Join(dir, "missing"), "known hosts"},
+	}
+	for _, test := range tests {
+		_, err := SSH(test.jump, test.keyPath, test.knownHosts, time.Second)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: SSH returned %v, want an error containing %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := map[string]string{
+		"~/.ssh/known_hosts": filepath.Join(home, ".ssh/known_hosts"),
+		"/etc/ssh/known":     "/etc/ssh/known",
+		"~user/known":        "~user/known",
+	}
+	for path, want := range tests {
+		if got := expandHome(path); got != want {
+			t.Errorf("expandHome(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
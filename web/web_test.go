@@ -0,0 +1,19 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIndexHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	indexHandler(w, httptest.NewRequest("GET", "/", nil))
+	body, err := ioutil.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) == 0 || string(body) != indexSource {
+		t.Errorf("indexHandler served %d bytes, want the %d bytes of the web UI", len(body), len(indexSource))
+	}
+}